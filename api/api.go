@@ -1,5 +1,8 @@
 package api
 
+import ytrelay "github.com/mirror-media/yt-relay"
+
 type ErrorResp struct {
-	Error string `json:"error"`
+	Error   string                   `json:"error"`
+	Details ytrelay.ValidationErrors `json:"details,omitempty"`
 }
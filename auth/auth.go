@@ -0,0 +1,230 @@
+// Package auth authenticates the consumers of the relay with api tokens or signed JWTs
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrUnauthenticated is returned if the credential is missing or doesn't belong to any consumer
+	ErrUnauthenticated = errors.New("credential is missing or invalid")
+	// ErrDisabled is returned if the consumer is disabled
+	ErrDisabled = errors.New("consumer is disabled")
+)
+
+// lookupTTL is how long the consumers found in redis are kept in memory
+const lookupTTL = 30 * time.Second
+
+// Consumer is an authenticated client of the relay
+type Consumer struct {
+	Name       string                     `json:"name"`
+	Routes     []string                   `json:"routes,omitempty"`
+	Whitelists *config.ConsumerWhitelists `json:"whitelists,omitempty"`
+	RateLimit  *config.RateLimit          `json:"rateLimit,omitempty"`
+	Disabled   bool                       `json:"disabled,omitempty"`
+}
+
+// AllowsRoute reports if the consumer can request the route
+func (c *Consumer) AllowsRoute(route string) bool {
+	if len(c.Routes) == 0 {
+		return true
+	}
+	for _, r := range c.Routes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// WithConsumer returns a copy of ctx carrying the consumer
+func WithConsumer(ctx context.Context, consumer *Consumer) context.Context {
+	return context.WithValue(ctx, contextKey{}, consumer)
+}
+
+// FromContext returns the consumer in ctx, or nil if the request is not authenticated
+func FromContext(ctx context.Context) *Consumer {
+	consumer, _ := ctx.Value(contextKey{}).(*Consumer)
+	return consumer
+}
+
+// Name returns the name of the consumer in ctx, or an empty string if there is none
+func Name(ctx context.Context) string {
+	if consumer := FromContext(ctx); consumer != nil {
+		return consumer.Name
+	}
+	return ""
+}
+
+// CacheNamespace returns the namespace of the response cache. Consumers with their own whitelists get their own namespace,
+// otherwise a response cached for another consumer would bypass their whitelists.
+func CacheNamespace(ctx context.Context, namespace string) string {
+	if consumer := FromContext(ctx); consumer != nil && consumer.Whitelists != nil {
+		return fmt.Sprintf("%s:consumer:%s", namespace, consumer.Name)
+	}
+	return namespace
+}
+
+// Whitelist returns the whitelist further restricted by the consumer in ctx
+func Whitelist(ctx context.Context, whitelist ytrelay.APIWhitelist) ytrelay.APIWhitelist {
+	if consumer := FromContext(ctx); consumer != nil && consumer.Whitelists != nil {
+		return &consumerWhitelist{APIWhitelist: whitelist, whitelists: *consumer.Whitelists}
+	}
+	return whitelist
+}
+
+// consumerWhitelist requires the ids to be allowed by both the tenant and the consumer. Empty map of the consumer doesn't restrict.
+type consumerWhitelist struct {
+	ytrelay.APIWhitelist
+	whitelists config.ConsumerWhitelists
+}
+
+func (w *consumerWhitelist) ValidateChannelID(channelID string) bool {
+	if len(w.whitelists.ChannelIDs) > 0 && !w.whitelists.ChannelIDs[channelID] {
+		return false
+	}
+	return w.APIWhitelist.ValidateChannelID(channelID)
+}
+
+func (w *consumerWhitelist) ValidatePlaylistIDs(ctx context.Context, playlistID string) bool {
+	if len(w.whitelists.PlaylistIDs) > 0 && !w.whitelists.PlaylistIDs[playlistID] {
+		return false
+	}
+	return w.APIWhitelist.ValidatePlaylistIDs(ctx, playlistID)
+}
+
+type cachedConsumer struct {
+	consumer  *Consumer
+	expiresAt time.Time
+}
+
+// Authenticator finds the consumer of the credential in the configuration, and in redis if it's enabled
+type Authenticator struct {
+	byName  map[string]*Consumer
+	byToken map[string]*Consumer
+	jwt     *jwtVerifier
+	store   *Store
+
+	mu     sync.Mutex
+	cached map[string]cachedConsumer
+}
+
+// NewAuthenticator creates the authenticator of a tenant. store is only used if conf.Redis is true.
+func NewAuthenticator(namespace string, conf config.ClientAuth, store cache.Provider) (*Authenticator, error) {
+	a := &Authenticator{
+		byName:  make(map[string]*Consumer, len(conf.Consumers)),
+		byToken: make(map[string]*Consumer, len(conf.Consumers)),
+		cached:  make(map[string]cachedConsumer),
+	}
+	for name, c := range conf.Consumers {
+		consumer := &Consumer{
+			Name:       name,
+			Routes:     c.Routes,
+			Whitelists: c.Whitelists,
+			RateLimit:  c.RateLimit,
+			Disabled:   c.Disabled,
+		}
+		a.byName[name] = consumer
+		if c.Token != "" {
+			a.byToken[c.Token] = consumer
+		}
+	}
+	if conf.JWT != nil {
+		verifier, err := newJWTVerifier(*conf.JWT)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = verifier
+	}
+	if conf.Redis {
+		if store == nil {
+			return nil, errors.New("consumers are looked up in redis but there is no store")
+		}
+		a.store = NewStore(namespace, store)
+	}
+	return a, nil
+}
+
+// Authenticate finds the consumer of the bearer token, which is either an api token or a JWT
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (*Consumer, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	var consumer *Consumer
+	var err error
+	if a.jwt != nil && strings.Count(token, ".") == 2 {
+		var name string
+		if name, err = a.jwt.subject(token); err != nil {
+			log.Infof("verifying jwt encountered error: %v", err)
+			return nil, ErrUnauthenticated
+		}
+		consumer, err = a.lookup(ctx, "name:"+name, func() (*Consumer, error) {
+			if c, ok := a.byName[name]; ok {
+				return c, nil
+			}
+			if a.store == nil {
+				return nil, nil
+			}
+			return a.store.Get(ctx, name)
+		})
+	} else {
+		consumer, err = a.lookup(ctx, "token:"+HashToken(token), func() (*Consumer, error) {
+			if c, ok := a.byToken[token]; ok {
+				return c, nil
+			}
+			if a.store == nil {
+				return nil, nil
+			}
+			return a.store.GetByToken(ctx, token)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if consumer == nil {
+		return nil, ErrUnauthenticated
+	}
+	if consumer.Disabled {
+		return consumer, ErrDisabled
+	}
+	return consumer, nil
+}
+
+// lookup keeps the consumers found in redis for lookupTTL. The ones not found are not kept, so random credentials can't fill the memory.
+func (a *Authenticator) lookup(ctx context.Context, key string, find func() (*Consumer, error)) (*Consumer, error) {
+	now := time.Now()
+	a.mu.Lock()
+	if c, ok := a.cached[key]; ok && now.Before(c.expiresAt) {
+		a.mu.Unlock()
+		return c.consumer, nil
+	}
+	a.mu.Unlock()
+
+	consumer, err := find()
+	if err != nil || consumer == nil || a.store == nil {
+		return consumer, err
+	}
+
+	a.mu.Lock()
+	for k, c := range a.cached {
+		if now.After(c.expiresAt) {
+			delete(a.cached, k)
+		}
+	}
+	a.cached[key] = cachedConsumer{consumer: consumer, expiresAt: now.Add(lookupTTL)}
+	a.mu.Unlock()
+	return consumer, nil
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v4"
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/config"
+)
+
+// testAuth has web with a token, jwt-only without one, and the disabled old
+var testAuth = config.ClientAuth{
+	Consumers: map[string]config.Consumer{
+		"web":      {Token: "web-token"},
+		"jwt-only": {Routes: []string{"/youtube/v3/search"}},
+		"old":      {Token: "old-token", Disabled: true},
+	},
+	JWT: &config.JWTAuth{Secret: jwtSecret},
+}
+
+func TestAuthenticate(t *testing.T) {
+	a, err := NewAuthenticator("test", testAuth, nil)
+	if err != nil {
+		t.Fatalf("creating authenticator encountered error: %v", err)
+	}
+	jwtOf := func(subject string) string {
+		return sign(t, jwt.SigningMethodHS256, []byte(jwtSecret), &jwt.RegisteredClaims{Subject: subject})
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		consumer string
+		err      error
+	}{
+		{name: "api token", token: "web-token", consumer: "web"},
+		{name: "jwt", token: jwtOf("jwt-only"), consumer: "jwt-only"},
+		{name: "jwt of a consumer with a token", token: jwtOf("web"), consumer: "web"},
+		{name: "empty", token: "", err: ErrUnauthenticated},
+		{name: "unknown api token", token: "other-token", err: ErrUnauthenticated},
+		{name: "jwt of an unknown consumer", token: jwtOf("nobody"), err: ErrUnauthenticated},
+		{name: "forged jwt", token: sign(t, jwt.SigningMethodHS256, []byte("other"), &jwt.RegisteredClaims{Subject: "web"}), err: ErrUnauthenticated},
+		{name: "disabled api token", token: "old-token", consumer: "old", err: ErrDisabled},
+		{name: "jwt of a disabled consumer", token: jwtOf("old"), consumer: "old", err: ErrDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consumer, err := a.Authenticate(context.Background(), tt.token)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.err)
+			}
+			if name := nameOf(consumer); name != tt.consumer {
+				t.Errorf("Authenticate() = consumer(%s), want %s", name, tt.consumer)
+			}
+		})
+	}
+}
+
+func nameOf(consumer *Consumer) string {
+	if consumer == nil {
+		return ""
+	}
+	return consumer.Name
+}
+
+func TestAuthenticateWithoutJWT(t *testing.T) {
+	a, err := NewAuthenticator("test", config.ClientAuth{Consumers: testAuth.Consumers}, nil)
+	if err != nil {
+		t.Fatalf("creating authenticator encountered error: %v", err)
+	}
+	token := sign(t, jwt.SigningMethodHS256, []byte(jwtSecret), &jwt.RegisteredClaims{Subject: "web"})
+	if _, err = a.Authenticate(context.Background(), token); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Authenticate() error = %v, want ErrUnauthenticated for a jwt while jwt is not enabled", err)
+	}
+}
+
+func TestAuthenticateFromStore(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("starting redis encountered error: %v", err)
+	}
+	defer server.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer rdb.Close()
+	store := NewStore("test", cache.NewRedisProvider(rdb))
+
+	ctx := context.Background()
+	a, err := NewAuthenticator("test", config.ClientAuth{Redis: true}, cache.NewRedisProvider(rdb))
+	if err != nil {
+		t.Fatalf("creating authenticator encountered error: %v", err)
+	}
+	if err = store.Put(ctx, Consumer{Name: "stored"}, "first-token"); err != nil {
+		t.Fatalf("storing consumer encountered error: %v", err)
+	}
+	if consumer, err := a.Authenticate(ctx, "first-token"); err != nil || nameOf(consumer) != "stored" {
+		t.Fatalf("Authenticate() = consumer(%s), %v, want stored", nameOf(consumer), err)
+	}
+
+	// the rotated token is looked up in redis, and the previous one is removed from redis
+	if err = store.Put(ctx, Consumer{Name: "stored"}, "second-token"); err != nil {
+		t.Fatalf("rotating token encountered error: %v", err)
+	}
+	if consumer, err := a.Authenticate(ctx, "second-token"); err != nil || nameOf(consumer) != "stored" {
+		t.Errorf("Authenticate() = consumer(%s), %v, want stored with the rotated token", nameOf(consumer), err)
+	}
+	if consumer, err := store.GetByToken(ctx, "first-token"); err != nil || consumer != nil {
+		t.Errorf("GetByToken() = consumer(%s), %v, want none for the previous token", nameOf(consumer), err)
+	}
+
+	if err = store.Remove(ctx, "stored"); err != nil {
+		t.Fatalf("removing consumer encountered error: %v", err)
+	}
+	// the consumers found in redis are kept for lookupTTL
+	if consumer, err := a.Authenticate(ctx, "second-token"); err != nil || nameOf(consumer) != "stored" {
+		t.Errorf("Authenticate() = consumer(%s), %v, want the kept consumer", nameOf(consumer), err)
+	}
+	a.mu.Lock()
+	for k, c := range a.cached {
+		c.expiresAt = time.Now().Add(-time.Second)
+		a.cached[k] = c
+	}
+	a.mu.Unlock()
+	if _, err = a.Authenticate(ctx, "second-token"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Authenticate() error = %v, want ErrUnauthenticated after the consumer is removed", err)
+	}
+}
+
+// allowAll allows every channel and playlist
+type allowAll struct{}
+
+func (allowAll) ValidateChannelID(string) bool                    { return true }
+func (allowAll) ValidatePlaylistIDs(context.Context, string) bool { return true }
+func (allowAll) ValidateParameters(string, ytrelay.Options) error { return nil }
+
+func TestConsumerWhitelist(t *testing.T) {
+	restricted := &Consumer{Name: "narrow", Whitelists: &config.ConsumerWhitelists{ChannelIDs: map[string]bool{"UC-a": true}}}
+	ctx := WithConsumer(context.Background(), restricted)
+
+	whitelist := Whitelist(ctx, allowAll{})
+	if !whitelist.ValidateChannelID("UC-a") || whitelist.ValidateChannelID("UC-b") {
+		t.Error("whitelist of the consumer should only allow UC-a")
+	}
+	// the empty playlist whitelist of the consumer doesn't restrict
+	if !whitelist.ValidatePlaylistIDs(ctx, "PL-a") {
+		t.Error("whitelist of the consumer should allow the playlists of the tenant")
+	}
+	if got := CacheNamespace(ctx, "app"); got != "app:consumer:narrow" {
+		t.Errorf("CacheNamespace() = %s, want app:consumer:narrow", got)
+	}
+
+	unrestricted := WithConsumer(context.Background(), &Consumer{Name: "web"})
+	if _, ok := Whitelist(unrestricted, allowAll{}).(allowAll); !ok {
+		t.Error("whitelist of the tenant should be used for the consumer without whitelists")
+	}
+	if got := CacheNamespace(unrestricted, "app"); got != "app" {
+		t.Errorf("CacheNamespace() = %s, want the namespace of the tenant", got)
+	}
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/pkg/errors"
+)
+
+// jwtVerifier verifies the signature and the registered claims of JWTs
+type jwtVerifier struct {
+	conf config.JWTAuth
+	key  interface{}
+}
+
+func newJWTVerifier(conf config.JWTAuth) (*jwtVerifier, error) {
+	v := &jwtVerifier{conf: conf}
+	if conf.Secret != "" {
+		v.key = []byte(conf.Secret)
+		return v, nil
+	}
+
+	pem, err := ioutil.ReadFile(conf.PublicKeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the public key of jwt encountered error")
+	}
+	if v.key, err = jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return v, nil
+	}
+	if v.key, err = jwt.ParseECPublicKeyFromPEM(pem); err == nil {
+		return v, nil
+	}
+	return nil, fmt.Errorf("public key(%s) of jwt is neither a RSA nor an ECDSA key", conf.PublicKeyFile)
+}
+
+// keyFunc only accepts the signing methods of the key, so a token signed with HMAC can't be verified by a public key
+func (v *jwtVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if _, ok := v.key.([]byte); ok {
+			return v.key, nil
+		}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if v.conf.Secret == "" {
+			return v.key, nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if v.conf.Secret == "" {
+			return v.key, nil
+		}
+	}
+	return nil, fmt.Errorf("signing method(%s) is not accepted", token.Method.Alg())
+}
+
+// subject verifies the token and returns the sub claim
+func (v *jwtVerifier) subject(raw string) (string, error) {
+	var claims jwt.RegisteredClaims
+	if _, err := jwt.ParseWithClaims(raw, &claims, v.keyFunc); err != nil {
+		return "", err
+	}
+	if v.conf.Issuer != "" && !claims.VerifyIssuer(v.conf.Issuer, true) {
+		return "", fmt.Errorf("issuer(%s) is not accepted", claims.Issuer)
+	}
+	if v.conf.Audience != "" && !claims.VerifyAudience(v.conf.Audience, true) {
+		return "", fmt.Errorf("audience(%v) is not accepted", claims.Audience)
+	}
+	if claims.Subject == "" {
+		return "", errors.New("sub claim is empty")
+	}
+	return claims.Subject, nil
+}
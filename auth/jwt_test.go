@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/mirror-media/yt-relay/config"
+)
+
+const jwtSecret = "jwt-secret"
+
+// publicKeyFile writes the public key in PEM to a file and returns its path and content
+func publicKeyFile(t *testing.T, key interface{}) (string, []byte) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("marshalling public key encountered error: %v", err)
+	}
+	body := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	path := filepath.Join(t.TempDir(), "public.pem")
+	if err = ioutil.WriteFile(path, body, 0600); err != nil {
+		t.Fatalf("writing public key encountered error: %v", err)
+	}
+	return path, body
+}
+
+// sign signs the claims, which are the subject web of the next hour by default
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims *jwt.RegisteredClaims) string {
+	t.Helper()
+	if claims == nil {
+		claims = &jwt.RegisteredClaims{Subject: "web", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+	}
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token encountered error: %v", err)
+	}
+	return token
+}
+
+func TestJWTVerifierPinsAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating rsa key encountered error: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating ec key encountered error: %v", err)
+	}
+	rsaFile, rsaPEM := publicKeyFile(t, &rsaKey.PublicKey)
+	ecFile, ecPEM := publicKeyFile(t, &ecKey.PublicKey)
+
+	hmac := config.JWTAuth{Secret: jwtSecret}
+	rsaConf := config.JWTAuth{PublicKeyFile: rsaFile}
+	ecConf := config.JWTAuth{PublicKeyFile: ecFile}
+	tests := []struct {
+		name       string
+		conf       config.JWTAuth
+		token      string
+		isRejected bool
+	}{
+		{name: "HMAC", conf: hmac, token: sign(t, jwt.SigningMethodHS256, []byte(jwtSecret), nil)},
+		{name: "HMAC with another secret", conf: hmac, token: sign(t, jwt.SigningMethodHS256, []byte("other"), nil), isRejected: true},
+		{name: "RSA to the secret", conf: hmac, token: sign(t, jwt.SigningMethodRS256, rsaKey, nil), isRejected: true},
+		{name: "RSA", conf: rsaConf, token: sign(t, jwt.SigningMethodRS256, rsaKey, nil)},
+		{name: "RSA-PSS", conf: rsaConf, token: sign(t, jwt.SigningMethodPS256, rsaKey, nil)},
+		{name: "HMAC signed with the RSA public key", conf: rsaConf, token: sign(t, jwt.SigningMethodHS256, rsaPEM, nil), isRejected: true},
+		{name: "ECDSA to the RSA key", conf: rsaConf, token: sign(t, jwt.SigningMethodES256, ecKey, nil), isRejected: true},
+		{name: "ECDSA", conf: ecConf, token: sign(t, jwt.SigningMethodES256, ecKey, nil)},
+		{name: "HMAC signed with the EC public key", conf: ecConf, token: sign(t, jwt.SigningMethodHS256, ecPEM, nil), isRejected: true},
+		{name: "none", conf: hmac, token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, nil), isRejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := newJWTVerifier(tt.conf)
+			if err != nil {
+				t.Fatalf("creating verifier encountered error: %v", err)
+			}
+			subject, err := v.subject(tt.token)
+			if tt.isRejected {
+				if err == nil {
+					t.Errorf("subject() accepted the token of %s", subject)
+				}
+				return
+			}
+			if err != nil || subject != "web" {
+				t.Errorf("subject() = %s, %v, want web", subject, err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierClaims(t *testing.T) {
+	v, err := newJWTVerifier(config.JWTAuth{Secret: jwtSecret, Issuer: "issuer", Audience: "relay"})
+	if err != nil {
+		t.Fatalf("creating verifier encountered error: %v", err)
+	}
+	expiresAt := jwt.NewNumericDate(time.Now().Add(time.Hour))
+	tests := []struct {
+		name       string
+		claims     jwt.RegisteredClaims
+		isRejected bool
+	}{
+		{name: "accepted", claims: jwt.RegisteredClaims{Subject: "web", Issuer: "issuer", Audience: jwt.ClaimStrings{"other", "relay"}, ExpiresAt: expiresAt}},
+		{name: "another issuer", claims: jwt.RegisteredClaims{Subject: "web", Issuer: "other", Audience: jwt.ClaimStrings{"relay"}, ExpiresAt: expiresAt}, isRejected: true},
+		{name: "no issuer", claims: jwt.RegisteredClaims{Subject: "web", Audience: jwt.ClaimStrings{"relay"}, ExpiresAt: expiresAt}, isRejected: true},
+		{name: "another audience", claims: jwt.RegisteredClaims{Subject: "web", Issuer: "issuer", Audience: jwt.ClaimStrings{"other"}, ExpiresAt: expiresAt}, isRejected: true},
+		{name: "expired", claims: jwt.RegisteredClaims{Subject: "web", Issuer: "issuer", Audience: jwt.ClaimStrings{"relay"}, ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))}, isRejected: true},
+		{name: "no subject", claims: jwt.RegisteredClaims{Issuer: "issuer", Audience: jwt.ClaimStrings{"relay"}, ExpiresAt: expiresAt}, isRejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := v.subject(sign(t, jwt.SigningMethodHS256, []byte(jwtSecret), &tt.claims))
+			if tt.isRejected != (err != nil) || (!tt.isRejected && subject != "web") {
+				t.Errorf("subject() = %s, %v, want rejected(%v)", subject, err, tt.isRejected)
+			}
+		})
+	}
+}
+
+func TestNewJWTVerifierRejectsMalformedKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "public.pem")
+	if err := ioutil.WriteFile(path, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("writing public key encountered error: %v", err)
+	}
+	if _, err := newJWTVerifier(config.JWTAuth{PublicKeyFile: path}); err == nil {
+		t.Error("newJWTVerifier accepted a malformed public key")
+	}
+	if _, err := newJWTVerifier(config.JWTAuth{PublicKeyFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("newJWTVerifier accepted a missing public key")
+	}
+}
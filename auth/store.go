@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/pkg/errors"
+)
+
+// HashToken returns the hex encoded sha256 of the token, so the tokens are not stored in plain text
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Key returns the key of the consumer in the store
+func Key(namespace, name string) string {
+	return fmt.Sprintf("%s:consumer:%s", namespace, name)
+}
+
+// TokenKey returns the key of the index from the hashed token to the consumer name
+func TokenKey(namespace, token string) string {
+	return tokenHashKey(namespace, HashToken(token))
+}
+
+func tokenHashKey(namespace, tokenHash string) string {
+	return fmt.Sprintf("%s:consumer-token:%s", namespace, tokenHash)
+}
+
+type storedConsumer struct {
+	Consumer
+	TokenHash string `json:"tokenHash,omitempty"`
+}
+
+// Store manages the consumers in the cache provider
+type Store struct {
+	namespace string
+	provider  cache.Provider
+}
+
+func NewStore(namespace string, provider cache.Provider) *Store {
+	return &Store{namespace: namespace, provider: provider}
+}
+
+func (s *Store) get(ctx context.Context, name string) (*storedConsumer, error) {
+	value, err := s.provider.Get(ctx, Key(s.namespace, name))
+	if err == cache.ErrCacheMiss {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "getting consumer(%s) encountered error", name)
+	}
+	var stored storedConsumer
+	if err = json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, errors.Wrapf(err, "unmarshalling consumer(%s) encountered error", name)
+	}
+	stored.Name = name
+	return &stored, nil
+}
+
+// Get returns the consumer, or nil if it's not present
+func (s *Store) Get(ctx context.Context, name string) (*Consumer, error) {
+	stored, err := s.get(ctx, name)
+	if stored == nil || err != nil {
+		return nil, err
+	}
+	return &stored.Consumer, nil
+}
+
+// GetByToken returns the consumer of the api token, or nil if it's not present
+func (s *Store) GetByToken(ctx context.Context, token string) (*Consumer, error) {
+	name, err := s.provider.Get(ctx, TokenKey(s.namespace, token))
+	if err == cache.ErrCacheMiss {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "getting the consumer of token encountered error")
+	}
+	stored, err := s.get(ctx, name)
+	// the index may be left behind after the token is rotated
+	if stored == nil || err != nil || stored.TokenHash != HashToken(token) {
+		return nil, err
+	}
+	return &stored.Consumer, nil
+}
+
+// Put adds or updates the consumer. The previous token stops working if token is changed, and the consumer can only authenticate with JWTs if token is empty.
+func (s *Store) Put(ctx context.Context, consumer Consumer, token string) error {
+	previous, err := s.get(ctx, consumer.Name)
+	if err != nil {
+		return err
+	}
+	stored := storedConsumer{Consumer: consumer}
+	if token != "" {
+		stored.TokenHash = HashToken(token)
+	}
+	value, err := json.Marshal(stored)
+	if err != nil {
+		return errors.Wrapf(err, "marshalling consumer(%s) encountered error", consumer.Name)
+	}
+	if err = s.provider.Set(ctx, Key(s.namespace, consumer.Name), string(value), 0); err != nil {
+		return errors.Wrapf(err, "storing consumer(%s) encountered error", consumer.Name)
+	}
+	if token != "" {
+		if err = s.provider.Set(ctx, TokenKey(s.namespace, token), consumer.Name, 0); err != nil {
+			return errors.Wrapf(err, "storing the token of consumer(%s) encountered error", consumer.Name)
+		}
+	}
+	if previous != nil && previous.TokenHash != "" && previous.TokenHash != stored.TokenHash {
+		if err = s.provider.Delete(ctx, tokenHashKey(s.namespace, previous.TokenHash)); err != nil {
+			return errors.Wrapf(err, "removing the previous token of consumer(%s) encountered error", consumer.Name)
+		}
+	}
+	return nil
+}
+
+// Remove removes the consumer and its token
+func (s *Store) Remove(ctx context.Context, name string) error {
+	previous, err := s.get(ctx, name)
+	if previous == nil || err != nil {
+		return err
+	}
+	keys := []string{Key(s.namespace, name)}
+	if previous.TokenHash != "" {
+		keys = append(keys, tokenHashKey(s.namespace, previous.TokenHash))
+	}
+	return errors.Wrapf(s.provider.Delete(ctx, keys...), "removing consumer(%s) encountered error", name)
+}
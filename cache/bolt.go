@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("cache")
+
+// expiryLength is the length of the unix nano expiry prepended to every value
+const expiryLength = 8
+
+const sweepInterval = time.Minute
+
+// boltStore implements Provider with an embedded bbolt database for single node deployments
+type boltStore struct {
+	db   *bolt.DB
+	done chan struct{}
+}
+
+// NewBolt opens, or creates, the bbolt database at path and starts to sweep the expired keys periodically
+func NewBolt(path string) (Provider, error) {
+	if path == "" {
+		return nil, errors.New("path of the embedded store cannot be empty")
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening embedded store at %s encountered error", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "creating bucket for embedded store encountered error")
+	}
+
+	s := &boltStore{
+		db:   db,
+		done: make(chan struct{}),
+	}
+	go s.sweep()
+	return s, nil
+}
+
+func (s *boltStore) Get(ctx context.Context, key string) (value string, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltBucket).Get([]byte(key))
+		if v == nil || isExpired(v, time.Now()) {
+			return ErrCacheMiss
+		}
+		value = string(v[expiryLength:])
+		return nil
+	})
+	return value, err
+}
+
+func (s *boltStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	v := encode(value, ttl)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), v)
+	})
+}
+
+func (s *boltStore) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (isSet bool, err error) {
+	v := encode(value, ttl)
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltBucket)
+		if current := b.Get([]byte(key)); current != nil && !isExpired(current, time.Now()) {
+			return nil
+		}
+		isSet = true
+		return b.Put([]byte(key), v)
+	})
+	return isSet && err == nil, err
+}
+
+// encode prepends the expiry of the ttl to the value, which is zero if the value won't expire
+func encode(value string, ttl time.Duration) []byte {
+	v := make([]byte, expiryLength+len(value))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(v, uint64(time.Now().Add(ttl).UnixNano()))
+	}
+	copy(v[expiryLength:], value)
+	return v
+}
+
+func (s *boltStore) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (value int64, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltBucket)
+		v := b.Get([]byte(key))
+		isLive := v != nil && !isExpired(v, time.Now())
+		if isLive {
+			current, err := strconv.ParseInt(string(v[expiryLength:]), 10, 64)
+			if err != nil {
+				return errors.Wrapf(err, "value of key(%s) is not an integer", key)
+			}
+			value = current
+		}
+		value += n
+
+		nv := make([]byte, expiryLength, expiryLength+20)
+		if ttl > 0 {
+			binary.BigEndian.PutUint64(nv, uint64(time.Now().Add(ttl).UnixNano()))
+		} else if isLive {
+			// keep the expiry like redis does for INCRBY
+			copy(nv, v[:expiryLength])
+		}
+		nv = strconv.AppendInt(nv, value, 10)
+		return b.Put([]byte(key), nv)
+	})
+	return value, err
+}
+
+func (s *boltStore) Delete(ctx context.Context, keys ...string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltBucket)
+		for _, key := range keys {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Scan(ctx context.Context, match string) ([]string, error) {
+	re, err := globToRegexp(match)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	now := time.Now()
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			if !isExpired(v, now) && re.Match(k) {
+				keys = append(keys, string(k))
+			}
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// Close stops sweeping and closes the database
+func (s *boltStore) Close() error {
+	close(s.done)
+	return s.db.Close()
+}
+
+func (s *boltStore) sweep() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			err := s.db.Update(func(tx *bolt.Tx) error {
+				c := tx.Bucket(boltBucket).Cursor()
+				for k, v := c.First(); k != nil; k, v = c.Next() {
+					if isExpired(v, now) {
+						if err := c.Delete(); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				log.Errorf("sweeping expired keys in embedded store encountered error: %v", err)
+			}
+		}
+	}
+}
+
+func isExpired(v []byte, now time.Time) bool {
+	if len(v) < expiryLength {
+		return true
+	}
+	expiry := binary.BigEndian.Uint64(v[:expiryLength])
+	return expiry != 0 && int64(expiry) <= now.UnixNano()
+}
+
+// globToRegexp converts the redis style glob pattern, which supports *, ?, [...] and escaping, to a regular expression
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta(pattern[i:]))
+				i = len(pattern)
+				break
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "^") {
+				class = "^" + regexp.QuoteMeta(class[1:])
+			} else {
+				class = regexp.QuoteMeta(class)
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			} else {
+				b.WriteString(`\\`)
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	return re, errors.Wrapf(err, "pattern(%s) is invalid", pattern)
+}
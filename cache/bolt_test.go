@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestBolt(t *testing.T) Provider {
+	t.Helper()
+	store, err := NewBolt(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("opening embedded store encountered error: %v", err)
+	}
+	t.Cleanup(func() { _ = store.(io.Closer).Close() })
+	return store
+}
+
+func TestBoltGetSet(t *testing.T) {
+	ctx := context.Background()
+	store := newTestBolt(t)
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("Get(missing) error = %v, want ErrCacheMiss", err)
+	}
+	if err := store.Set(ctx, "key", "value", 0); err != nil {
+		t.Fatalf("Set encountered error: %v", err)
+	}
+	if err := store.Set(ctx, "key", "overwritten", 0); err != nil {
+		t.Fatalf("Set encountered error: %v", err)
+	}
+	if value, err := store.Get(ctx, "key"); err != nil || value != "overwritten" {
+		t.Fatalf("Get(key) = %q, %v, want %q", value, err, "overwritten")
+	}
+
+	if err := store.Delete(ctx, "key", "missing"); err != nil {
+		t.Fatalf("Delete encountered error: %v", err)
+	}
+	if _, err := store.Get(ctx, "key"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("Get(key) after Delete error = %v, want ErrCacheMiss", err)
+	}
+}
+
+func TestBoltSetNX(t *testing.T) {
+	ctx := context.Background()
+	store := newTestBolt(t)
+
+	tests := []struct {
+		name   string
+		key    string
+		value  string
+		ttl    time.Duration
+		wait   time.Duration
+		isSet  bool
+		stored string
+	}{
+		{name: "absent key is set", key: "key", value: "first", isSet: true, stored: "first"},
+		{name: "present key is kept", key: "key", value: "second", isSet: false, stored: "first"},
+		{name: "expiring key is set", key: "expiring", value: "first", ttl: 10 * time.Millisecond, isSet: true, stored: "first"},
+		{name: "expired key is set", key: "expiring", value: "second", wait: 20 * time.Millisecond, isSet: true, stored: "second"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			time.Sleep(tt.wait)
+			isSet, err := store.SetNX(ctx, tt.key, tt.value, tt.ttl)
+			if err != nil {
+				t.Fatalf("SetNX encountered error: %v", err)
+			}
+			if isSet != tt.isSet {
+				t.Errorf("SetNX() = %v, want %v", isSet, tt.isSet)
+			}
+			if value, err := store.Get(ctx, tt.key); err != nil || value != tt.stored {
+				t.Errorf("Get(%s) = %q, %v, want %q", tt.key, value, err, tt.stored)
+			}
+		})
+	}
+}
+
+func TestBoltTTL(t *testing.T) {
+	ctx := context.Background()
+	store := newTestBolt(t)
+
+	if err := store.Set(ctx, "expiring", "value", 20*time.Millisecond); err != nil {
+		t.Fatalf("Set encountered error: %v", err)
+	}
+	if err := store.Set(ctx, "persistent", "value", 0); err != nil {
+		t.Fatalf("Set encountered error: %v", err)
+	}
+	if _, err := store.Get(ctx, "expiring"); err != nil {
+		t.Fatalf("Get(expiring) before expiry encountered error: %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := store.Get(ctx, "expiring"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Get(expiring) after expiry error = %v, want ErrCacheMiss", err)
+	}
+	if _, err := store.Get(ctx, "persistent"); err != nil {
+		t.Errorf("Get(persistent) encountered error: %v", err)
+	}
+}
+
+func TestBoltScan(t *testing.T) {
+	ctx := context.Background()
+	store := newTestBolt(t)
+
+	for key, ttl := range map[string]time.Duration{
+		"app:cache:/search":  0,
+		"app:cache:/videos":  0,
+		"app:stale:/search":  0,
+		"other:cache:/a":     0,
+		"app:cache:/expired": time.Nanosecond,
+	} {
+		if err := store.Set(ctx, key, "value", ttl); err != nil {
+			t.Fatalf("Set(%s) encountered error: %v", key, err)
+		}
+	}
+	time.Sleep(time.Millisecond)
+
+	tests := []struct {
+		match string
+		want  []string
+	}{
+		{match: "app:cache:*", want: []string{"app:cache:/search", "app:cache:/videos"}},
+		{match: "*:/search", want: []string{"app:cache:/search", "app:stale:/search"}},
+		{match: "app:[cs]?[ac]*:/search", want: []string{"app:cache:/search", "app:stale:/search"}},
+		{match: "none:*", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.match, func(t *testing.T) {
+			keys, err := store.Scan(ctx, tt.match)
+			if err != nil {
+				t.Fatalf("Scan encountered error: %v", err)
+			}
+			sort.Strings(keys)
+			if len(keys) != len(tt.want) {
+				t.Fatalf("Scan(%s) = %v, want %v", tt.match, keys, tt.want)
+			}
+			for i := range keys {
+				if keys[i] != tt.want[i] {
+					t.Fatalf("Scan(%s) = %v, want %v", tt.match, keys, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBoltIncrBy(t *testing.T) {
+	ctx := context.Background()
+	store := newTestBolt(t)
+
+	for _, step := range []struct{ n, want int64 }{{3, 3}, {2, 5}, {-1, 4}} {
+		value, err := store.IncrBy(ctx, "counter", step.n, 0)
+		if err != nil {
+			t.Fatalf("IncrBy encountered error: %v", err)
+		}
+		if value != step.want {
+			t.Errorf("IncrBy(%d) = %d, want %d", step.n, value, step.want)
+		}
+	}
+
+	if _, err := store.IncrBy(ctx, "expiring", 7, 20*time.Millisecond); err != nil {
+		t.Fatalf("IncrBy encountered error: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if value, err := store.IncrBy(ctx, "expiring", 1, 0); err != nil || value != 1 {
+		t.Errorf("IncrBy after expiry = %d, %v, want counted from zero", value, err)
+	}
+
+	if err := store.Set(ctx, "text", "value", 0); err != nil {
+		t.Fatalf("Set encountered error: %v", err)
+	}
+	if _, err := store.IncrBy(ctx, "text", 1, 0); err == nil {
+		t.Error("IncrBy of a non-integer value succeeded, want error")
+	}
+}
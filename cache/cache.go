@@ -4,17 +4,44 @@ package cache
 import (
 	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/metrics"
 )
 
 type HTTP struct {
-	StatusCode int    `json:"code"`
-	Response   []byte `json:"response"`
+	StatusCode int               `json:"code"`
+	Header     map[string]string `json:"header,omitempty"`
+	Response   []byte            `json:"response"`
+}
+
+// ErrCacheMiss is returned by Provider.Get when the key doesn't exist or has expired
+var ErrCacheMiss = errors.New("cache: key not found")
+
+// Provider is the backend-neutral interface of the cache. Values are stored as strings.
+type Provider interface {
+	Get(ctx context.Context, key string) (string, error)
+	// Set stores the value. Zero ttl means the key won't expire.
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	// SetNX stores the value only if the key doesn't exist or has expired, and reports whether it's stored
+	SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+	Delete(ctx context.Context, keys ...string) error
+	// Scan returns all the keys matching the glob-style pattern
+	Scan(ctx context.Context, match string) ([]string, error)
+	// IncrBy increments the integer value by n and returns the new value. A missing key is counted from zero.
+	// The ttl is renewed on every increment and zero ttl means the key won't expire.
+	IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+}
+
+// Notifier is implemented by the providers which are able to notify the changes of keys
+type Notifier interface {
+	// Notify sends the changed keys matching the glob-style pattern until ctx is done
+	Notify(ctx context.Context, match string) (<-chan string, error)
 }
 
 type Rediser interface {
@@ -24,6 +51,22 @@ type Rediser interface {
 
 	Get(ctx context.Context, key string) *redis.StringCmd
 	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	IncrBy(ctx context.Context, key string, value int64) *redis.IntCmd
+	Expire(ctx context.Context, key string, ttl time.Duration) *redis.BoolCmd
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+	PSubscribe(ctx context.Context, channels ...string) *redis.PubSub
+	Ping(ctx context.Context) *redis.StatusCmd
+}
+
+// Ping checks the connection to redis. Every master of a cluster is pinged, since the cluster client pings only one of them.
+func Ping(ctx context.Context, rdb Rediser) error {
+	if cluster, ok := rdb.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return client.Ping(ctx).Err()
+		})
+	}
+	return rdb.Ping(ctx).Err()
 }
 
 func GetCacheKey(namespace string, name string) (string, error) {
@@ -40,7 +83,86 @@ func GetCacheKey(namespace string, name string) (string, error) {
 	return fmt.Sprintf("%s:cache:%s", namespace, name), nil
 }
 
+// GetStaleCacheKey returns the key of the stale copy of the response, which outlives the cache
+func GetStaleCacheKey(namespace string, name string) (string, error) {
+	if namespace == "" {
+		return "", errors.New("namespace cannot be empty")
+	}
+	if name == "" {
+		return "", errors.New("key cannot be empty")
+	}
+	return fmt.Sprintf("%s:stale:%s", namespace, name), nil
+}
+
+// New creates the cache provider according to the backend in the cache configuration. rdb is used by the redis backend.
+func New(c config.Conf, rdb Rediser) (Provider, error) {
+	switch c.Cache.Backend {
+	case "", config.RedisBackend:
+		if rdb == nil {
+			return nil, errors.New("there's no redis client for the cache")
+		}
+		return NewRedisProvider(rdb), nil
+	case config.EmbeddedBackend:
+		if c.Cache.Embedded == nil {
+			return nil, errors.New("there's no embedded store configuration for the cache")
+		}
+		return NewBolt(c.Cache.Embedded.Path)
+	default:
+		return nil, fmt.Errorf("unsupported cache backend(%s)", c.Cache.Backend)
+	}
+}
+
+// Stores are the connections of the configuration shared by the server and the commands
+type Stores struct {
+	// Redis is nil if there is no redis configuration
+	Redis Rediser
+	// Cache is nil if the cache is disabled
+	Cache Provider
+	// Store keeps the states beyond the response cache, e.g. whitelists and quota. It's redis if available, or the cache otherwise.
+	Store Provider
+}
+
+// Open connects to redis and opens the cache of the configuration
+func Open(c config.Conf) (s *Stores, err error) {
+	s = &Stores{}
+	if c.Redis != nil {
+		if s.Redis, err = NewRedis(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.Cache.IsEnabled {
+		if s.Cache, err = New(c, s.Redis); err != nil {
+			_ = s.Close()
+			return nil, err
+		}
+	}
+	s.Store = s.Cache
+	if s.Redis != nil {
+		s.Store = NewRedisProvider(s.Redis)
+	}
+	return s, nil
+}
+
+// Close closes the cache and the redis client
+func (s *Stores) Close() error {
+	var err error
+	if closer, ok := s.Cache.(io.Closer); ok {
+		err = errors.Wrap(closer.Close(), "closing cache encountered error")
+	}
+	if closer, ok := s.Redis.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "closing redis encountered error")
+		}
+	}
+	return err
+}
+
 func NewRedis(c config.Conf) (rdb Rediser, err error) {
+	opt, err := newOptions(c.Redis)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot create redis options")
+	}
+
 	switch c.Redis.Type {
 	case config.Cluster:
 		cluster := c.Redis.Cluster
@@ -53,13 +175,15 @@ func NewRedis(c config.Conf) (rdb Rediser, err error) {
 		}
 		rdb = redis.NewClusterClient(&redis.ClusterOptions{
 			Addrs:        addrs,
+			Username:     cluster.Username,
 			Password:     cluster.Password,
-			PoolSize:     20,
-			MaxRetries:   0,
-			DialTimeout:  time.Second,
-			IdleTimeout:  10 * time.Second,
-			ReadTimeout:  time.Second,
-			WriteTimeout: time.Second,
+			PoolSize:     opt.PoolSize,
+			MaxRetries:   opt.MaxRetries,
+			DialTimeout:  opt.DialTimeout,
+			IdleTimeout:  opt.IdleTimeout,
+			ReadTimeout:  opt.ReadTimeout,
+			WriteTimeout: opt.WriteTimeout,
+			TLSConfig:    opt.TLSConfig,
 		})
 	case config.Single:
 		single := c.Redis.SingleInstance
@@ -69,10 +193,7 @@ func NewRedis(c config.Conf) (rdb Rediser, err error) {
 
 		addr := fmt.Sprintf("%s:%d", single.Instance.Addr, single.Instance.Port)
 
-		rdb = redis.NewClient(&redis.Options{
-			Addr:     addr,
-			Password: single.Password,
-		})
+		rdb = redis.NewClient(withNode(opt, addr, single.Username, single.Password))
 	case config.Sentinel:
 		sentinel := c.Redis.Sentinel
 		if len(sentinel.Addrs) == 0 {
@@ -84,14 +205,19 @@ func NewRedis(c config.Conf) (rdb Rediser, err error) {
 			addrs = append(addrs, fmt.Sprintf("%s:%d", a.Addr, a.Port))
 		}
 		rdb = redis.NewFailoverClient(&redis.FailoverOptions{
-			SentinelAddrs: addrs,
-			Password:      sentinel.Password,
-			PoolSize:      20,
-			MaxRetries:    0,
-			DialTimeout:   time.Second,
-			IdleTimeout:   10 * time.Second,
-			ReadTimeout:   time.Second,
-			WriteTimeout:  time.Second,
+			MasterName:       sentinel.MasterName,
+			SentinelAddrs:    addrs,
+			SentinelPassword: sentinel.SentinelPassword,
+			Username:         sentinel.Username,
+			Password:         sentinel.Password,
+			DB:               opt.DB,
+			PoolSize:         opt.PoolSize,
+			MaxRetries:       opt.MaxRetries,
+			DialTimeout:      opt.DialTimeout,
+			IdleTimeout:      opt.IdleTimeout,
+			ReadTimeout:      opt.ReadTimeout,
+			WriteTimeout:     opt.WriteTimeout,
+			TLSConfig:        opt.TLSConfig,
 		})
 	case config.Replica:
 		replica := c.Redis.Replica
@@ -101,12 +227,15 @@ func NewRedis(c config.Conf) (rdb Rediser, err error) {
 		if len(replica.SlaveAddrs) == 0 {
 			return nil, errors.New("there's no slave redis address provided")
 		}
-		if rdb, err = NewReplicaRedisService(replica.MasterAddrs, replica.SlaveAddrs, replica.Password); err != nil {
+		if rdb, err = NewReplicaRedisService(replica, opt); err != nil {
 			err = errors.Wrap(err, "Cannot create Replica type Redis service")
 			return nil, err
 		}
 	default:
 		return nil, fmt.Errorf("unsupported redis type(%s)", c.Redis.Type)
 	}
+	if hooker, ok := rdb.(interface{ AddHook(redis.Hook) }); ok {
+		hooker.AddHook(metrics.RedisHook{})
+	}
 	return rdb, nil
 }
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/pkg/errors"
+)
+
+// newOptions creates the options shared by every redis type from the configuration. Addr, Username and Password are left for the caller.
+func newOptions(c *config.RedisService) (*redis.Options, error) {
+	opt := &redis.Options{
+		PoolSize:     c.PoolSize,
+		MaxRetries:   c.MaxRetries,
+		DialTimeout:  c.DialTimeout,
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+		IdleTimeout:  c.IdleTimeout,
+		DB:           c.DB,
+	}
+	if opt.PoolSize == 0 {
+		opt.PoolSize = config.DefaultRedisPoolSize
+	}
+	// go-redis retries 3 times for zero, and -1 is how it disables retries
+	if opt.MaxRetries == 0 {
+		opt.MaxRetries = -1
+	}
+	if opt.DialTimeout == 0 {
+		opt.DialTimeout = config.DefaultRedisDialTimeout
+	}
+	if opt.ReadTimeout == 0 {
+		opt.ReadTimeout = config.DefaultRedisReadTimeout
+	}
+	if opt.WriteTimeout == 0 {
+		opt.WriteTimeout = config.DefaultRedisWriteTimeout
+	}
+	if opt.IdleTimeout == 0 {
+		opt.IdleTimeout = config.DefaultRedisIdleTimeout
+	}
+
+	if c.TLS != nil {
+		tlsConfig, err := newTLSConfig(c.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opt.TLSConfig = tlsConfig
+	}
+	return opt, nil
+}
+
+func newTLSConfig(c *config.RedisTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		ca, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading redis ca file(%s) encountered error", c.CAFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("there is no valid certificate in redis ca file(%s)", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading redis client certificate(%s) encountered error", c.CertFile)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// withNode copies the shared options for a node
+func withNode(opt *redis.Options, addr string, username string, password string) *redis.Options {
+	o := *opt
+	o.Addr = addr
+	o.Username = username
+	o.Password = password
+	return &o
+}
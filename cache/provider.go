@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+const scanCount = 100
+
+// redisProvider adapts a Rediser of any redis type to Provider
+type redisProvider struct {
+	rdb Rediser
+}
+
+// NewRedisProvider wraps the redis client with the backend-neutral Provider interface
+func NewRedisProvider(rdb Rediser) Provider {
+	return &redisProvider{rdb: rdb}
+}
+
+func (p *redisProvider) Get(ctx context.Context, key string) (string, error) {
+	result, err := p.rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ErrCacheMiss
+	}
+	return result, err
+}
+
+func (p *redisProvider) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return p.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+func (p *redisProvider) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	return p.rdb.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (p *redisProvider) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	// keys may locate in different slots in a cluster, so they are deleted one by one
+	if _, isCluster := p.rdb.(*redis.ClusterClient); isCluster {
+		for _, key := range keys {
+			if err := p.rdb.Del(ctx, key).Err(); err != nil {
+				return errors.Wrapf(err, "deleting key(%s) encountered error", key)
+			}
+		}
+		return nil
+	}
+	return p.rdb.Del(ctx, keys...).Err()
+}
+
+// incrByScript increments the counter and sets its ttl in milliseconds atomically, so the counter never outlives its ttl
+const incrByScript = `
+local value = redis.call("INCRBY", KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 then
+  redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return value
+`
+
+func (p *redisProvider) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	value, err := p.rdb.Eval(ctx, incrByScript, []string{key}, n, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, errors.Wrapf(err, "incrementing key(%s) encountered error", key)
+	}
+	return value, nil
+}
+
+func (p *redisProvider) Scan(ctx context.Context, match string) ([]string, error) {
+	cluster, isCluster := p.rdb.(*redis.ClusterClient)
+	if !isCluster {
+		return scanNode(ctx, p.rdb, match)
+	}
+
+	// SCAN only iterates one node, so every master in the cluster has to be scanned
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		nodeKeys, err := scanNode(ctx, client, match)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	})
+	return keys, err
+}
+
+// keyspacePrefix is the prefix of the keyspace notification channels of all databases
+const keyspacePrefix = "__keyspace@*__:"
+
+// Notify subscribes to the keyspace notifications, which require notify-keyspace-events to be enabled in redis.
+// For cluster, only the notifications of the subscribed node are received.
+func (p *redisProvider) Notify(ctx context.Context, match string) (<-chan string, error) {
+	pubsub := p.rdb.PSubscribe(ctx, keyspacePrefix+match)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, errors.Wrapf(err, "subscribing keyspace notifications for %s encountered error", match)
+	}
+
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				// the channel is __keyspace@<db>__:<key>
+				key := msg.Channel
+				if i := strings.Index(key, "__:"); i >= 0 {
+					key = key[i+len("__:"):]
+				}
+				select {
+				case keys <- key:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return keys, nil
+}
+
+type scanner interface {
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+}
+
+func scanNode(ctx context.Context, node scanner, match string) ([]string, error) {
+	var keys []string
+	var cursor uint64
+	for {
+		page, next, err := node.Scan(ctx, cursor, match, scanCount).Result()
+		if err != nil {
+			return nil, errors.Wrapf(err, "scanning keys matching %s encountered error", match)
+		}
+		keys = append(keys, page...)
+		if next == 0 {
+			return keys, nil
+		}
+		cursor = next
+	}
+}
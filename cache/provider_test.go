@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, Provider) {
+	t.Helper()
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("starting redis encountered error: %v", err)
+	}
+	t.Cleanup(server.Close)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return server, NewRedisProvider(rdb)
+}
+
+func TestRedisIncrBy(t *testing.T) {
+	ctx := context.Background()
+	server, provider := newTestRedis(t)
+
+	for _, step := range []struct{ n, want int64 }{{3, 3}, {2, 5}, {-1, 4}} {
+		value, err := provider.IncrBy(ctx, "counter", step.n, time.Minute)
+		if err != nil {
+			t.Fatalf("IncrBy encountered error: %v", err)
+		}
+		if value != step.want {
+			t.Errorf("IncrBy(%d) = %d, want %d", step.n, value, step.want)
+		}
+		if ttl := server.TTL("counter"); ttl != time.Minute {
+			t.Errorf("ttl of counter is %s, want %s", ttl, time.Minute)
+		}
+	}
+
+	server.FastForward(2 * time.Minute)
+	if value, err := provider.IncrBy(ctx, "counter", 1, time.Minute); err != nil || value != 1 {
+		t.Errorf("IncrBy after expiry = %d, %v, want counted from zero", value, err)
+	}
+
+	if _, err := provider.IncrBy(ctx, "persistent", 1, 0); err != nil {
+		t.Fatalf("IncrBy encountered error: %v", err)
+	}
+	if ttl := server.TTL("persistent"); ttl != 0 {
+		t.Errorf("ttl of persistent is %s, want none", ttl)
+	}
+}
+
+func TestRedisSetNX(t *testing.T) {
+	ctx := context.Background()
+	_, provider := newTestRedis(t)
+
+	if isSet, err := provider.SetNX(ctx, "key", "first", time.Minute); err != nil || !isSet {
+		t.Fatalf("SetNX of an absent key = %v, %v, want set", isSet, err)
+	}
+	if isSet, err := provider.SetNX(ctx, "key", "second", time.Minute); err != nil || isSet {
+		t.Fatalf("SetNX of a present key = %v, %v, want kept", isSet, err)
+	}
+	if value, err := provider.Get(ctx, "key"); err != nil || value != "first" {
+		t.Errorf("Get(key) = %q, %v, want first", value, err)
+	}
+}
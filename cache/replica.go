@@ -0,0 +1,325 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mirror-media/yt-relay/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	replicaHealthCheckInterval = 5 * time.Second
+	replicaHealthCheckTimeout  = time.Second
+)
+
+type replicaRole string
+
+const (
+	writerRole replicaRole = "writer"
+	readerRole replicaRole = "reader"
+)
+
+// NodeStats is the snapshot of the status of a redis node
+type NodeStats struct {
+	Addr      string    `json:"addr"`
+	Role      string    `json:"role"`
+	Healthy   bool      `json:"healthy"`
+	Requests  uint64    `json:"requests"`
+	Failures  uint64    `json:"failures"`
+	LastCheck time.Time `json:"lastCheck"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// StatsReporter is implemented by the redis clients which are able to report the status of each node
+type StatsReporter interface {
+	Stats() []NodeStats
+}
+
+type replicaNode struct {
+	addr     string
+	role     replicaRole
+	client   *redis.Client
+	healthy  int32
+	requests uint64
+	failures uint64
+
+	mu        sync.RWMutex
+	lastCheck time.Time
+	lastError string
+}
+
+func (n *replicaNode) isHealthy() bool {
+	return atomic.LoadInt32(&n.healthy) == 1
+}
+
+// record counts the request, and the failure if err is not a redis.Nil reply
+func (n *replicaNode) record(err error) {
+	atomic.AddUint64(&n.requests, 1)
+	if err != nil && err != redis.Nil {
+		atomic.AddUint64(&n.failures, 1)
+	}
+}
+
+func (n *replicaNode) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, replicaHealthCheckTimeout)
+	defer cancel()
+	err := n.client.Ping(ctx).Err()
+
+	n.mu.Lock()
+	n.lastCheck = time.Now()
+	if err != nil {
+		n.lastError = err.Error()
+	} else {
+		n.lastError = ""
+	}
+	n.mu.Unlock()
+
+	var healthy int32
+	if err == nil {
+		healthy = 1
+	}
+	if previous := atomic.SwapInt32(&n.healthy, healthy); previous != healthy {
+		if err != nil {
+			log.Errorf("redis %s(%s) is unhealthy: %v", n.role, n.addr, err)
+		} else {
+			log.Infof("redis %s(%s) is healthy again", n.role, n.addr)
+		}
+	}
+}
+
+func (n *replicaNode) stats() NodeStats {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return NodeStats{
+		Addr:      n.addr,
+		Role:      string(n.role),
+		Healthy:   n.isHealthy(),
+		Requests:  atomic.LoadUint64(&n.requests),
+		Failures:  atomic.LoadUint64(&n.failures),
+		LastCheck: n.lastCheck,
+		LastError: n.lastError,
+	}
+}
+
+// replicaTypeRedis implements Rediser. Writes go to the writers and reads go to the healthy readers in round robin.
+// Reads fall back to the writers when every reader is down.
+type replicaTypeRedis struct {
+	writeCount uint32
+	readCount  uint32
+	writers    []*replicaNode
+	readers    []*replicaNode
+	done       chan struct{}
+}
+
+// pick returns the next healthy node in round robin. If none of them is healthy, it returns nil.
+func pick(nodes []*replicaNode, count uint32) *replicaNode {
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[(int(count)+i)%len(nodes)]
+		if n.isHealthy() {
+			return n
+		}
+	}
+	return nil
+}
+
+func (r *replicaTypeRedis) writer() *replicaNode {
+	wc := atomic.AddUint32(&r.writeCount, 1)
+	if n := pick(r.writers, wc); n != nil {
+		return n
+	}
+	// let the request fail on the writer instead of dropping it silently
+	return r.writers[int(wc)%len(r.writers)]
+}
+
+func (r *replicaTypeRedis) reader() *replicaNode {
+	rc := atomic.AddUint32(&r.readCount, 1)
+	if n := pick(r.readers, rc); n != nil {
+		return n
+	}
+	if n := pick(r.writers, rc); n != nil {
+		return n
+	}
+	return r.readers[int(rc)%len(r.readers)]
+}
+
+func (r *replicaTypeRedis) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.StatusCmd {
+	n := r.writer()
+	cmd := n.client.Set(ctx, key, value, ttl)
+	n.record(cmd.Err())
+	return cmd
+}
+
+func (r *replicaTypeRedis) SetXX(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.BoolCmd {
+	n := r.writer()
+	cmd := n.client.SetXX(ctx, key, value, ttl)
+	n.record(cmd.Err())
+	return cmd
+}
+
+func (r *replicaTypeRedis) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.BoolCmd {
+	n := r.writer()
+	cmd := n.client.SetNX(ctx, key, value, ttl)
+	n.record(cmd.Err())
+	return cmd
+}
+
+func (r *replicaTypeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	n := r.reader()
+	cmd := n.client.Get(ctx, key)
+	n.record(cmd.Err())
+	return cmd
+}
+
+func (r *replicaTypeRedis) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	// cursors are only meaningful to the node which returns them, so scanning sticks to the first healthy reader
+	n := pick(r.readers, 0)
+	if n == nil {
+		n = r.writers[0]
+	}
+	cmd := n.client.Scan(ctx, cursor, match, count)
+	n.record(cmd.Err())
+	return cmd
+}
+
+func (r *replicaTypeRedis) PSubscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	// replicas publish the keyspace notifications of the replicated writes as well
+	return r.reader().client.PSubscribe(ctx, channels...)
+}
+
+func (r *replicaTypeRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	n := r.writer()
+	cmd := n.client.Del(ctx, keys...)
+	n.record(cmd.Err())
+	return cmd
+}
+
+func (r *replicaTypeRedis) IncrBy(ctx context.Context, key string, value int64) *redis.IntCmd {
+	n := r.writer()
+	cmd := n.client.IncrBy(ctx, key, value)
+	n.record(cmd.Err())
+	return cmd
+}
+
+func (r *replicaTypeRedis) Expire(ctx context.Context, key string, ttl time.Duration) *redis.BoolCmd {
+	n := r.writer()
+	cmd := n.client.Expire(ctx, key, ttl)
+	n.record(cmd.Err())
+	return cmd
+}
+
+// Eval runs the script on a writer because scripts may write
+func (r *replicaTypeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	n := r.writer()
+	cmd := n.client.Eval(ctx, script, keys, args...)
+	n.record(cmd.Err())
+	return cmd
+}
+
+// Ping pings a writer, which serves all the writes
+func (r *replicaTypeRedis) Ping(ctx context.Context) *redis.StatusCmd {
+	n := r.writer()
+	cmd := n.client.Ping(ctx)
+	n.record(cmd.Err())
+	return cmd
+}
+
+// AddHook adds the hook to the clients of every node
+func (r *replicaTypeRedis) AddHook(hook redis.Hook) {
+	for _, n := range r.nodes() {
+		n.client.AddHook(hook)
+	}
+}
+
+func (r *replicaTypeRedis) nodes() []*replicaNode {
+	nodes := make([]*replicaNode, 0, len(r.writers)+len(r.readers))
+	nodes = append(nodes, r.writers...)
+	return append(nodes, r.readers...)
+}
+
+// Stats reports the status of every writer and reader
+func (r *replicaTypeRedis) Stats() []NodeStats {
+	nodes := r.nodes()
+	stats := make([]NodeStats, 0, len(nodes))
+	for _, n := range nodes {
+		stats = append(stats, n.stats())
+	}
+	return stats
+}
+
+// Close stops the health check and closes the connections to every node
+func (r *replicaTypeRedis) Close() error {
+	close(r.done)
+	var err error
+	for _, n := range r.nodes() {
+		if e := n.client.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (r *replicaTypeRedis) checkHealth() {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for _, n := range r.nodes() {
+		wg.Add(1)
+		go func(n *replicaNode) {
+			defer wg.Done()
+			n.check(ctx)
+		}(n)
+	}
+	wg.Wait()
+}
+
+func (r *replicaTypeRedis) watchHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.checkHealth()
+		}
+	}
+}
+
+func newReplicaNode(a config.RedisAddress, role replicaRole, username string, password string, opt *redis.Options) *replicaNode {
+	addr := fmt.Sprintf("%s:%d", a.Addr, a.Port)
+	return &replicaNode{
+		addr:   addr,
+		role:   role,
+		client: redis.NewClient(withNode(opt, addr, username, password)),
+		// nodes are assumed to be healthy until the first check says otherwise
+		healthy: 1,
+	}
+}
+
+// NewReplicaRedisService creates the replica type redis client with the options shared by all nodes
+func NewReplicaRedisService(replica *config.RedisReplicaInstances, opt *redis.Options) (Rediser, error) {
+	if len(replica.MasterAddrs) == 0 || len(replica.SlaveAddrs) == 0 {
+		return nil, fmt.Errorf("replica redis needs at least one writer and one reader")
+	}
+	instance := replicaTypeRedis{
+		done: make(chan struct{}),
+	}
+	writers := make([]*replicaNode, 0, len(replica.MasterAddrs))
+	for _, a := range replica.MasterAddrs {
+		writers = append(writers, newReplicaNode(a, writerRole, replica.Username, replica.Password, opt))
+	}
+	instance.writers = writers
+	readers := make([]*replicaNode, 0, len(replica.SlaveAddrs))
+	for _, a := range replica.SlaveAddrs {
+		readers = append(readers, newReplicaNode(a, readerRole, replica.Username, replica.Password, opt))
+	}
+	instance.readers = readers
+
+	instance.checkHealth()
+	go instance.watchHealth(replicaHealthCheckInterval)
+	return &instance, nil
+}
@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mirror-media/yt-relay/auth"
+	ytcache "github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/cli"
+	"github.com/mirror-media/yt-relay/config"
+)
+
+var cacheFlags = []string{"config"}
+
+const usage = `Usage: yt-relay cache -config <file> <subcommand> [flags] [request uri]
+
+Subcommands:
+  get [-tenant <appName>] [-consumer <name>] [-stale] <request uri>
+  purge [-tenant <appName>] [-consumer <name>] <request uri>
+  purge [-tenant <appName>] [-consumer <name>] -all
+  stats [-tenant <appName>]
+
+The request uri is the path and the query of the cached request, e.g. "/youtube/v3/videos?part=snippet&id=videoID", without the path prefix of the tenant.
+The default tenant is used if -tenant is omitted, except for stats, which reports every tenant. -consumer selects the cache of a consumer with its own whitelists.
+`
+
+func printUsage() {
+	fmt.Fprint(os.Stderr, usage)
+}
+
+// namespaceOf returns the cache namespace of the tenant, or of the consumer of the tenant if consumer isn't empty
+func namespaceOf(tenant config.Tenant, consumer string) string {
+	ctx := context.Background()
+	if consumer != "" {
+		ctx = auth.WithConsumer(ctx, &auth.Consumer{Name: consumer, Whitelists: &config.ConsumerWhitelists{}})
+	}
+	return auth.CacheNamespace(ctx, tenant.AppName)
+}
+
+// patternsOf returns the patterns of the keys of the cache and of the stale copies in the namespaces of the tenant.
+// The namespaces of the consumers are included unless consumer is given.
+func patternsOf(tenant config.Tenant, consumer string) (cached []string, stale []string) {
+	namespace := namespaceOf(tenant, consumer)
+	cached = []string{namespace + ":cache:*"}
+	stale = []string{namespace + ":stale:*"}
+	if consumer == "" {
+		consumers := namespaceOf(tenant, "*")
+		cached = append(cached, consumers+":cache:*")
+		stale = append(stale, consumers+":stale:*")
+	}
+	return cached, stale
+}
+
+func scan(ctx context.Context, provider ytcache.Provider, patterns []string) ([]string, error) {
+	var keys []string
+	for _, pattern := range patterns {
+		matched, err := provider.Scan(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, matched...)
+	}
+	return keys, nil
+}
+
+func get(ctx context.Context, provider ytcache.Provider, namespace string, uri string, stale bool) error {
+	keyOf := ytcache.GetCacheKey
+	if stale {
+		keyOf = ytcache.GetStaleCacheKey
+	}
+	key, err := keyOf(namespace, uri)
+	if err != nil {
+		return err
+	}
+	value, err := provider.Get(ctx, key)
+	if err == ytcache.ErrCacheMiss {
+		return fmt.Errorf("%s is not cached", key)
+	} else if err != nil {
+		return err
+	}
+
+	var cached ytcache.HTTP
+	if err = json.Unmarshal([]byte(value), &cached); err != nil {
+		return fmt.Errorf("cache of %s is malformed: %v", key, err)
+	}
+	return cli.PrintJSON(map[string]interface{}{
+		"key":      key,
+		"code":     cached.StatusCode,
+		"header":   cached.Header,
+		"response": json.RawMessage(cached.Response),
+	})
+}
+
+func purge(ctx context.Context, provider ytcache.Provider, tenant config.Tenant, consumer string, uri string, all bool) error {
+	var keys []string
+	if all {
+		cached, stale := patternsOf(tenant, consumer)
+		var err error
+		if keys, err = scan(ctx, provider, append(cached, stale...)); err != nil {
+			return err
+		}
+	} else {
+		namespace := namespaceOf(tenant, consumer)
+		for _, keyOf := range []func(string, string) (string, error){ytcache.GetCacheKey, ytcache.GetStaleCacheKey} {
+			key, err := keyOf(namespace, uri)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > 0 {
+		if err := provider.Delete(ctx, keys...); err != nil {
+			return err
+		}
+	}
+	return cli.PrintJSON(map[string]interface{}{
+		"tenant": tenant.AppName,
+		"purged": keys,
+	})
+}
+
+type tenantStats struct {
+	Tenant string `json:"tenant"`
+	Cached int    `json:"cached"`
+	Stale  int    `json:"stale"`
+}
+
+func stats(ctx context.Context, stores *ytcache.Stores, cfg *config.Conf, tenants []config.Tenant) error {
+	result := struct {
+		Backend config.CacheBackend `json:"backend"`
+		Tenants []tenantStats       `json:"tenants"`
+		Nodes   []ytcache.NodeStats `json:"nodes,omitempty"`
+	}{Backend: cfg.Cache.Backend}
+	if result.Backend == "" {
+		result.Backend = config.RedisBackend
+	}
+
+	for _, tenant := range tenants {
+		cachedPatterns, stalePatterns := patternsOf(tenant, "")
+		cached, err := scan(ctx, stores.Cache, cachedPatterns)
+		if err != nil {
+			return err
+		}
+		stale, err := scan(ctx, stores.Cache, stalePatterns)
+		if err != nil {
+			return err
+		}
+		result.Tenants = append(result.Tenants, tenantStats{Tenant: tenant.AppName, Cached: len(cached), Stale: len(stale)})
+	}
+	if reporter, ok := stores.Redis.(ytcache.StatsReporter); ok && result.Backend == config.RedisBackend {
+		result.Nodes = reporter.Stats()
+	}
+	return cli.PrintJSON(result)
+}
+
+func cacheMain(args []string, c cli.Conf) (err error) {
+	cfg := c.CFG
+	if cfg == nil {
+		printUsage()
+		return errors.New("config file is nil")
+	}
+	if len(args) < 1 {
+		printUsage()
+		return errors.New("no cache subcommand was given")
+	}
+	if !cfg.Cache.IsEnabled {
+		return errors.New("cache is not enabled")
+	}
+	subcommand, args := args[0], args[1:]
+	fs := flag.NewFlagSet("cache "+subcommand, flag.ContinueOnError)
+	tenantName := fs.String("tenant", "", "app name of the tenant")
+	ctx := context.Background()
+
+	var run func(stores *ytcache.Stores, tenant config.Tenant) error
+	switch subcommand {
+	case "get":
+		consumer := fs.String("consumer", "", "name of the consumer with its own whitelists")
+		stale := fs.Bool("stale", false, "get the stale copy, which is served when the upstream fails")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() < 1 {
+			printUsage()
+			return errors.New("request uri is missing")
+		}
+		run = func(stores *ytcache.Stores, tenant config.Tenant) error {
+			return get(ctx, stores.Cache, namespaceOf(tenant, *consumer), fs.Arg(0), *stale)
+		}
+	case "purge":
+		consumer := fs.String("consumer", "", "name of the consumer with its own whitelists")
+		all := fs.Bool("all", false, "purge every cached response of the tenant")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() < 1 && !*all {
+			printUsage()
+			return errors.New("either request uri or -all is required")
+		}
+		run = func(stores *ytcache.Stores, tenant config.Tenant) error {
+			return purge(ctx, stores.Cache, tenant, *consumer, fs.Arg(0), *all)
+		}
+	case "stats":
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+	default:
+		printUsage()
+		return fmt.Errorf("cache subcommand(%s) is not defined", subcommand)
+	}
+
+	tenants := cfg.AllTenants()
+	if *tenantName != "" || run != nil {
+		tenant, found := cfg.FindTenant(*tenantName)
+		if !found {
+			return fmt.Errorf("tenant(%s) is not defined", *tenantName)
+		}
+		tenants = []config.Tenant{tenant}
+	}
+
+	stores, err := ytcache.Open(*cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := stores.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	if run == nil {
+		return stats(ctx, stores, cfg, tenants)
+	}
+	return run(stores, tenants[0])
+}
+
+var Command = &cli.Command{
+	Summary: "gets, purges, or counts the cached responses",
+	Usage:   usage,
+	Flags:   cacheFlags,
+	Main:    cacheMain,
+}
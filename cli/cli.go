@@ -6,24 +6,68 @@ import (
 	"fmt"
 	"log"
 	"os"
-
-	"github.com/mirror-media/yt-relay/config"
+	"sort"
 )
 
 type Command struct {
+	// Summary describes the command in the list of the commands
+	Summary string
+	// Usage is the help text of the command, which is followed by its flags
+	Usage string
 	// Flags to look up in the global table
 	Flags []string
+	// SetFlags registers the flags of the command itself. The subcommands parse their own flags instead.
+	SetFlags func(fs *flag.FlagSet)
 	// Main runs the command, args are the arguments after flags
 	Main func(args []string, c Conf) error
+	// ParseOnly parses the configuration without validating it, so the command can handle the invalid ones
+	ParseOnly bool
 }
 
-func Start(cmds map[string]*Command) error {
+// flagSet creates the flag set of the command with its flags in the global table, which are bound to c
+func (cmd *Command) flagSet(name string, c *Conf) *flag.FlagSet {
+	global := flag.NewFlagSet("yt-relay", flag.ContinueOnError)
+	registerFlags(c, global)
 
-	var ytrelayFlagSet = flag.NewFlagSet("ytrelay", flag.ExitOnError)
-	var c Conf
+	fs := flag.NewFlagSet("yt-relay "+name, flag.ContinueOnError)
+	for _, flagName := range cmd.Flags {
+		f := global.Lookup(flagName)
+		if f == nil {
+			panic(fmt.Sprintf("flag(%s) of command(%s) is not defined", flagName, name))
+		}
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	if cmd.SetFlags != nil {
+		cmd.SetFlags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), cmd.Usage)
+		if len(cmd.Flags) > 0 || cmd.SetFlags != nil {
+			fmt.Fprint(fs.Output(), "\nFlags:\n")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// printCommands prints the usage of yt-relay with the summaries of the commands
+func printCommands(cmds map[string]*Command) {
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprint(os.Stderr, "Usage: yt-relay <command> [flags] [arguments]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, cmds[name].Summary)
+	}
+	fmt.Fprint(os.Stderr, "\nRun \"yt-relay help <command>\" or \"yt-relay <command> -h\" for the usage and the flags of the command.\n")
+}
 
-	registerFlags(&c, ytrelayFlagSet)
+func Start(cmds map[string]*Command) error {
 
+	flag.Usage = func() { printCommands(cmds) }
 	flag.Parse()
 
 	if flag.NArg() < 1 {
@@ -35,25 +79,44 @@ func Start(cmds map[string]*Command) error {
 	// Get the command and arguments
 	cmdName := flag.Arg(0)
 	args := flag.Args()[1:]
+	if cmdName == "help" {
+		if len(args) > 0 {
+			if cmd, found := cmds[args[0]]; found {
+				cmd.flagSet(args[0], &Conf{}).Usage()
+				return nil
+			}
+		}
+		flag.Usage()
+		return nil
+	}
 	cmd, found := cmds[cmdName]
 	if !found {
 		fmt.Fprintf(os.Stderr, "Command %s is not defined.\n", cmdName)
+		flag.Usage()
 		return errors.New("undefined command")
 	}
 
 	// Parse the flag from the remaining arguments
-	_ = ytrelayFlagSet.Parse(args)
-	args = ytrelayFlagSet.Args()
+	var c Conf
+	fs := cmd.flagSet(cmdName, &c)
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	args = fs.Args()
+	c.setFlags = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { c.setFlags[f.Name] = true })
 
 	var err error
-	if c.ConfigFile != "" {
-		c.CFG, err = config.LoadFile(c.ConfigFile)
-		if err != nil {
-			log.Printf("Failed to load config file: %v", err)
-			return errors.New("failed to load config file")
-		}
-		c.CFG.Address = c.Address
-		c.CFG.Port = c.Port
+	if c.HasConfig() && cmd.ParseOnly {
+		c.CFG, err = c.Parse()
+	} else if c.HasConfig() {
+		c.CFG, err = c.Load()
+	}
+	if err != nil {
+		log.Printf("Failed to load config file: %v", err)
+		return errors.New("failed to load config file")
 	}
 
 	if err := cmd.Main(args, c); err != nil {
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"flag"
+	"os"
 
 	"github.com/mirror-media/yt-relay/config"
 )
@@ -11,10 +12,84 @@ type Conf struct {
 	ConfigFile string
 	Port       int
 	CFG        *config.Conf
+	// TLS overwrites the tls options of the configuration file if any of them is set
+	TLS config.TLS
+	// setFlags are the flags given on the command line, which take precedence over the environment and the file
+	setFlags map[string]bool
 }
 
 func registerFlags(c *Conf, f *flag.FlagSet) {
 	f.StringVar(&c.Address, "address", "0.0.0.0", "Address to bind")
 	f.StringVar(&c.ConfigFile, "config", "", "path to the configuration file")
 	f.IntVar(&c.Port, "port", 8080, "Port to bind")
+	f.StringVar(&c.TLS.CertFile, "tls-cert", "", "path to the tls certificate, which serves https")
+	f.StringVar(&c.TLS.KeyFile, "tls-key", "", "path to the tls key")
+	f.StringVar(&c.TLS.MinVersion, "tls-min-version", "", "minimum tls version, 1.2 or 1.3")
+	f.StringVar(&c.TLS.ClientCAFile, "tls-client-ca", "", "path to the ca of the client certificates, which enables mTLS")
+	f.IntVar(&c.TLS.HTTPPort, "http-port", 0, "port to serve the health checks and the metrics over plain http along with https")
+}
+
+// HasConfig reports if there is any configuration, either the file or the environment variables
+func (c Conf) HasConfig() bool {
+	return c.ConfigFile != "" || config.HasEnv(os.Environ())
+}
+
+// Parse parses the configuration file, which is optional with the environment variables, and overwrites it with the environment variables and then the flags without validating it
+func (c Conf) Parse() (*config.Conf, error) {
+	cfg := &config.Conf{}
+	if c.ConfigFile != "" {
+		var err error
+		if cfg, err = config.ParseFile(c.ConfigFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.ApplyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	// the defaults of the flags only fill the blanks
+	if c.setFlags["address"] || cfg.Address == "" {
+		cfg.Address = c.Address
+	}
+	if c.setFlags["port"] || cfg.Port == 0 {
+		cfg.Port = c.Port
+	}
+	c.applyTLS(cfg)
+	return cfg, nil
+}
+
+// Load parses and validates the configuration
+func (c Conf) Load() (*config.Conf, error) {
+	cfg, err := c.Parse()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyTLS overwrites the tls options of cfg with the flags which are set
+func (c *Conf) applyTLS(cfg *config.Conf) {
+	if c.TLS == (config.TLS{}) {
+		return
+	}
+	if cfg.TLS == nil {
+		cfg.TLS = &config.TLS{}
+	}
+	if c.TLS.CertFile != "" {
+		cfg.TLS.CertFile = c.TLS.CertFile
+	}
+	if c.TLS.KeyFile != "" {
+		cfg.TLS.KeyFile = c.TLS.KeyFile
+	}
+	if c.TLS.MinVersion != "" {
+		cfg.TLS.MinVersion = c.TLS.MinVersion
+	}
+	if c.TLS.ClientCAFile != "" {
+		cfg.TLS.ClientCAFile = c.TLS.ClientCAFile
+	}
+	if c.TLS.HTTPPort != 0 {
+		cfg.TLS.HTTPPort = c.TLS.HTTPPort
+	}
 }
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mirror-media/yt-relay/cli"
+	ytconfig "github.com/mirror-media/yt-relay/config"
+	"gopkg.in/yaml.v2"
+)
+
+var configFlags = []string{"config"}
+
+const usage = `Usage: yt-relay config [-config <file>] <subcommand>
+
+Subcommands:
+  print                prints the effective configuration with the secrets redacted
+  validate [-strict]   lists every error and warning of the configuration with its yaml path, and fails if there is any error, or any warning with -strict
+
+The configuration file is overwritten by the environment variables with the ` + ytconfig.EnvPrefix + ` prefix, which are overwritten by the flags.
+`
+
+func printUsage() {
+	fmt.Fprint(os.Stderr, usage)
+}
+
+// printConfig prints the redacted configuration as yaml
+func printConfig(cfg *ytconfig.Conf) error {
+	redacted, err := cfg.Redacted()
+	if err != nil {
+		return err
+	}
+	body, err := yaml.Marshal(redacted)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(body)
+	return err
+}
+
+// validateConfig prints the errors and the warnings of the configuration
+func validateConfig(cfg *ytconfig.Conf, strict bool) error {
+	warnings, err := cfg.Validate()
+	var errs []ytconfig.Problem
+	if invalid, ok := err.(*ytconfig.ValidationError); ok {
+		errs = invalid.Problems
+	} else if err != nil {
+		return err
+	}
+	for _, p := range errs {
+		fmt.Printf("error: %s\n", p)
+	}
+	for _, p := range warnings {
+		fmt.Printf("warning: %s\n", p)
+	}
+
+	if len(errs) > 0 || (strict && len(warnings) > 0) {
+		return fmt.Errorf("configuration has %d error(s) and %d warning(s)", len(errs), len(warnings))
+	}
+	fmt.Printf("configuration is valid with %d warning(s)\n", len(warnings))
+	return nil
+}
+
+func configMain(args []string, c cli.Conf) error {
+	if len(args) < 1 {
+		printUsage()
+		return errors.New("no config subcommand was given")
+	}
+
+	switch args[0] {
+	case "print":
+		if c.CFG == nil {
+			printUsage()
+			return errors.New("there is neither config file nor environment variables")
+		}
+		return printConfig(c.CFG)
+	case "validate":
+		fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+		strict := fs.Bool("strict", false, "fail on warnings as well")
+		if err := fs.Parse(args[1:]); err != nil {
+			printUsage()
+			return err
+		}
+		if c.CFG == nil {
+			printUsage()
+			return errors.New("there is neither config file nor environment variables")
+		}
+		return validateConfig(c.CFG, *strict)
+	default:
+		printUsage()
+		return fmt.Errorf("config subcommand(%s) is not defined", args[0])
+	}
+}
+
+var Command = &cli.Command{
+	Summary:   "prints or validates the configuration",
+	Usage:     usage,
+	Flags:     configFlags,
+	Main:      configMain,
+	ParseOnly: true,
+}
@@ -0,0 +1,15 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// PrintJSON prints v as indented JSON to stdout
+func PrintJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	// the request uris are easier to read without & escaped
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(v)
+}
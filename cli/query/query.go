@@ -0,0 +1,139 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gin-gonic/gin/binding"
+	ytrelay "github.com/mirror-media/yt-relay"
+	ytcache "github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/cli"
+	ytquota "github.com/mirror-media/yt-relay/quota"
+	"github.com/mirror-media/yt-relay/relay"
+	"github.com/mirror-media/yt-relay/whitelist"
+)
+
+var queryFlags = []string{"config"}
+
+var tenantName string
+
+func setFlags(fs *flag.FlagSet) {
+	fs.StringVar(&tenantName, "tenant", "", "app name of the tenant")
+}
+
+const usage = `Usage: yt-relay query -config <file> [-tenant <appName>] <search|videos|playlistItems> <parameters>...
+
+Calls YouTube with the api key of the tenant and prints the JSON response. The parameters are query strings,
+e.g. "part=snippet&id=videoID" or part=snippet id=videoID.
+The call bypasses the whitelists, the policies and the cache, but it's charged to the quota of the tenant.
+The fixtures of the upstream are recorded or replayed if they are configured.
+The default tenant is used if -tenant is omitted.
+`
+
+func printUsage() {
+	fmt.Fprint(os.Stderr, usage)
+}
+
+// routes maps the methods to the routes
+var routes = map[string]string{
+	"search":        whitelist.SearchRoute,
+	"videos":        whitelist.VideosRoute,
+	"playlistItems": whitelist.PlaylistItemsRoute,
+}
+
+// parseOptions binds the parameters to the options in the same way the routes bind the query
+func parseOptions(parameters []string) (ytrelay.Options, error) {
+	query := url.Values{}
+	for _, p := range parameters {
+		values, err := url.ParseQuery(p)
+		if err != nil {
+			return ytrelay.Options{}, fmt.Errorf("parameters(%s) are invalid: %v", p, err)
+		}
+		for k, v := range values {
+			query[k] = append(query[k], v...)
+		}
+	}
+	var options ytrelay.Options
+	err := binding.Query.Bind(&http.Request{URL: &url.URL{RawQuery: query.Encode()}}, &options)
+	return options, err
+}
+
+func queryMain(args []string, c cli.Conf) (err error) {
+	cfg := c.CFG
+	if cfg == nil {
+		printUsage()
+		return errors.New("config file is nil")
+	}
+	if len(args) < 1 {
+		printUsage()
+		return errors.New("method is missing")
+	}
+	route, found := routes[args[0]]
+	if !found {
+		printUsage()
+		return fmt.Errorf("method(%s) is not supported", args[0])
+	}
+	options, err := parseOptions(args[1:])
+	if err != nil {
+		return err
+	}
+	if options.Part == "" {
+		return errors.New("part cannot be empty")
+	}
+
+	tenant, found := cfg.FindTenant(tenantName)
+	if !found {
+		return fmt.Errorf("tenant(%s) is not defined", tenantName)
+	}
+	stores, err := ytcache.Open(*cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := stores.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Upstream.TimeoutOf(route))
+	defer cancel()
+	youtubeService, err := relay.NewUpstream(ctx, tenant.ApiKey, cfg.Upstream)
+	if err != nil {
+		return err
+	}
+	relayService := youtubeService
+	// the replayed fixtures cost no quota
+	if !cfg.Upstream.IsReplay() {
+		relayService = &ytquota.Relay{
+			VideoRelay: youtubeService,
+			Tracker:    ytquota.NewTracker(tenant.AppName, stores.Store, tenant.Quota.DailyBudget),
+		}
+	}
+
+	var resp interface{}
+	switch route {
+	case whitelist.SearchRoute:
+		resp, err = relayService.Search(ctx, options)
+	case whitelist.VideosRoute:
+		resp, err = relayService.ListByVideoIDs(ctx, options)
+	case whitelist.PlaylistItemsRoute:
+		resp, err = relayService.ListPlaylistVideos(ctx, options)
+	}
+	if err != nil {
+		return err
+	}
+	return cli.PrintJSON(resp)
+}
+
+var Command = &cli.Command{
+	Summary:  "calls YouTube with the api key of a tenant and prints the response",
+	Usage:    usage,
+	Flags:    queryFlags,
+	SetFlags: setFlags,
+	Main:     queryMain,
+}
@@ -0,0 +1,107 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	ytcache "github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/cli"
+	"github.com/mirror-media/yt-relay/config"
+	ytquota "github.com/mirror-media/yt-relay/quota"
+)
+
+var quotaFlags = []string{"config"}
+
+var (
+	tenantName string
+	day        string
+)
+
+func setFlags(fs *flag.FlagSet) {
+	fs.StringVar(&tenantName, "tenant", "", "app name of the tenant")
+	fs.StringVar(&day, "day", ytquota.Day(time.Now()), "quota day in YYYY-MM-DD")
+}
+
+const usage = `Usage: yt-relay quota -config <file> [-tenant <appName>] [-day <YYYY-MM-DD>]
+
+Shows the YouTube Data API units spent by the tenants on the day, which starts at midnight Pacific Time.
+Every tenant is shown if -tenant is omitted, and the day is today if -day is omitted.
+`
+
+func printUsage() {
+	fmt.Fprint(os.Stderr, usage)
+}
+
+type usageOfTenant struct {
+	Tenant string `json:"tenant"`
+	Day    string `json:"day"`
+	Used   int64  `json:"used"`
+	// Budget is zero if it's unlimited
+	Budget    int64  `json:"budget"`
+	Remaining *int64 `json:"remaining,omitempty"`
+}
+
+func quotaMain(args []string, c cli.Conf) (err error) {
+	cfg := c.CFG
+	if cfg == nil {
+		printUsage()
+		return errors.New("config file is nil")
+	}
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		return fmt.Errorf("day(%s) is not in YYYY-MM-DD", day)
+	}
+
+	tenants := cfg.AllTenants()
+	if tenantName != "" {
+		tenant, found := cfg.FindTenant(tenantName)
+		if !found {
+			return fmt.Errorf("tenant(%s) is not defined", tenantName)
+		}
+		tenants = []config.Tenant{tenant}
+	}
+
+	stores, err := ytcache.Open(*cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := stores.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	if stores.Store == nil {
+		return errors.New("quota is only counted in the memory of the server without redis or the cache")
+	}
+
+	ctx := context.Background()
+	usages := make([]usageOfTenant, 0, len(tenants))
+	for _, tenant := range tenants {
+		tracker := ytquota.NewTracker(tenant.AppName, stores.Store, tenant.Quota.DailyBudget)
+		used, err := tracker.UsageOf(ctx, day)
+		if err != nil {
+			return fmt.Errorf("getting quota usage of tenant(%s) encountered error: %v", tenant.AppName, err)
+		}
+		u := usageOfTenant{Tenant: tenant.AppName, Day: day, Used: used, Budget: tracker.Budget()}
+		if u.Budget > 0 {
+			remaining := u.Budget - used
+			if remaining < 0 {
+				remaining = 0
+			}
+			u.Remaining = &remaining
+		}
+		usages = append(usages, u)
+	}
+	return cli.PrintJSON(usages)
+}
+
+var Command = &cli.Command{
+	Summary:  "shows the quota spent by the tenants",
+	Usage:    usage,
+	Flags:    quotaFlags,
+	SetFlags: setFlags,
+	Main:     quotaMain,
+}
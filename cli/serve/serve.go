@@ -4,12 +4,15 @@ import (
 	"errors"
 
 	"github.com/mirror-media/yt-relay/cli"
-	"github.com/mirror-media/yt-relay/relay"
 	"github.com/mirror-media/yt-relay/server"
-	"github.com/mirror-media/yt-relay/server/route"
 )
 
-var serveFlags = []string{"address", "port", "config"}
+var serveFlags = []string{"address", "port", "config", "tls-cert", "tls-key", "tls-min-version", "tls-client-ca", "http-port"}
+
+const usage = `Usage: yt-relay serve [-config <file>] [flags]
+
+Serves the relay until SIGTERM or SIGINT. The configuration file is reloaded when it changes or on SIGHUP.
+`
 
 func serveMain(args []string, c cli.Conf) error {
 	cfg := c.CFG
@@ -17,18 +20,19 @@ func serveMain(args []string, c cli.Conf) error {
 		return errors.New("config file is nil")
 	}
 	server, err := server.New(*cfg)
-	if err != nil {
-		return nil
-	}
-
-	relayService, err := relay.New(cfg.ApiKey)
 	if err != nil {
 		return err
 	}
 
-	_ = route.Set(server.Engine, cfg.AppName, relayService, server.APIWhitelist, cfg.Cache, server.Cache)
+	// the reloaded configuration is overwritten by the same flags
+	server.WatchConfig(c.ConfigFile, c.Parse)
 
 	return server.Run()
 }
 
-var Command = &cli.Command{Flags: serveFlags, Main: serveMain}
+var Command = &cli.Command{
+	Summary: "serves the relay",
+	Usage:   usage,
+	Flags:   serveFlags,
+	Main:    serveMain,
+}
@@ -0,0 +1,87 @@
+package warm
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mirror-media/yt-relay/cli"
+	"github.com/mirror-media/yt-relay/server"
+)
+
+var warmFlags = []string{"config"}
+
+var (
+	tenantName string
+	token      string
+)
+
+func setFlags(fs *flag.FlagSet) {
+	fs.StringVar(&tenantName, "tenant", "", "app name of the tenant")
+	fs.StringVar(&token, "token", "", "api token or jwt of a consumer")
+}
+
+const usage = `Usage: yt-relay warm -config <file> [-tenant <appName>] [-token <token>]
+
+Requests the warmUp list of every tenant once, so the cache is filled before the consumers ask, e.g. from a cron job.
+The requests go through the routes of the tenants, so they are checked against the whitelists and charged to the quota.
+-tenant warms only the tenant, and -token authenticates the requests to the tenants which require authentication.
+`
+
+func printUsage() {
+	fmt.Fprint(os.Stderr, usage)
+}
+
+func warmMain(args []string, c cli.Conf) (err error) {
+	cfg := c.CFG
+	if cfg == nil {
+		printUsage()
+		return errors.New("config file is nil")
+	}
+	if tenantName != "" {
+		if _, found := cfg.FindTenant(tenantName); !found {
+			return fmt.Errorf("tenant(%s) is not defined", tenantName)
+		}
+	}
+	if !cfg.Cache.IsEnabled {
+		return errors.New("cache is not enabled")
+	}
+
+	// stdout is kept for the results
+	gin.DefaultWriter = os.Stderr
+	s, err := server.New(*cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := s.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	results := s.Warm(tenantName, token)
+	if err = cli.PrintJSON(results); err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Status != http.StatusOK {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d warm-up requests failed", failed, len(results))
+	}
+	return nil
+}
+
+var Command = &cli.Command{
+	Summary:  "requests the warm-up lists once to fill the cache",
+	Usage:    usage,
+	Flags:    warmFlags,
+	SetFlags: setFlags,
+	Main:     warmMain,
+}
@@ -0,0 +1,214 @@
+package whitelist
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/cli"
+	"github.com/mirror-media/yt-relay/config"
+	ytwhitelist "github.com/mirror-media/yt-relay/whitelist"
+)
+
+var whitelistFlags = []string{"config"}
+
+const usage = `Usage: yt-relay whitelist -config <file> <subcommand> [flags] <channel|playlist> [id]
+
+Subcommands:
+  add [-tenant <appName>] [-effective=true] [-note <note>] [-expires <duration|RFC3339>] [-actor <name>] <kind> <id>
+  remove [-tenant <appName>] [-actor <name>] <kind> <id>
+  list [-tenant <appName>] <kind>
+  check [-tenant <appName>] <kind> <id>
+
+The default tenant is used if -tenant is omitted.
+`
+
+func printUsage() {
+	fmt.Fprint(os.Stderr, usage)
+}
+
+func defaultActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+// parseExpiry accepts a duration from now or a RFC3339 time
+func parseExpiry(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		t := time.Now().Add(d)
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("expiry(%s) is neither a duration nor a RFC3339 time", s)
+	}
+	return &t, nil
+}
+
+func parseTarget(args []string, needID bool) (kind ytwhitelist.Kind, id string, err error) {
+	if len(args) < 1 || (needID && len(args) < 2) {
+		printUsage()
+		return "", "", errors.New("kind or id is missing")
+	}
+	if kind, err = ytwhitelist.ParseKind(args[0]); err != nil {
+		return "", "", err
+	}
+	if needID {
+		id = args[1]
+	}
+	return kind, id, nil
+}
+
+// newStore creates the whitelist store of the tenant in redis
+func newStore(cfg *config.Conf, tenantName string) (*ytwhitelist.Store, config.Tenant, error) {
+	tenant, found := cfg.FindTenant(tenantName)
+	if !found {
+		return nil, tenant, fmt.Errorf("tenant(%s) is not defined", tenantName)
+	}
+	if cfg.Redis == nil {
+		return nil, tenant, errors.New("whitelists can only be managed in redis but there is no redis configuration")
+	}
+	if !tenant.Whitelists.IsDynamic() || tenant.Whitelists.Source.Type != config.RedisWhitelist {
+		fmt.Fprintf(os.Stderr, "Warning: the whitelist source of tenant(%s) is not %s, so the changes won't take effect.\n", tenant.AppName, config.RedisWhitelist)
+	}
+
+	rdb, err := cache.NewRedis(*cfg)
+	if err != nil {
+		return nil, tenant, err
+	}
+	return ytwhitelist.NewStore(tenant.AppName, cache.NewRedisProvider(rdb)), tenant, nil
+}
+
+func whitelistMain(args []string, c cli.Conf) error {
+	cfg := c.CFG
+	if cfg == nil {
+		printUsage()
+		return errors.New("config file is nil")
+	}
+	if len(args) < 1 {
+		printUsage()
+		return errors.New("no whitelist subcommand was given")
+	}
+	subcommand, args := args[0], args[1:]
+	fs := flag.NewFlagSet("whitelist "+subcommand, flag.ContinueOnError)
+	tenantName := fs.String("tenant", "", "app name of the tenant")
+	ctx := context.Background()
+
+	switch subcommand {
+	case "add":
+		effective := fs.Bool("effective", true, "whether the entry is effective")
+		note := fs.String("note", "", "note of the entry")
+		expires := fs.String("expires", "", "expiry of the entry, in duration from now or RFC3339")
+		actor := fs.String("actor", defaultActor(), "operator recorded in the audit log")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		kind, id, err := parseTarget(fs.Args(), true)
+		if err != nil {
+			return err
+		}
+		store, _, err := newStore(cfg, *tenantName)
+		if err != nil {
+			return err
+		}
+		expiresAt, err := parseExpiry(*expires)
+		if err != nil {
+			return err
+		}
+		return store.Put(ctx, *actor, kind, id, ytwhitelist.Entry{
+			Effective: *effective,
+			Note:      *note,
+			ExpiresAt: expiresAt,
+		})
+	case "remove":
+		actor := fs.String("actor", defaultActor(), "operator recorded in the audit log")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		kind, id, err := parseTarget(fs.Args(), true)
+		if err != nil {
+			return err
+		}
+		store, _, err := newStore(cfg, *tenantName)
+		if err != nil {
+			return err
+		}
+		return store.Remove(ctx, *actor, kind, id)
+	case "list":
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		kind, _, err := parseTarget(fs.Args(), false)
+		if err != nil {
+			return err
+		}
+		store, _, err := newStore(cfg, *tenantName)
+		if err != nil {
+			return err
+		}
+		entries, err := store.List(ctx, kind)
+		if err != nil {
+			return err
+		}
+		return cli.PrintJSON(entries)
+	case "check":
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		kind, id, err := parseTarget(fs.Args(), true)
+		if err != nil {
+			return err
+		}
+		store, tenant, err := newStore(cfg, *tenantName)
+		if err != nil {
+			return err
+		}
+		entry, present, err := store.Get(ctx, kind, id)
+		if err != nil {
+			return err
+		}
+
+		// the entries in the store take precedence over the ones in the configuration
+		static := tenant.Whitelists.ChannelIDs
+		if kind == ytwhitelist.PlaylistKind {
+			static = tenant.Whitelists.PlaylistIDs
+		}
+		staticEffective, inConfig := static[id]
+		effective := staticEffective
+		if present {
+			effective = entry.IsEffective(time.Now())
+		}
+
+		result := map[string]interface{}{
+			"kind":      kind,
+			"id":        id,
+			"effective": effective,
+			"inConfig":  inConfig,
+			"inStore":   present,
+		}
+		if present {
+			result["entry"] = entry
+		}
+		return cli.PrintJSON(result)
+	default:
+		printUsage()
+		return fmt.Errorf("whitelist subcommand(%s) is not defined", subcommand)
+	}
+}
+
+var Command = &cli.Command{
+	Summary: "manages the whitelists stored in redis",
+	Usage:   usage,
+	Flags:   whitelistFlags,
+	Main:    whitelistMain,
+}
@@ -4,13 +4,25 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/mirror-media/yt-relay/cli"
+	"github.com/mirror-media/yt-relay/cli/cache"
+	"github.com/mirror-media/yt-relay/cli/config"
+	"github.com/mirror-media/yt-relay/cli/query"
+	"github.com/mirror-media/yt-relay/cli/quota"
 	"github.com/mirror-media/yt-relay/cli/serve"
+	"github.com/mirror-media/yt-relay/cli/warm"
+	"github.com/mirror-media/yt-relay/cli/whitelist"
 )
 
 func main() {
 
 	cmds := map[string]*cli.Command{
-		"serve": serve.Command,
+		"cache":     cache.Command,
+		"config":    config.Command,
+		"query":     query.Command,
+		"quota":     quota.Command,
+		"serve":     serve.Command,
+		"warm":      warm.Command,
+		"whitelist": whitelist.Command,
 	}
 
 	err := cli.Start(cmds)
@@ -1,9 +1,10 @@
 package config
 
 import (
+	"crypto/tls"
 	"errors"
 	"io/ioutil"
-	"regexp"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -11,28 +12,438 @@ import (
 )
 
 type Conf struct {
-	// AppName is only allowed tt have alphanumeric, dash, and comma.
-	AppName    string `yaml:"appName"`
-	Address    string
-	ApiKey     string `yaml:"apiKey"`
-	Cache      Cache  `yaml:"cache"`
-	Port       int
-	Redis      *RedisService `yaml:"redis"`
-	Whitelists Whitelists    `yaml:"whitelists"`
+	// Tenant is the default tenant, which serves the requests not matching the other tenants. It's optional if Tenants are defined.
+	Tenant  `yaml:",inline"`
+	Address string
+	Admin   *Admin `yaml:"admin"`
+	Cache   Cache  `yaml:"cache"`
+	Port    int
+	Redis   *RedisService `yaml:"redis"`
+	// Tenants are the additional apps served by the relay. They share the cache rules, the redis connection pool and the server.
+	Tenants []Tenant `yaml:"tenants"`
+	// Upstream bounds the calls to YouTube with timeouts
+	Upstream Upstream `yaml:"upstream"`
+	// Tracing exports the spans over OTLP. The traceparent header is propagated even if it's nil.
+	Tracing *Tracing `yaml:"tracing"`
+	// Health configures the readiness checks of /readyz
+	Health Health `yaml:"health"`
+	// Server configures the timeouts and limits of the http server
+	Server HTTPServer `yaml:"server"`
+	// TLS serves https instead of http if it's not nil
+	TLS *TLS `yaml:"tls"`
+
+	// unknownKeys are the keys of the parsed yaml matching no field, which are reported as warnings
+	unknownKeys []Problem
+}
+
+// TLS serves https and h2 with the certificate, which is reloaded when the files change
+type TLS struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// MinVersion is either 1.2 or 1.3. It's 1.2 if it's empty.
+	MinVersion string `yaml:"minVersion"`
+	// ClientCAFile requires and verifies the client certificates for mTLS
+	ClientCAFile string `yaml:"clientCaFile"`
+	// HTTPPort serves the health checks and the metrics over plain http. There is no plain http if it's zero.
+	HTTPPort int `yaml:"httpPort"`
+	// ReloadInterval is how often the files are checked for changes
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+}
+
+// TLSVersions are the supported minimum versions of TLS
+var TLSVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+const DefaultTLSReloadInterval = 10 * time.Second
+
+// HTTPServer configures the http server. Zero values fall back to the defaults.
+type HTTPServer struct {
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	// WriteTimeout should be longer than the upstream timeouts including the retries
+	WriteTimeout   time.Duration `yaml:"writeTimeout"`
+	IdleTimeout    time.Duration `yaml:"idleTimeout"`
+	MaxHeaderBytes int           `yaml:"maxHeaderBytes"`
+	// ShutdownTimeout bounds the drain of the in-flight requests on SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// TrustedProxies are the IPs or CIDRs of the proxies whose X-Forwarded-For and X-Real-IP are trusted for the client IP.
+	// The client IP is the address of the peer if it's empty.
+	TrustedProxies []string `yaml:"trustedProxies"`
+}
+
+const (
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultWriteTimeout      = 60 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+	DefaultMaxHeaderBytes    = 1 << 20
+	DefaultShutdownTimeout   = 30 * time.Second
+)
+
+// Health configures the readiness checks
+type Health struct {
+	// Timeout bounds every check
+	Timeout time.Duration `yaml:"timeout"`
+	// UpstreamProbe calls YouTube for readiness. The result is cached for its interval, so it costs a unit of quota per tenant per interval.
+	UpstreamProbe *UpstreamProbe `yaml:"upstreamProbe"`
+}
+
+// UpstreamProbe lists a video by id, which is the cheapest call of the YouTube Data API
+type UpstreamProbe struct {
+	Interval time.Duration `yaml:"interval"`
+	// VideoID doesn't have to exist, since the call succeeds with an empty list
+	VideoID string `yaml:"videoId"`
+}
+
+const (
+	DefaultHealthTimeout         = 2 * time.Second
+	DefaultUpstreamProbeInterval = 5 * time.Minute
+	DefaultUpstreamProbeVideoID  = "yt-relay-probe"
+)
+
+// Tracing exports the spans to an OpenTelemetry collector over OTLP/HTTP
+type Tracing struct {
+	// Endpoint is the host and port of the collector, e.g. localhost:4318
+	Endpoint string `yaml:"endpoint"`
+	// URLPath is /v1/traces if it's empty
+	URLPath string `yaml:"urlPath"`
+	// Insecure disables TLS to the collector
+	Insecure bool              `yaml:"insecure"`
+	Headers  map[string]string `yaml:"headers"`
+	// ServiceName is yt-relay if it's empty
+	ServiceName string `yaml:"serviceName"`
+	// SampleRatio is the ratio of the traces sampled when the parent isn't sampled remotely. Zero means every trace is sampled.
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+const DefaultTracingServiceName = "yt-relay"
+
+// Upstream configures the calls to YouTube
+type Upstream struct {
+	// Timeout is the default timeout of the upstream calls
+	Timeout time.Duration `yaml:"timeout"`
+	// Timeouts overwrite the default timeout for the routes, e.g. /youtube/v3/search
+	Timeouts map[string]time.Duration `yaml:"timeouts"`
+	// Retry retries the calls failed with server or connection errors. The calls are not retried if it's nil.
+	Retry *Retry `yaml:"retry"`
+	// CircuitBreaker fails the calls of an endpoint fast after consecutive failures. There is no circuit breaker if it's nil.
+	CircuitBreaker *CircuitBreaker `yaml:"circuitBreaker"`
+	// Fixtures records the responses of YouTube to files, or replays them without calling YouTube. YouTube is called as usual if it's nil.
+	Fixtures *Fixtures `yaml:"fixtures"`
+	// Endpoint is the base url of the YouTube Data API, e.g. of a fake server. googleapis.com is called if it's empty.
+	Endpoint string `yaml:"endpoint"`
+	// Feed serves the latest uploads of channels and playlists from the RSS feeds of YouTube, which cost no quota. Only the Data API is called if it's nil.
+	Feed *Feed `yaml:"feed"`
+}
+
+// DefaultFeedURL lists the uploads of a channel with channel_id, or of a playlist with playlist_id
+const DefaultFeedURL = "https://www.youtube.com/feeds/videos.xml"
+
+// Feed serves /search?channelId=...&order=date and /playlistItems from the Atom feeds, which have the latest 15 videos without pages
+type Feed struct {
+	Mode FeedMode `yaml:"mode"`
+	// URL is the url of the feeds, e.g. of a fake server. It's DefaultFeedURL if it's empty.
+	URL string `yaml:"url"`
+}
+
+type FeedMode string
+
+const (
+	// FallbackFeed serves the supported calls from the feeds when the quota of the Data API runs out
+	FallbackFeed FeedMode = "fallback"
+	// PrimaryFeed serves the supported calls from the feeds, and the Data API serves the others and the ones the feeds fail
+	PrimaryFeed FeedMode = "primary"
+)
+
+// IsReplay reports if the fixtures are replayed, so YouTube is never called and no api key or quota is spent
+func (u Upstream) IsReplay() bool {
+	return u.Fixtures != nil && u.Fixtures.Mode == ReplayFixtures
+}
+
+// Fixtures stores a file per call, keyed by the method and the normalized options
+type Fixtures struct {
+	Mode FixtureMode `yaml:"mode"`
+	Dir  string      `yaml:"dir"`
+}
+
+type FixtureMode string
+
+const (
+	// RecordFixtures calls YouTube and saves the responses, including the errors of YouTube
+	RecordFixtures FixtureMode = "record"
+	// ReplayFixtures serves only the saved responses and never calls YouTube
+	ReplayFixtures FixtureMode = "replay"
+)
+
+// Retry backs off exponentially with full jitter between the attempts. Zero values fall back to the defaults.
+type Retry struct {
+	// MaxAttempts includes the first call
+	MaxAttempts int           `yaml:"maxAttempts"`
+	BaseDelay   time.Duration `yaml:"baseDelay"`
+	MaxDelay    time.Duration `yaml:"maxDelay"`
+}
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 100 * time.Millisecond
+	DefaultRetryMaxDelay    = 2 * time.Second
+)
+
+// CircuitBreaker opens after FailureThreshold consecutive failures, and lets a call probe the endpoint after OpenTimeout. Zero values fall back to the defaults.
+type CircuitBreaker struct {
+	FailureThreshold int           `yaml:"failureThreshold"`
+	OpenTimeout      time.Duration `yaml:"openTimeout"`
+}
+
+const (
+	DefaultCircuitBreakerFailureThreshold = 5
+	DefaultCircuitBreakerOpenTimeout      = 30 * time.Second
+)
+
+const DefaultUpstreamTimeout = 10 * time.Second
+
+// TimeoutOf returns the timeout of the upstream calls of the route
+func (u Upstream) TimeoutOf(route string) time.Duration {
+	if timeout, ok := u.Timeouts[route]; ok && timeout > 0 {
+		return timeout
+	}
+	if u.Timeout > 0 {
+		return u.Timeout
+	}
+	return DefaultUpstreamTimeout
+}
+
+// Tenant is an app served by the relay with its own api key, whitelists, cache namespace and quota budget
+type Tenant struct {
+	// AppName is only allowed tt have alphanumeric, dash, and comma. It's also the namespace of the tenant in cache.
+	AppName string `yaml:"appName"`
+	ApiKey  string `yaml:"apiKey"`
+	// Policies restrict the parameters of the routes. The key is the route path, e.g. /youtube/v3/search.
+	Policies   map[string]RoutePolicy `yaml:"policies"`
+	Quota      Quota                  `yaml:"quota"`
+	Whitelists Whitelists             `yaml:"whitelists"`
+	// PathPrefix serves the tenant under the prefix, e.g. /brand/youtube/v3/search
+	PathPrefix string `yaml:"pathPrefix"`
+	// Hosts serve the tenant for requests with these Host headers
+	Hosts []string `yaml:"hosts"`
+	// Auth requires the consumers to authenticate. The relay is open to anyone if it's nil.
+	Auth *ClientAuth `yaml:"auth"`
+	// RateLimits are checked in order for every request to the YouTube routes
+	RateLimits []RateLimitRule `yaml:"rateLimits"`
+	// WarmUp are the request uris, e.g. /youtube/v3/videos?part=snippet&id=videoID, requested by the warm command to fill the cache
+	WarmUp []string `yaml:"warmUp"`
+}
+
+// ClientAuth requires the consumers of a tenant to authenticate with api tokens or signed JWTs
+type ClientAuth struct {
+	// Consumers are keyed by their names
+	Consumers map[string]Consumer `yaml:"consumers"`
+	// JWT accepts the JWTs signed by the key, and the consumer is named by the sub claim
+	JWT *JWTAuth `yaml:"jwt"`
+	// Redis looks up the consumers stored in redis as well. The consumers in the configuration take precedence.
+	Redis bool `yaml:"redis"`
+}
+
+// Consumer is a client of the relay
+type Consumer struct {
+	// Token is the api token of the consumer. Consumers without a token can only authenticate with JWTs.
+	Token string `yaml:"token"`
+	// Routes are the allowed routes, e.g. /youtube/v3/search. Empty means all the routes.
+	Routes []string `yaml:"routes"`
+	// Whitelists further restrict the whitelists of the tenant for the consumer
+	Whitelists *ConsumerWhitelists `yaml:"whitelists"`
+	// RateLimit limits the requests of the consumer. It's unlimited if it's nil.
+	RateLimit *RateLimit `yaml:"rateLimit"`
+	Disabled  bool       `yaml:"disabled"`
+}
+
+// ConsumerWhitelists are maps, key is the whitelist string, value determines if it should be effective. Empty map doesn't restrict.
+type ConsumerWhitelists struct {
+	ChannelIDs  map[string]bool `yaml:"channelIDs" json:"channelIDs,omitempty"`
+	PlaylistIDs map[string]bool `yaml:"playlistIDs" json:"playlistIDs,omitempty"`
+}
+
+// RateLimit allows Requests per Period
+type RateLimit struct {
+	Requests int64         `yaml:"requests" json:"requests"`
+	Period   time.Duration `yaml:"period" json:"period"`
+	// Algorithm is the token bucket if it's empty
+	Algorithm RateLimitAlgorithm `yaml:"algorithm" json:"algorithm,omitempty"`
+	// Burst is the capacity of the token bucket. It's Requests if it's zero.
+	Burst int64 `yaml:"burst" json:"burst,omitempty"`
+	// UpstreamCost is the cost of the requests relayed to YouTube, so uncached requests can cost more than cache hits. It's 1 if it's zero.
+	UpstreamCost int64 `yaml:"upstreamCost" json:"upstreamCost,omitempty"`
+}
+
+type RateLimitAlgorithm string
+
+const (
+	TokenBucket   RateLimitAlgorithm = "tokenBucket"
+	SlidingWindow RateLimitAlgorithm = "slidingWindow"
+)
+
+// RateLimitKey determines what the requests are counted by
+type RateLimitKey string
+
+const (
+	RateLimitByIP       RateLimitKey = "ip"
+	RateLimitByConsumer RateLimitKey = "consumer"
+	RateLimitByRoute    RateLimitKey = "route"
+	RateLimitGlobal     RateLimitKey = "global"
+)
+
+// RateLimitRule limits the requests counted by Key. The counters are kept in redis so the limits hold across the replicas of the relay.
+type RateLimitRule struct {
+	RateLimit `yaml:",inline"`
+	Key       RateLimitKey `yaml:"key"`
+	// Routes are the routes the rule applies to, e.g. /youtube/v3/search. Empty means all the routes.
+	Routes []string `yaml:"routes"`
+}
+
+// JWTAuth verifies the signature of JWTs with either the secret for HMAC or the public key for RSA and ECDSA
+type JWTAuth struct {
+	Secret string `yaml:"secret"`
+	// PublicKeyFile is the PEM encoded public key
+	PublicKeyFile string `yaml:"publicKeyFile"`
+	// Issuer is checked against the iss claim if it's not empty
+	Issuer string `yaml:"issuer"`
+	// Audience is checked against the aud claim if it's not empty
+	Audience string `yaml:"audience"`
+}
+
+// Quota limits the YouTube Data API units spent by a tenant per day, which resets at midnight Pacific Time
+type Quota struct {
+	// DailyBudget is the units a tenant can spend per day. Zero means unlimited.
+	DailyBudget int64 `yaml:"dailyBudget"`
+}
+
+// AllTenants returns the default tenant, if it's defined, followed by the other tenants
+func (c *Conf) AllTenants() []Tenant {
+	tenants := make([]Tenant, 0, len(c.Tenants)+1)
+	if c.Tenant.AppName != "" || len(c.Tenants) == 0 {
+		tenants = append(tenants, c.Tenant)
+	}
+	return append(tenants, c.Tenants...)
+}
+
+// FindTenant returns the tenant with the app name. Empty app name refers to the default tenant.
+func (c *Conf) FindTenant(appName string) (Tenant, bool) {
+	if appName == "" {
+		return c.Tenant, c.Tenant.AppName != ""
+	}
+	for _, t := range c.AllTenants() {
+		if t.AppName == appName {
+			return t, true
+		}
+	}
+	return Tenant{}, false
+}
+
+// RoutePolicy restricts the parameters of a route. Empty fields fall back to the built-in policy of the route.
+type RoutePolicy struct {
+	// Parts are the allowed values of part
+	Parts []string `yaml:"parts"`
+	// Required are the parameters which cannot be empty
+	Required []string `yaml:"required"`
+	// Enums are the allowed values of the parameters, e.g. order and type
+	Enums map[string][]string `yaml:"enums"`
+	// MaxResults is the ceiling of maxResults
+	MaxResults int64 `yaml:"maxResults"`
+	// QueryPattern is the regular expression which q has to match
+	QueryPattern string `yaml:"queryPattern"`
+}
+
+// Admin enables the admin api, which manages the whitelists stored in redis. Requests have to carry the token as a bearer token.
+type Admin struct {
+	Token string `yaml:"token"`
 }
 
 // Whitelists are maps, key is the whitelist string, value determines if it should be effective
 type Whitelists struct {
 	ChannelIDs  map[string]bool `yaml:"channelIDs"`
 	PlaylistIDs map[string]bool `yaml:"playlistIDs"`
+	// Source loads the whitelists dynamically. The entries above are merged with the dynamic ones, which take precedence.
+	Source *WhitelistSource `yaml:"source"`
+	// PlaylistMode determines how playlists are whitelisted
+	PlaylistMode PlaylistWhitelistMode `yaml:"playlistMode"`
+	// PlaylistOwnerTTL is the ttl in seconds of the cached owner channel of playlists in the channel mode
+	PlaylistOwnerTTL int `yaml:"playlistOwnerTtl"`
+	// ResponseMode determines how the items of non-whitelisted channels in responses are handled
+	ResponseMode ResponseMode `yaml:"responseMode"`
+}
+
+type ResponseMode string
+
+const (
+	// RejectMode fails the whole request if any item belongs to a non-whitelisted channel
+	RejectMode ResponseMode = "reject"
+	// FilterMode removes the offending items and lists their ids in a response header
+	FilterMode ResponseMode = "filter"
+)
+
+type PlaylistWhitelistMode string
+
+const (
+	// PlaylistIDMode only allows the playlists in PlaylistIDs
+	PlaylistIDMode PlaylistWhitelistMode = "id"
+	// PlaylistChannelMode allows the playlists owned by the channels in ChannelIDs as well, and every item of them has to be owned by the whitelisted channels
+	PlaylistChannelMode PlaylistWhitelistMode = "channel"
+)
+
+const DefaultPlaylistOwnerTTL = 86400
+
+type WhitelistSourceType string
+
+const (
+	StaticWhitelist WhitelistSourceType = "static"
+	RedisWhitelist  WhitelistSourceType = "redis"
+	FileWhitelist   WhitelistSourceType = "file"
+)
+
+// WhitelistSource defines where the dynamic whitelists are loaded from and how they are refreshed
+type WhitelistSource struct {
+	Type WhitelistSourceType `yaml:"type"`
+	// Path is the yaml file with channelIDs and playlistIDs for the file type
+	Path string `yaml:"path"`
+	// RefreshInterval is how often the whitelists are reloaded for the redis type, or how often the file is checked for the file type
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+	// KeyspaceNotifications makes the redis type reload on keyspace notifications, which requires notify-keyspace-events to be enabled in redis
+	KeyspaceNotifications bool `yaml:"keyspaceNotifications"`
+}
+
+const DefaultWhitelistRefreshInterval = 30 * time.Second
+
+// IsDynamic reports if the whitelists are loaded from a dynamic source
+func (w Whitelists) IsDynamic() bool {
+	return w.Source != nil && w.Source.Type != "" && w.Source.Type != StaticWhitelist
 }
 
 type Cache struct {
 	IsEnabled    bool            `yaml:"isEnabled"`
+	Backend      CacheBackend    `yaml:"backend"`
+	Embedded     *EmbeddedCache  `yaml:"embedded"`
 	DisabledAPIs map[string]bool `yaml:"disabledApis"`
 	TTL          int             `yaml:"ttl"`
 	ErrorTTL     int             `yaml:"errorTtl"`
 	OverwriteTTL map[string]int  `yaml:"overwriteTtl"`
+	// StaleTTL keeps a copy of the responses for the seconds, which is served when the upstream fails. There are no stale copies if it's zero.
+	StaleTTL int `yaml:"staleTtl"`
+}
+
+// CacheBackend determines where the cache is stored. Redis is used if it's empty
+type CacheBackend string
+
+const (
+	RedisBackend    CacheBackend = "redis"
+	EmbeddedBackend CacheBackend = "embedded"
+)
+
+// EmbeddedCache defines the conf of the embedded store, which is meant for single node deployments without redis
+type EmbeddedCache struct {
+	Path string `yaml:"path"`
 }
 
 type OverwriteTTL struct {
@@ -47,8 +458,35 @@ type RedisService struct {
 	SingleInstance *RedisSingleInstance   `yaml:"single"`
 	Sentinel       *RedisSentinel         `yaml:"sentinel"`
 	Replica        *RedisReplicaInstances `yaml:"replica"`
+
+	// The following options apply to every type. Zero values fall back to the defaults.
+	PoolSize     int           `yaml:"poolSize"`
+	MaxRetries   int           `yaml:"maxRetries"` // 0 disables retries
+	DialTimeout  time.Duration `yaml:"dialTimeout"`
+	ReadTimeout  time.Duration `yaml:"readTimeout"`
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+	IdleTimeout  time.Duration `yaml:"idleTimeout"`
+	DB           int           `yaml:"db"` // cluster only supports db 0
+	TLS          *RedisTLS     `yaml:"tls"`
+}
+
+// RedisTLS enables TLS for the connections to redis. The system CA pool is used if CAFile is empty.
+type RedisTLS struct {
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
 }
 
+const (
+	DefaultRedisPoolSize     = 20
+	DefaultRedisDialTimeout  = time.Second
+	DefaultRedisReadTimeout  = time.Second
+	DefaultRedisWriteTimeout = time.Second
+	DefaultRedisIdleTimeout  = 10 * time.Second
+)
+
 type RedisType string
 
 const (
@@ -60,22 +498,28 @@ const (
 
 type RedisCluster struct {
 	Addrs    []RedisAddress `yaml:"addresses"`
+	Username string         `yaml:"username"`
 	Password string         `yaml:"password"`
 }
 
 type RedisSingleInstance struct {
 	Instance RedisAddress `yaml:"instance"`
+	Username string       `yaml:"username"`
 	Password string       `yaml:"password"`
 }
 
 type RedisSentinel struct {
-	Addrs    []RedisAddress `yaml:"addresses"`
-	Password string         `yaml:"password"`
+	Addrs            []RedisAddress `yaml:"addresses"`
+	MasterName       string         `yaml:"masterName"`
+	Username         string         `yaml:"username"`
+	Password         string         `yaml:"password"`
+	SentinelPassword string         `yaml:"sentinelPassword"`
 }
 
 type RedisReplicaInstances struct {
 	MasterAddrs []RedisAddress `yaml:"writers"`
 	SlaveAddrs  []RedisAddress `yaml:"readers"`
+	Username    string         `yaml:"username"`
 	Password    string         `yaml:"password"`
 }
 
@@ -84,140 +528,18 @@ type RedisAddress struct {
 	Port int    `yaml:"port"`
 }
 
-func (c *Conf) Valid() bool {
-
-	isValidAppName, _ := regexp.MatchString("^[a-zA-Z0-9.-]+$", c.AppName)
-	if !isValidAppName {
-		log.Errorf("appName(%s) can only contains alphanumeric, dot, and hyphen are allowed, and it cannot be empty", c.AppName)
-		return false
-	}
-
-	if c.ApiKey == "" {
-		log.Error("apiKey cannot be empty")
-		return false
-	}
-
-	if len(c.Whitelists.ChannelIDs) == 0 {
-		log.Error("whitelist's channel id cannot be empty")
-		return false
-	}
-
-	if len(c.Whitelists.PlaylistIDs) == 0 {
-		log.Error("whitelist's playlist id cannot be empty")
-		return false
-	}
-
-	if c.Cache.IsEnabled {
-		if c.Cache.TTL <= 0 {
-			log.Errorf("enabled cache's default ttl(%d) cannot be zero or negative", c.Cache.TTL)
-			return false
-		}
-
-		if c.Cache.ErrorTTL <= 0 {
-			log.Errorf("enabled cache's default error ttl(%d) cannot be zero or negative", c.Cache.ErrorTTL)
-			return false
-		}
-
-		for api, ttl := range c.Cache.OverwriteTTL {
-			if ttl <= 0 {
-				log.Errorf("enabled cache's ttl(%d) fot api(%s) cannot be zero or negative", ttl, api)
-				return false
-			}
-		}
-	}
-
-	if c.Redis != nil {
-		redis := c.Redis
-		switch redis.Type {
-		case Cluster:
-			if redis.Cluster == nil {
-				log.Error("redis type is set to %s but there is no %s configuration", Cluster, Cluster)
-				return false
-			}
-
-			cluster := redis.Cluster
-
-			if len(cluster.Addrs) == 0 {
-				log.Errorf("%s addresses cannot be empty", Cluster)
-				return false
-			}
-			for _, addr := range cluster.Addrs {
-				if len(addr.Addr) == 0 {
-					log.Errorf("one of the %s addresses is empty", Cluster)
-					return false
-				}
-			}
-		case Single:
-			if redis.SingleInstance == nil {
-				log.Error("redis type is set to %s but there is no %s configuration", Single, Single)
-				return false
-			}
-
-			single := redis.SingleInstance
-
-			if single.Instance.Addr == "" {
-				log.Errorf("%s address cannot be empty", Single)
-				return false
-			}
-		case Sentinel:
-			if redis.Sentinel == nil {
-				log.Error("redis type is set to %s but there is no %s configuration", Sentinel, Sentinel)
-				return false
-			}
-
-			sentinel := redis.Sentinel
-
-			if len(sentinel.Addrs) == 0 {
-				log.Errorf("%s addresses cannot be empty", Sentinel)
-				return false
-			}
-			for _, addr := range sentinel.Addrs {
-				if len(addr.Addr) == 0 {
-					log.Errorf("one of the %s addresses is empty", Sentinel)
-					return false
-				}
-			}
-		case Replica:
-			if redis.Replica == nil {
-				log.Error("redis type is set to %s but there is no %s configuration", Replica, Replica)
-				return false
-			}
-
-			replica := redis.Replica
-
-			if len(replica.MasterAddrs) == 0 {
-				log.Errorf("%s writer addresses cannot be empty", Replica)
-				return false
-			}
-			for _, addr := range replica.MasterAddrs {
-				if len(addr.Addr) == 0 {
-					log.Errorf("one of the %s writer addresses is empty", Replica)
-					return false
-				}
-			}
-
-			if len(replica.SlaveAddrs) == 0 {
-				log.Errorf("%s reader addresses cannot be empty", Replica)
-				return false
-			}
-			for _, addr := range replica.SlaveAddrs {
-				if len(addr.Addr) == 0 {
-					log.Errorf("one of the %s reader addresses is empty", Replica)
-					return false
-				}
-			}
-		default:
-			log.Errorf("redis type(%s) is not supported", redis.Type)
-			return false
-		}
-	}
-
-	return true
-}
-
 // LoadFile attempts to load the configuration file stored at the path
 // and returns the configuration. On error, it returns nil.
 func LoadFile(path string) (*Conf, error) {
+	cfg, err := ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return validated(cfg)
+}
+
+// ParseFile parses the configuration file stored at the path without validating it
+func ParseFile(path string) (*Conf, error) {
 	log.Printf("loading configuration file from %s", path)
 	if path == "" {
 		return nil, errors.New("invalid path")
@@ -228,20 +550,35 @@ func LoadFile(path string) (*Conf, error) {
 		return nil, errors.New("could not read configuration file")
 	}
 
-	return LoadConfig(body)
+	return ParseConfig(body)
 }
 
 // LoadConfig attempts to load the configuration from a byte slice.
 // On error, it returns nil.
 func LoadConfig(config []byte) (*Conf, error) {
+	cfg, err := ParseConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return validated(cfg)
+}
+
+// ParseConfig parses the configuration from a byte slice without validating it
+func ParseConfig(config []byte) (*Conf, error) {
 	var cfg = &Conf{}
 	err := yaml.Unmarshal(config, &cfg)
 	if err != nil {
 		return nil, errors.New("failed to unmarshal configuration: " + err.Error())
 	}
+	if cfg.unknownKeys, err = unknownKeys(config); err != nil {
+		return nil, errors.New("failed to unmarshal configuration: " + err.Error())
+	}
+	return cfg, nil
+}
 
-	if !cfg.Valid() {
-		return nil, errors.New("invalid configuration")
+func validated(cfg *Conf) (*Conf, error) {
+	if err := cfg.Check(); err != nil {
+		return nil, err
 	}
 
 	log.Println("configuration ok")
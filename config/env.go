@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix prefixes the environment variables which overwrite the configuration, e.g. YT_RELAY_API_KEY overwrites apiKey,
+// YT_RELAY_REDIS_SINGLE_PASSWORD overwrites redis.single.password and YT_RELAY_TENANTS_0_API_KEY overwrites the apiKey of the first tenant.
+// A variable with the _FILE suffix reads the value from the file, e.g. a secret mounted by Kubernetes.
+const EnvPrefix = "YT_RELAY_"
+
+// envFileSuffix reads the value of the variable from the file
+const envFileSuffix = "_FILE"
+
+// envName converts a yaml key or a map key to its part of the variable, e.g. apiKey to API_KEY and channelIDs to CHANNEL_IDS
+func envName(key string) string {
+	var b strings.Builder
+	var previous rune
+	for i, r := range key {
+		switch {
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(previous) || unicode.IsDigit(previous)):
+			b.WriteRune('_')
+			b.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			b.WriteRune('_')
+		}
+		previous = r
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+// HasEnv reports if any variable with EnvPrefix is in environ, which is formatted as os.Environ
+func HasEnv(environ []string) bool {
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, EnvPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type envApplier struct {
+	vars map[string]string
+	// used are the variables applied to the configuration
+	used map[string]bool
+}
+
+// ApplyEnv overwrites the configuration with the variables with EnvPrefix in environ, which is formatted as os.Environ.
+// Scalars are taken as they are, and the other values, e.g. maps, lists and whole sections, are parsed as yaml.
+func (c *Conf) ApplyEnv(environ []string) error {
+	e := envApplier{vars: make(map[string]string), used: make(map[string]bool)}
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 && strings.HasPrefix(kv, EnvPrefix) {
+			e.vars[kv[:i]] = kv[i+1:]
+		}
+	}
+	if len(e.vars) == 0 {
+		return nil
+	}
+
+	if err := e.applyFields(reflect.ValueOf(c).Elem(), strings.TrimSuffix(EnvPrefix, "_")); err != nil {
+		return err
+	}
+
+	applied := make([]string, 0, len(e.used))
+	for name := range e.used {
+		applied = append(applied, name)
+	}
+	sort.Strings(applied)
+	log.Infof("configuration is overwritten by the environment variables %s", strings.Join(applied, ", "))
+	for name := range e.vars {
+		if !e.used[name] {
+			log.Warnf("environment variable %s doesn't match any configuration", name)
+		}
+	}
+	return nil
+}
+
+// value returns the value of the variable, or the content of the file of the variable with the _FILE suffix
+func (e *envApplier) value(name string) (string, bool, error) {
+	value, ok := e.vars[name]
+	path, fromFile := e.vars[name+envFileSuffix]
+	switch {
+	case ok && fromFile:
+		return "", false, fmt.Errorf("environment variables %s and %s cannot be both set", name, name+envFileSuffix)
+	case fromFile:
+		e.used[name+envFileSuffix] = true
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("reading %s from file(%s) encountered error: %v", name, path, err)
+		}
+		return strings.TrimRight(string(body), "\r\n"), true, nil
+	case ok:
+		e.used[name] = true
+	}
+	return value, ok, nil
+}
+
+// hasPrefix reports if any variable is under name
+func (e *envApplier) hasPrefix(name string) bool {
+	for k := range e.vars {
+		if strings.HasPrefix(k, name+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets v from the variable of name, or the variables under it
+func (e *envApplier) apply(v reflect.Value, name string) error {
+	value, ok, err := e.value(name)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if v.Kind() == reflect.String {
+			v.SetString(value)
+			return nil
+		}
+		// the variable replaces the value instead of being merged into it
+		v.Set(reflect.Zero(v.Type()))
+		if err := yaml.Unmarshal([]byte(value), v.Addr().Interface()); err != nil {
+			return fmt.Errorf("parsing environment variable %s encountered error: %v", name, err)
+		}
+		return nil
+	}
+	if !e.hasPrefix(name) {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return e.applyFields(v.Elem(), name)
+	case reflect.Struct:
+		return e.applyFields(v, name)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.apply(v.Index(i), name+"_"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		for _, key := range v.MapKeys() {
+			// the map values aren't addressable, so they are set back after being applied
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := e.apply(elem, name+"_"+envName(key.String())); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	}
+	return nil
+}
+
+// yamlKey returns the key of the field in yaml, which is empty for the fields ignored by yaml, and if the field is inlined
+func yamlKey(field reflect.StructField) (key string, inline bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag := strings.Split(field.Tag.Get("yaml"), ",")
+	if tag[0] == "-" {
+		return "", false
+	}
+	if len(tag) > 1 && tag[1] == "inline" {
+		return "", true
+	}
+	if tag[0] == "" {
+		// yaml.v2 lowercases the field names without tags
+		return strings.ToLower(field.Name), false
+	}
+	return tag[0], false
+}
+
+// applyFields applies the exported fields of the struct by their yaml keys
+func (e *envApplier) applyFields(v reflect.Value, name string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key, inline := yamlKey(t.Field(i))
+		if inline {
+			if err := e.applyFields(v.Field(i), name); err != nil {
+				return err
+			}
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		if err := e.apply(v.Field(i), name+"_"+envName(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
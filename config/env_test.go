@@ -0,0 +1,98 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"apiKey":             "API_KEY",
+		"channelIDs":         "CHANNEL_IDS",
+		"playlistOwnerTtl":   "PLAYLIST_OWNER_TTL",
+		"sentinelPassword":   "SENTINEL_PASSWORD",
+		"UC-a.b":             "UC_A_B",
+		"/youtube/v3/search": "YOUTUBE_V3_SEARCH",
+	}
+	for key, want := range tests {
+		if got := envName(key); got != want {
+			t.Errorf("envName(%s) = %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(secret, []byte("file-password\n"), 0600); err != nil {
+		t.Fatalf("writing secret encountered error: %v", err)
+	}
+	c := Conf{
+		Tenant:  Tenant{AppName: "default", ApiKey: "default-key"},
+		Tenants: []Tenant{{AppName: "first", ApiKey: "first-key"}, {AppName: "second", ApiKey: "second-key"}},
+		Redis:   &RedisService{Type: Single},
+	}
+	err := c.ApplyEnv([]string{
+		"PATH=/bin",
+		"YT_RELAY_API_KEY=env-default-key",
+		"YT_RELAY_TENANTS_0_API_KEY=env-first-key",
+		"YT_RELAY_TENANTS_1_WHITELISTS_CHANNEL_IDS={UC-a: true}",
+		"YT_RELAY_REDIS_SINGLE_PASSWORD_FILE=" + secret,
+		"YT_RELAY_CACHE_TTL=30",
+		"YT_RELAY_UNKNOWN=ignored",
+	})
+	if err != nil {
+		t.Fatalf("ApplyEnv encountered error: %v", err)
+	}
+
+	if c.ApiKey != "env-default-key" || c.Tenants[0].ApiKey != "env-first-key" || c.Tenants[1].ApiKey != "second-key" {
+		t.Errorf("api keys are %s, %s and %s, want the ones of the variables and second-key", c.ApiKey, c.Tenants[0].ApiKey, c.Tenants[1].ApiKey)
+	}
+	if !c.Tenants[1].Whitelists.ChannelIDs["UC-a"] {
+		t.Errorf("channelIDs(%v) of the second tenant aren't parsed as yaml", c.Tenants[1].Whitelists.ChannelIDs)
+	}
+	// the password is read from the file without the trailing newline, and the missing section is created
+	if c.Redis.SingleInstance == nil || c.Redis.SingleInstance.Password != "file-password" {
+		t.Errorf("redis single instance(%+v) should have the password of the file", c.Redis.SingleInstance)
+	}
+	if c.Cache.TTL != 30 {
+		t.Errorf("cache ttl is %d, want 30", c.Cache.TTL)
+	}
+}
+
+func TestApplyEnvErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		want    string
+	}{
+		{
+			name:    "variable and file",
+			environ: []string{"YT_RELAY_TENANTS_0_API_KEY=key", "YT_RELAY_TENANTS_0_API_KEY_FILE=/run/secrets/key"},
+			want:    "YT_RELAY_TENANTS_0_API_KEY and YT_RELAY_TENANTS_0_API_KEY_FILE cannot be both set",
+		},
+		{
+			name:    "missing file",
+			environ: []string{"YT_RELAY_TENANTS_0_API_KEY_FILE=/nonexistent/key"},
+			want:    "reading YT_RELAY_TENANTS_0_API_KEY from file(/nonexistent/key)",
+		},
+		{
+			name:    "malformed yaml",
+			environ: []string{"YT_RELAY_CACHE_TTL=thirty"},
+			want:    "parsing environment variable YT_RELAY_CACHE_TTL",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Conf{Tenants: []Tenant{{AppName: "first", ApiKey: "first-key"}}}
+			err := c.ApplyEnv(tt.environ)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ApplyEnv() error = %v, want %s", err, tt.want)
+			}
+			if c.Tenants[0].ApiKey != "first-key" {
+				t.Errorf("api key is overwritten with %s", c.Tenants[0].ApiKey)
+			}
+		})
+	}
+}
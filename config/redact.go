@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const redacted = "REDACTED"
+
+func redact(s *string) {
+	if *s != "" {
+		*s = redacted
+	}
+}
+
+// Redacted returns a copy of the configuration with the secrets replaced, which is safe to log
+func (c Conf) Redacted() (Conf, error) {
+	// the round trip copies the maps and pointers, so the secrets of c are left untouched
+	body, err := yaml.Marshal(c)
+	if err != nil {
+		return Conf{}, err
+	}
+	var r Conf
+	if err = yaml.Unmarshal(body, &r); err != nil {
+		return Conf{}, err
+	}
+
+	redactTenant := func(t *Tenant) {
+		redact(&t.ApiKey)
+		if t.Auth == nil {
+			return
+		}
+		if t.Auth.JWT != nil {
+			redact(&t.Auth.JWT.Secret)
+		}
+		for name, consumer := range t.Auth.Consumers {
+			redact(&consumer.Token)
+			t.Auth.Consumers[name] = consumer
+		}
+	}
+	redactTenant(&r.Tenant)
+	for i := range r.Tenants {
+		redactTenant(&r.Tenants[i])
+	}
+
+	if r.Admin != nil {
+		redact(&r.Admin.Token)
+	}
+	if r.Tracing != nil {
+		for k := range r.Tracing.Headers {
+			r.Tracing.Headers[k] = redacted
+		}
+	}
+	if r.Redis != nil {
+		if r.Redis.Cluster != nil {
+			redact(&r.Redis.Cluster.Password)
+		}
+		if r.Redis.SingleInstance != nil {
+			redact(&r.Redis.SingleInstance.Password)
+		}
+		if r.Redis.Sentinel != nil {
+			redact(&r.Redis.Sentinel.Password)
+			redact(&r.Redis.Sentinel.SentinelPassword)
+		}
+		if r.Redis.Replica != nil {
+			redact(&r.Redis.Replica.Password)
+		}
+	}
+	return r, nil
+}
+
+// Diff lists the lines of the redacted yaml removed from a with "-" and added in b with "+"
+func Diff(a Conf, b Conf) (string, error) {
+	lines := func(c Conf) ([]string, error) {
+		r, err := c.Redacted()
+		if err != nil {
+			return nil, err
+		}
+		body, err := yaml.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(strings.TrimRight(string(body), "\n"), "\n"), nil
+	}
+	x, err := lines(a)
+	if err != nil {
+		return "", err
+	}
+	y, err := lines(b)
+	if err != nil {
+		return "", err
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] > lcs[i+1][j]):
+			fmt.Fprintf(&diff, "+ %s\n", y[j])
+			j++
+		default:
+			fmt.Fprintf(&diff, "- %s\n", x[i])
+			i++
+		}
+	}
+	return diff.String(), nil
+}
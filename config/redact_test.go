@@ -0,0 +1,97 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+const secretValue = "s3cret-value"
+
+// secretConf has every secret of the configuration set to secretValue
+func secretConf() Conf {
+	auth := func() *ClientAuth {
+		return &ClientAuth{
+			Consumers: map[string]Consumer{"web": {Token: secretValue}, "jwt-only": {}},
+			JWT:       &JWTAuth{Secret: secretValue},
+		}
+	}
+	return Conf{
+		Tenant:  Tenant{AppName: "default", ApiKey: secretValue, Auth: auth()},
+		Tenants: []Tenant{{AppName: "other", ApiKey: secretValue, Auth: auth()}},
+		Admin:   &Admin{Token: secretValue},
+		Tracing: &Tracing{Endpoint: "collector:4318", Headers: map[string]string{"Authorization": secretValue}},
+		Redis: &RedisService{
+			Type:           Sentinel,
+			Cluster:        &RedisCluster{Password: secretValue},
+			SingleInstance: &RedisSingleInstance{Password: secretValue},
+			Sentinel:       &RedisSentinel{Password: secretValue, SentinelPassword: secretValue},
+			Replica:        &RedisReplicaInstances{Password: secretValue},
+		},
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := secretConf()
+	r, err := c.Redacted()
+	if err != nil {
+		t.Fatalf("Redacted encountered error: %v", err)
+	}
+
+	body, err := yaml.Marshal(r)
+	if err != nil {
+		t.Fatalf("marshaling redacted configuration encountered error: %v", err)
+	}
+	if strings.Contains(string(body), secretValue) {
+		t.Errorf("redacted configuration has secrets:\n%s", body)
+	}
+	for _, tenant := range r.AllTenants() {
+		if tenant.ApiKey != redacted || tenant.Auth.JWT.Secret != redacted || tenant.Auth.Consumers["web"].Token != redacted {
+			t.Errorf("secrets of tenant(%s) aren't redacted: %+v", tenant.AppName, tenant)
+		}
+		// the empty tokens are left empty, so they don't look configured
+		if token := tenant.Auth.Consumers["jwt-only"].Token; token != "" {
+			t.Errorf("empty token of tenant(%s) is redacted to %s", tenant.AppName, token)
+		}
+	}
+	for _, secret := range []string{
+		r.Admin.Token,
+		r.Tracing.Headers["Authorization"],
+		r.Redis.Cluster.Password,
+		r.Redis.SingleInstance.Password,
+		r.Redis.Sentinel.Password,
+		r.Redis.Sentinel.SentinelPassword,
+		r.Redis.Replica.Password,
+	} {
+		if secret != redacted {
+			t.Errorf("secret is %s, want %s", secret, redacted)
+		}
+	}
+
+	// the maps and pointers of the original aren't shared with the redacted copy
+	original := secretConf()
+	cBody, _ := yaml.Marshal(c)
+	originalBody, _ := yaml.Marshal(original)
+	if string(cBody) != string(originalBody) {
+		t.Errorf("original configuration is changed by Redacted:\n%s", cBody)
+	}
+}
+
+func TestDiffIsRedacted(t *testing.T) {
+	a := secretConf()
+	b := secretConf()
+	b.Admin.Token = "rotated"
+	b.Cache.TTL = 30
+
+	diff, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff encountered error: %v", err)
+	}
+	if !strings.Contains(diff, "+   ttl: 30") {
+		t.Errorf("diff(%s) should have the changed ttl", diff)
+	}
+	if strings.Contains(diff, secretValue) || strings.Contains(diff, "rotated") || strings.Contains(diff, "token") {
+		t.Errorf("diff(%s) reveals the rotated secret", diff)
+	}
+}
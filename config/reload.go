@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// RestartRequired lists the changes from c to next which are only applied by a restart,
+// e.g. the listening address, the redis topology and the tenants themselves
+func (c Conf) RestartRequired(next Conf) []string {
+	var changes []string
+	changed := func(name string, a interface{}, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, name)
+		}
+	}
+	changed("address", c.Address, next.Address)
+	changed("port", c.Port, next.Port)
+	changed("redis", c.Redis, next.Redis)
+	changed("cache.isEnabled", c.Cache.IsEnabled, next.Cache.IsEnabled)
+	changed("cache.backend", c.Cache.Backend, next.Cache.Backend)
+	changed("cache.embedded", c.Cache.Embedded, next.Cache.Embedded)
+	changed("admin", c.Admin, next.Admin)
+	changed("tracing", c.Tracing, next.Tracing)
+	changed("health", c.Health, next.Health)
+	changed("server", c.Server, next.Server)
+	changed("tls", c.TLS, next.TLS)
+	changed("upstream.retry", c.Upstream.Retry, next.Upstream.Retry)
+	changed("upstream.circuitBreaker", c.Upstream.CircuitBreaker, next.Upstream.CircuitBreaker)
+	changed("upstream.fixtures", c.Upstream.Fixtures, next.Upstream.Fixtures)
+	changed("upstream.endpoint", c.Upstream.Endpoint, next.Upstream.Endpoint)
+	changed("upstream.feed", c.Upstream.Feed, next.Upstream.Feed)
+
+	tenants := c.AllTenants()
+	nextTenants := next.AllTenants()
+	appNames := func(tenants []Tenant) []string {
+		names := make([]string, 0, len(tenants))
+		for _, t := range tenants {
+			names = append(names, t.AppName)
+		}
+		return names
+	}
+	if !reflect.DeepEqual(appNames(tenants), appNames(nextTenants)) {
+		return append(changes, "tenants")
+	}
+	for i, t := range tenants {
+		n := nextTenants[i]
+		name := func(field string) string { return fmt.Sprintf("tenants[%s].%s", t.AppName, field) }
+		changed(name("apiKey"), t.ApiKey, n.ApiKey)
+		changed(name("pathPrefix"), t.PathPrefix, n.PathPrefix)
+		changed(name("hosts"), t.Hosts, n.Hosts)
+		changed(name("auth"), t.Auth, n.Auth)
+		changed(name("quota"), t.Quota, n.Quota)
+	}
+	return changes
+}
+
+// WithLive returns a copy of c with the settings of next which are applied without a restart:
+// the cache rules, the upstream timeouts, and the whitelists, policies and rate limits of the tenants
+func (c Conf) WithLive(next Conf) Conf {
+	live := c
+	live.Cache.DisabledAPIs = next.Cache.DisabledAPIs
+	live.Cache.TTL = next.Cache.TTL
+	live.Cache.ErrorTTL = next.Cache.ErrorTTL
+	live.Cache.OverwriteTTL = next.Cache.OverwriteTTL
+	live.Cache.StaleTTL = next.Cache.StaleTTL
+	live.Upstream.Timeout = next.Upstream.Timeout
+	live.Upstream.Timeouts = next.Upstream.Timeouts
+
+	withLive := func(t Tenant) Tenant {
+		n, ok := next.FindTenant(t.AppName)
+		if !ok {
+			return t
+		}
+		t.Whitelists = n.Whitelists
+		t.Policies = n.Policies
+		t.RateLimits = n.RateLimits
+		return t
+	}
+	if c.Tenant.AppName != "" {
+		live.Tenant = withLive(c.Tenant)
+	}
+	live.Tenants = make([]Tenant, 0, len(c.Tenants))
+	for _, t := range c.Tenants {
+		live.Tenants = append(live.Tenants, withLive(t))
+	}
+	return live
+}
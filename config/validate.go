@@ -0,0 +1,651 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Routes are the YouTube routes served by the relay, which are the keys of the route rules, e.g. policies and disabledApis
+var Routes = []string{"/youtube/v3/search", "/youtube/v3/videos", "/youtube/v3/playlistItems"}
+
+func isRoute(path string) bool {
+	for _, route := range Routes {
+		if path == route {
+			return true
+		}
+	}
+	return false
+}
+
+// Problem is an error or a warning of the configuration at the yaml path, e.g. tenants[1].whitelists.channelIDs
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return p.Message
+	}
+	return p.Path + ": " + p.Message
+}
+
+// ValidationError lists every error of the configuration
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		lines = append(lines, p.String())
+	}
+	return fmt.Sprintf("invalid configuration with %d error(s): %s", len(e.Problems), strings.Join(lines, "; "))
+}
+
+type validator struct {
+	errors   []Problem
+	warnings []Problem
+}
+
+func (v *validator) errorf(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(path string, format string, args ...interface{}) {
+	v.warnings = append(v.warnings, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// join appends the key to the yaml path
+func join(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// index appends the index of a list or the key of a map to the yaml path
+func index(path string, i interface{}) string {
+	return fmt.Sprintf("%s[%v]", path, i)
+}
+
+// field is a numeric field checked along with its siblings
+type field struct {
+	key   string
+	value int64
+}
+
+// sortedKeys returns the keys of the map with string keys in order, so the problems are listed in the same order every time
+func sortedKeys(m interface{}) []string {
+	keys := make([]string, 0)
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate checks the whole configuration. It returns the warnings, which don't make the configuration invalid,
+// and a *ValidationError listing every error if there is any.
+func (c *Conf) Validate() (warnings []Problem, err error) {
+	v := &validator{}
+	v.warnings = append(v.warnings, c.unknownKeys...)
+	c.validate(v)
+	if len(v.errors) > 0 {
+		return v.warnings, &ValidationError{Problems: v.errors}
+	}
+	return v.warnings, nil
+}
+
+// Check logs the warnings of the configuration and returns the error of Validate
+func (c *Conf) Check() error {
+	warnings, err := c.Validate()
+	for _, w := range warnings {
+		log.Warn(w)
+	}
+	return err
+}
+
+func (c *Conf) validate(v *validator) {
+	appNames := make(map[string]bool)
+	prefixes := make(map[string]bool)
+	hosts := make(map[string]bool)
+	hasRedisWhitelist := false
+	tenants := c.AllTenants()
+	for i, t := range tenants {
+		// the default tenant is inlined at the top level
+		path := ""
+		isDefault := i == 0 && len(tenants) > len(c.Tenants)
+		if !isDefault {
+			path = index("tenants", i-(len(tenants)-len(c.Tenants)))
+		}
+		t.validate(v, c, path)
+
+		if appNames[t.AppName] {
+			v.errorf(join(path, "appName"), "appName(%s) is duplicated", t.AppName)
+		}
+		appNames[t.AppName] = true
+
+		// only the default tenant can be served without prefix and hosts
+		if !isDefault && t.PathPrefix == "" && len(t.Hosts) == 0 {
+			v.errorf(path, "tenant(%s) needs pathPrefix or hosts", t.AppName)
+		}
+		if t.PathPrefix != "" {
+			if prefixes[t.PathPrefix] {
+				v.errorf(join(path, "pathPrefix"), "pathPrefix(%s) is duplicated", t.PathPrefix)
+			}
+			prefixes[t.PathPrefix] = true
+		}
+		for j, host := range t.Hosts {
+			if hosts[host] {
+				v.errorf(index(join(path, "hosts"), j), "host(%s) is duplicated", host)
+			}
+			hosts[host] = true
+		}
+
+		if t.Whitelists.IsDynamic() && t.Whitelists.Source.Type == RedisWhitelist {
+			hasRedisWhitelist = true
+		}
+	}
+
+	c.Upstream.validate(v, "upstream")
+
+	if c.Tracing != nil {
+		if c.Tracing.Endpoint == "" {
+			v.errorf("tracing.endpoint", "tracing endpoint cannot be empty")
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			v.errorf("tracing.sampleRatio", "tracing sample ratio(%f) should be between 0 and 1", c.Tracing.SampleRatio)
+		}
+	}
+
+	for _, f := range []field{
+		{"readTimeout", int64(c.Server.ReadTimeout)},
+		{"readHeaderTimeout", int64(c.Server.ReadHeaderTimeout)},
+		{"writeTimeout", int64(c.Server.WriteTimeout)},
+		{"idleTimeout", int64(c.Server.IdleTimeout)},
+		{"shutdownTimeout", int64(c.Server.ShutdownTimeout)},
+	} {
+		if f.value < 0 {
+			v.errorf(join("server", f.key), "server timeout(%s) cannot be negative", time.Duration(f.value))
+		}
+	}
+	if c.Server.MaxHeaderBytes < 0 {
+		v.errorf("server.maxHeaderBytes", "server max header bytes(%d) cannot be negative", c.Server.MaxHeaderBytes)
+	}
+	for i, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			v.errorf(index("server.trustedProxies", i), "trusted proxy(%s) should be an ip or a cidr", proxy)
+		}
+	}
+
+	if c.TLS != nil {
+		if c.TLS.CertFile == "" {
+			v.errorf("tls.certFile", "tls cert file is required")
+		}
+		if c.TLS.KeyFile == "" {
+			v.errorf("tls.keyFile", "tls key file is required")
+		}
+		if _, ok := TLSVersions[c.TLS.MinVersion]; !ok {
+			v.errorf("tls.minVersion", "tls min version(%s) should be 1.2 or 1.3", c.TLS.MinVersion)
+		}
+		if c.TLS.HTTPPort < 0 || c.TLS.HTTPPort > 65535 {
+			v.errorf("tls.httpPort", "tls http port(%d) is invalid", c.TLS.HTTPPort)
+		}
+		if c.TLS.ReloadInterval < 0 {
+			v.errorf("tls.reloadInterval", "tls reload interval(%s) cannot be negative", c.TLS.ReloadInterval)
+		}
+	}
+
+	if c.Health.Timeout < 0 {
+		v.errorf("health.timeout", "health check timeout(%s) cannot be negative", c.Health.Timeout)
+	}
+	if c.Health.UpstreamProbe != nil && c.Health.UpstreamProbe.Interval < 0 {
+		v.errorf("health.upstreamProbe.interval", "upstream probe interval(%s) cannot be negative", c.Health.UpstreamProbe.Interval)
+	}
+
+	if c.Admin != nil {
+		if c.Admin.Token == "" {
+			v.errorf("admin.token", "admin token cannot be empty")
+		}
+		if !hasRedisWhitelist {
+			v.errorf("admin", "admin api requires the whitelist source of a tenant to be %s", RedisWhitelist)
+		}
+	}
+
+	c.Cache.validate(v, c, "cache")
+
+	if c.Redis != nil {
+		c.Redis.validate(v, "redis")
+	}
+}
+
+func (t Tenant) validate(v *validator, c *Conf, path string) {
+	isValidAppName, _ := regexp.MatchString("^[a-zA-Z0-9.-]+$", t.AppName)
+	if !isValidAppName {
+		v.errorf(join(path, "appName"), "appName(%s) can only contains alphanumeric, dot, and hyphen are allowed, and it cannot be empty", t.AppName)
+	}
+
+	if t.ApiKey == "" && !c.Upstream.IsReplay() {
+		v.errorf(join(path, "apiKey"), "apiKey of tenant(%s) cannot be empty", t.AppName)
+	}
+
+	for _, route := range sortedKeys(t.Policies) {
+		policy := t.Policies[route]
+		policyPath := index(join(path, "policies"), route)
+		if !isRoute(route) {
+			v.warnf(policyPath, "policy of %s matches no route, which is one of %s", route, strings.Join(Routes, ", "))
+		}
+		if policy.MaxResults < 0 {
+			v.errorf(join(policyPath, "maxResults"), "maxResults(%d) of the policy of %s cannot be negative", policy.MaxResults, route)
+		}
+		if _, err := regexp.Compile(policy.QueryPattern); err != nil {
+			v.errorf(join(policyPath, "queryPattern"), "queryPattern(%s) of the policy of %s is invalid: %v", policy.QueryPattern, route, err)
+		}
+	}
+
+	t.Whitelists.validate(v, c, join(path, "whitelists"))
+
+	if t.Quota.DailyBudget < 0 {
+		v.errorf(join(path, "quota.dailyBudget"), "daily quota budget(%d) of tenant(%s) cannot be negative", t.Quota.DailyBudget, t.AppName)
+	}
+
+	if t.Auth != nil {
+		t.Auth.validate(v, c, join(path, "auth"))
+	}
+
+	for i, rule := range t.RateLimits {
+		rulePath := index(join(path, "rateLimits"), i)
+		rule.RateLimit.validate(v, rulePath)
+		switch rule.Key {
+		case RateLimitByIP, RateLimitByRoute, RateLimitGlobal:
+		case RateLimitByConsumer:
+			if t.Auth == nil {
+				v.errorf(join(rulePath, "key"), "rate limit is counted by %s but auth is not enabled", RateLimitByConsumer)
+			}
+		default:
+			v.errorf(join(rulePath, "key"), "key(%s) of rate limit is not supported", rule.Key)
+		}
+	}
+
+	for i, uri := range t.WarmUp {
+		uriPath := index(join(path, "warmUp"), i)
+		if u, err := url.ParseRequestURI(uri); err != nil || !strings.HasPrefix(uri, "/") {
+			v.errorf(uriPath, "warm-up uri(%s) should be a path with the query", uri)
+		} else if !isRoute(u.Path) {
+			v.warnf(uriPath, "warm-up uri(%s) matches no route, which is one of %s", uri, strings.Join(Routes, ", "))
+		} else if !c.Cache.IsEnabled {
+			v.warnf(uriPath, "warm-up uri(%s) fills nothing because the cache is disabled", uri)
+		}
+	}
+
+	if t.PathPrefix != "" {
+		isValidPrefix, _ := regexp.MatchString("^(/[a-zA-Z0-9._-]+)+$", t.PathPrefix)
+		if !isValidPrefix {
+			v.errorf(join(path, "pathPrefix"), "pathPrefix(%s) should start with a slash and cannot end with a slash", t.PathPrefix)
+		}
+	}
+}
+
+func (w Whitelists) validate(v *validator, c *Conf, path string) {
+	if source := w.Source; w.IsDynamic() {
+		sourcePath := join(path, "source")
+		switch source.Type {
+		case RedisWhitelist:
+			if c.Redis == nil {
+				v.errorf(join(sourcePath, "type"), "whitelist source is %s but there is no redis configuration", RedisWhitelist)
+			}
+		case FileWhitelist:
+			if source.Path == "" {
+				v.errorf(join(sourcePath, "path"), "whitelist source is %s but the path is empty", FileWhitelist)
+			}
+		default:
+			v.errorf(join(sourcePath, "type"), "whitelist source type(%s) is not supported", source.Type)
+		}
+		if source.RefreshInterval < 0 {
+			v.errorf(join(sourcePath, "refreshInterval"), "whitelist refresh interval(%s) cannot be negative", source.RefreshInterval)
+		}
+	} else {
+		if len(w.ChannelIDs) == 0 {
+			v.errorf(join(path, "channelIDs"), "whitelist's channel id cannot be empty")
+		}
+		if len(w.PlaylistIDs) == 0 && w.PlaylistMode != PlaylistChannelMode {
+			v.errorf(join(path, "playlistIDs"), "whitelist's playlist id cannot be empty")
+		}
+	}
+
+	switch w.PlaylistMode {
+	case "", PlaylistIDMode, PlaylistChannelMode:
+	default:
+		v.errorf(join(path, "playlistMode"), "whitelist's playlist mode(%s) is not supported", w.PlaylistMode)
+	}
+	switch w.ResponseMode {
+	case "", RejectMode, FilterMode:
+	default:
+		v.errorf(join(path, "responseMode"), "whitelist's response mode(%s) is not supported", w.ResponseMode)
+	}
+	if w.PlaylistOwnerTTL < 0 {
+		v.errorf(join(path, "playlistOwnerTtl"), "whitelist's playlist owner ttl(%d) cannot be negative", w.PlaylistOwnerTTL)
+	}
+}
+
+func (l RateLimit) validate(v *validator, path string) {
+	if l.Requests <= 0 {
+		v.errorf(join(path, "requests"), "rate limit needs positive requests")
+	}
+	if l.Period < time.Millisecond {
+		v.errorf(join(path, "period"), "rate limit needs a period of at least 1ms")
+	}
+	if l.Burst < 0 {
+		v.errorf(join(path, "burst"), "burst(%d) of rate limit cannot be negative", l.Burst)
+	}
+	if l.UpstreamCost < 0 {
+		v.errorf(join(path, "upstreamCost"), "upstreamCost(%d) of rate limit cannot be negative", l.UpstreamCost)
+	}
+	switch l.Algorithm {
+	case "", TokenBucket, SlidingWindow:
+	default:
+		v.errorf(join(path, "algorithm"), "algorithm(%s) of rate limit is not supported", l.Algorithm)
+	}
+}
+
+func (a ClientAuth) validate(v *validator, c *Conf, path string) {
+	if len(a.Consumers) == 0 && a.JWT == nil && !a.Redis {
+		v.errorf(path, "auth needs consumers, jwt, or redis")
+	}
+	if a.Redis && c.Redis == nil {
+		v.errorf(join(path, "redis"), "auth looks up consumers in redis but there is no redis configuration")
+	}
+	if a.JWT != nil && (a.JWT.Secret == "") == (a.JWT.PublicKeyFile == "") {
+		v.errorf(join(path, "jwt"), "jwt needs either secret or publicKeyFile")
+	}
+	tokens := make(map[string]bool)
+	for _, name := range sortedKeys(a.Consumers) {
+		consumer := a.Consumers[name]
+		consumerPath := index(join(path, "consumers"), name)
+		if consumer.Token == "" && a.JWT == nil {
+			v.errorf(join(consumerPath, "token"), "consumer(%s) has no token and jwt is not enabled", name)
+		}
+		if consumer.Token != "" {
+			if tokens[consumer.Token] {
+				v.errorf(join(consumerPath, "token"), "token of consumer(%s) is duplicated", name)
+			}
+			tokens[consumer.Token] = true
+		}
+		for i, route := range consumer.Routes {
+			if !isRoute(route) {
+				v.warnf(index(join(consumerPath, "routes"), i), "route(%s) matches no route, which is one of %s", route, strings.Join(Routes, ", "))
+			}
+		}
+		if limit := consumer.RateLimit; limit != nil {
+			limit.validate(v, join(consumerPath, "rateLimit"))
+		}
+	}
+}
+
+// isHTTPURL tells if s is an absolute http or https url
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (u Upstream) validate(v *validator, path string) {
+	if u.Timeout < 0 {
+		v.errorf(join(path, "timeout"), "upstream timeout(%s) cannot be negative", u.Timeout)
+	}
+	for _, route := range sortedKeys(u.Timeouts) {
+		timeout := u.Timeouts[route]
+		timeoutPath := index(join(path, "timeouts"), route)
+		if timeout <= 0 {
+			v.errorf(timeoutPath, "upstream timeout(%s) of %s should be positive", timeout, route)
+		}
+		if !isRoute(route) {
+			v.warnf(timeoutPath, "upstream timeout of %s matches no route, which is one of %s", route, strings.Join(Routes, ", "))
+		}
+	}
+	if retry := u.Retry; retry != nil {
+		for _, f := range []field{
+			{"maxAttempts", int64(retry.MaxAttempts)},
+			{"baseDelay", int64(retry.BaseDelay)},
+			{"maxDelay", int64(retry.MaxDelay)},
+		} {
+			if f.value < 0 {
+				v.errorf(join(path, "retry."+f.key), "%s of upstream retry cannot be negative", f.key)
+			}
+		}
+	}
+	if fixtures := u.Fixtures; fixtures != nil {
+		switch fixtures.Mode {
+		case RecordFixtures, ReplayFixtures:
+		default:
+			v.errorf(join(path, "fixtures.mode"), "fixture mode(%s) should be %s or %s", fixtures.Mode, RecordFixtures, ReplayFixtures)
+		}
+		if fixtures.Dir == "" {
+			v.errorf(join(path, "fixtures.dir"), "fixture dir cannot be empty")
+		}
+	}
+	if u.Endpoint != "" && !isHTTPURL(u.Endpoint) {
+		v.errorf(join(path, "endpoint"), "upstream endpoint(%s) should be an absolute http or https url", u.Endpoint)
+	}
+	if feed := u.Feed; feed != nil {
+		switch feed.Mode {
+		case FallbackFeed, PrimaryFeed:
+		default:
+			v.errorf(join(path, "feed.mode"), "feed mode(%s) should be %s or %s", feed.Mode, FallbackFeed, PrimaryFeed)
+		}
+		if feed.URL != "" && !isHTTPURL(feed.URL) {
+			v.errorf(join(path, "feed.url"), "feed url(%s) should be an absolute http or https url", feed.URL)
+		}
+	}
+	if breaker := u.CircuitBreaker; breaker != nil {
+		if breaker.FailureThreshold < 0 {
+			v.errorf(join(path, "circuitBreaker.failureThreshold"), "failureThreshold(%d) of upstream circuit breaker cannot be negative", breaker.FailureThreshold)
+		}
+		if breaker.OpenTimeout < 0 {
+			v.errorf(join(path, "circuitBreaker.openTimeout"), "openTimeout(%s) of upstream circuit breaker cannot be negative", breaker.OpenTimeout)
+		}
+	}
+}
+
+func (cache Cache) validate(v *validator, c *Conf, path string) {
+	// the cache rules are looked up by the path of the requests, and overwriteTtl by the request uri with the query
+	for _, api := range sortedKeys(cache.DisabledAPIs) {
+		if !isRoute(api) {
+			v.warnf(index(join(path, "disabledApis"), api), "disabled api(%s) matches no route, which is one of %s", api, strings.Join(Routes, ", "))
+		}
+	}
+	for _, api := range sortedKeys(cache.OverwriteTTL) {
+		ttlPath := index(join(path, "overwriteTtl"), api)
+		route := strings.SplitN(api, "?", 2)
+		switch {
+		case !isRoute(route[0]):
+			v.warnf(ttlPath, "ttl of api(%s) can never match because %s is not a route, which is one of %s", api, route[0], strings.Join(Routes, ", "))
+		case len(route) == 1 || route[1] == "":
+			v.warnf(ttlPath, "ttl of api(%s) can never match because it's matched with the request uri including the query, which always has part", api)
+		case cache.DisabledAPIs[route[0]]:
+			v.warnf(ttlPath, "ttl of api(%s) can never match because the cache of %s is disabled", api, route[0])
+		}
+	}
+
+	if !cache.IsEnabled {
+		return
+	}
+
+	if cache.TTL <= 0 {
+		v.errorf(join(path, "ttl"), "enabled cache's default ttl(%d) cannot be zero or negative", cache.TTL)
+	}
+	if cache.ErrorTTL <= 0 {
+		v.errorf(join(path, "errorTtl"), "enabled cache's default error ttl(%d) cannot be zero or negative", cache.ErrorTTL)
+	}
+	for _, api := range sortedKeys(cache.OverwriteTTL) {
+		if ttl := cache.OverwriteTTL[api]; ttl <= 0 {
+			v.errorf(index(join(path, "overwriteTtl"), api), "enabled cache's ttl(%d) for api(%s) cannot be zero or negative", ttl, api)
+		}
+	}
+	if cache.StaleTTL < 0 {
+		v.errorf(join(path, "staleTtl"), "enabled cache's stale ttl(%d) cannot be negative", cache.StaleTTL)
+	}
+
+	switch cache.Backend {
+	case "", RedisBackend:
+		if c.Redis == nil {
+			v.errorf(join(path, "backend"), "cache backend is %s but there is no redis configuration", RedisBackend)
+		}
+	case EmbeddedBackend:
+		if cache.Embedded == nil || cache.Embedded.Path == "" {
+			v.errorf(join(path, "embedded.path"), "cache backend is %s but the path of the embedded store is empty", EmbeddedBackend)
+		}
+	default:
+		v.errorf(join(path, "backend"), "cache backend(%s) is not supported", cache.Backend)
+	}
+}
+
+func (redis RedisService) validate(v *validator, path string) {
+	for _, f := range []field{
+		{"poolSize", int64(redis.PoolSize)},
+		{"maxRetries", int64(redis.MaxRetries)},
+		{"db", int64(redis.DB)},
+		{"dialTimeout", int64(redis.DialTimeout)},
+		{"readTimeout", int64(redis.ReadTimeout)},
+		{"writeTimeout", int64(redis.WriteTimeout)},
+		{"idleTimeout", int64(redis.IdleTimeout)},
+	} {
+		if f.value < 0 {
+			v.errorf(join(path, f.key), "redis %s cannot be negative", f.key)
+		}
+	}
+	if tls := redis.TLS; tls != nil && (tls.CertFile == "") != (tls.KeyFile == "") {
+		v.errorf(join(path, "tls"), "redis tls certFile and keyFile must be provided together")
+	}
+
+	addresses := func(path string, name string, addrs []RedisAddress) {
+		if len(addrs) == 0 {
+			v.errorf(path, "%s cannot be empty", name)
+		}
+		for i, addr := range addrs {
+			if len(addr.Addr) == 0 {
+				v.errorf(join(index(path, i), "address"), "one of the %s is empty", name)
+			}
+		}
+	}
+
+	switch redis.Type {
+	case Cluster:
+		if redis.Cluster == nil {
+			v.errorf(join(path, "cluster"), "redis type is set to %s but there is no %s configuration", Cluster, Cluster)
+			break
+		}
+		if redis.DB != 0 {
+			v.errorf(join(path, "db"), "%s only supports db 0", Cluster)
+		}
+		addresses(join(path, "cluster.addresses"), fmt.Sprintf("%s addresses", Cluster), redis.Cluster.Addrs)
+	case Single:
+		if redis.SingleInstance == nil {
+			v.errorf(join(path, "single"), "redis type is set to %s but there is no %s configuration", Single, Single)
+			break
+		}
+		if redis.SingleInstance.Instance.Addr == "" {
+			v.errorf(join(path, "single.instance.address"), "%s address cannot be empty", Single)
+		}
+	case Sentinel:
+		if redis.Sentinel == nil {
+			v.errorf(join(path, "sentinel"), "redis type is set to %s but there is no %s configuration", Sentinel, Sentinel)
+			break
+		}
+		if redis.Sentinel.MasterName == "" {
+			v.errorf(join(path, "sentinel.masterName"), "%s masterName cannot be empty", Sentinel)
+		}
+		addresses(join(path, "sentinel.addresses"), fmt.Sprintf("%s addresses", Sentinel), redis.Sentinel.Addrs)
+	case Replica:
+		if redis.Replica == nil {
+			v.errorf(join(path, "replica"), "redis type is set to %s but there is no %s configuration", Replica, Replica)
+			break
+		}
+		addresses(join(path, "replica.writers"), fmt.Sprintf("%s writer addresses", Replica), redis.Replica.MasterAddrs)
+		addresses(join(path, "replica.readers"), fmt.Sprintf("%s reader addresses", Replica), redis.Replica.SlaveAddrs)
+	default:
+		v.errorf(join(path, "type"), "redis type(%s) is not supported", redis.Type)
+	}
+}
+
+// unknownKeys lists the keys of the yaml document which match no field of the configuration, e.g. misspelled ones, which yaml ignores silently
+func unknownKeys(body []byte) ([]Problem, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	walkKeys(doc, reflect.TypeOf(Conf{}), "", &problems)
+	return problems, nil
+}
+
+// yamlFields maps the yaml keys of the struct, including the inlined ones, to the types of the fields
+func yamlFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, inline := yamlKey(field)
+		if inline {
+			yamlFields(field.Type, fields)
+		} else if key != "" {
+			fields[key] = field.Type
+		}
+	}
+}
+
+func walkKeys(node interface{}, t reflect.Type, path string, problems *[]Problem) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := node.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		yamlFields(t, fields)
+		for _, k := range sortedNodeKeys(m) {
+			fieldType, ok := fields[k]
+			if !ok {
+				*problems = append(*problems, Problem{Path: join(path, k), Message: fmt.Sprintf("key(%s) is unknown and ignored", k)})
+				continue
+			}
+			walkKeys(m[k], fieldType, join(path, k), problems)
+		}
+	case reflect.Slice:
+		list, ok := node.([]interface{})
+		if !ok {
+			return
+		}
+		for i, value := range list {
+			walkKeys(value, t.Elem(), index(path, i), problems)
+		}
+	case reflect.Map:
+		m, ok := node.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		for _, k := range sortedNodeKeys(m) {
+			walkKeys(m[k], t.Elem(), index(path, k), problems)
+		}
+	}
+}
+
+// sortedNodeKeys returns the keys of the yaml mapping in order
+func sortedNodeKeys(m map[interface{}]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, fmt.Sprint(k))
+	}
+	sort.Strings(keys)
+	return keys
+}
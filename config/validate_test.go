@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// invalidConfig has an error in every tenant and several sections, besides the keys and rules which are only warned about
+const invalidConfig = `
+appName: "bad name"
+whitelists:
+  channelIDs:
+    UC-a: true
+policies:
+  /youtube/v3/channels:
+    maxResults: -1
+tenants:
+  - appName: second
+    apiKey: key
+    whitelists:
+      channelIDs:
+        UC-a: true
+      playlistIDs:
+        PL-a: true
+    rateLimits:
+      - requests: 1
+        period: 1s
+        key: nobody
+server:
+  trustedProxies: ["10.0.0.0/8", "proxy"]
+cache:
+  isEnabled: true
+  ttl: 0
+  errorTtl: 60
+  backend: embedded
+isEnabled: true
+`
+
+// problemPaths returns the yaml paths of the problems
+func problemPaths(problems []Problem) []string {
+	paths := make([]string, 0, len(problems))
+	for _, p := range problems {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	c, err := ParseConfig([]byte(invalidConfig))
+	if err != nil {
+		t.Fatalf("parsing configuration encountered error: %v", err)
+	}
+	warnings, err := c.Validate()
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Validate() error = %v, want *ValidationError", err)
+	}
+	wantErrors := []string{
+		"appName",
+		"apiKey",
+		"policies[/youtube/v3/channels].maxResults",
+		"whitelists.playlistIDs",
+		"tenants[0].rateLimits[0].key",
+		"tenants[0]",
+		"server.trustedProxies[1]",
+		"cache.ttl",
+		"cache.embedded.path",
+	}
+	if got := problemPaths(validationErr.Problems); !reflect.DeepEqual(got, wantErrors) {
+		t.Errorf("Validate() reports errors at %v, want %v", got, wantErrors)
+	}
+	if !strings.HasPrefix(err.Error(), "invalid configuration with 9 error(s): appName: ") {
+		t.Errorf("error(%s) doesn't list the problems with their paths", err)
+	}
+
+	wantWarnings := []string{"isEnabled", "policies[/youtube/v3/channels]"}
+	if got := problemPaths(warnings); !reflect.DeepEqual(got, wantWarnings) {
+		t.Errorf("Validate() warns at %v, want %v", got, wantWarnings)
+	}
+}
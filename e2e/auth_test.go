@@ -0,0 +1,89 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/middleware"
+)
+
+const secondSearchURI = "/youtube/v3/search?part=snippet&channelId=UC-second"
+
+// getAs requests the uri with the api token
+func (r *testRelay) getAs(t *testing.T, token string, uri string, code int) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, uri, nil)
+	if token != "" {
+		req.Header.Set(middleware.APIKeyHeader, token)
+	}
+	w := r.do(req)
+	if w.Code != code {
+		t.Errorf("GET %s with token(%s) responded with %d, want %d: %s", uri, token, w.Code, code, w.Body.String())
+	}
+	return w
+}
+
+// isCached reports if the response of the uri is cached under the namespace
+func (r *testRelay) isCached(t *testing.T, namespace string, uri string) bool {
+	t.Helper()
+	key, err := cache.GetCacheKey(namespace, uri)
+	if err != nil {
+		t.Fatalf("creating cache key encountered error: %v", err)
+	}
+	_, err = r.Cache.Get(context.Background(), key)
+	if err != nil && err != cache.ErrCacheMiss {
+		t.Fatalf("getting %s encountered error: %v", key, err)
+	}
+	return err == nil
+}
+
+func TestConsumers(t *testing.T) {
+	r := newRelay(t, func(c *config.Conf) {
+		c.Whitelists.ChannelIDs["UC-second"] = true
+		c.Auth = &config.ClientAuth{Consumers: map[string]config.Consumer{
+			"web": {Token: "web-token"},
+			// narrow only sees UC-allowed of the channels of the tenant
+			"narrow":    {Token: "narrow-token", Whitelists: &config.ConsumerWhitelists{ChannelIDs: map[string]bool{"UC-allowed": true}}},
+			"playlists": {Token: "playlists-token", Routes: []string{"/youtube/v3/playlistItems"}},
+			"old":       {Token: "old-token", Disabled: true},
+		}}
+	})
+	r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+	r.add(t, "Search", ytrelay.Options{Part: "snippet", ChannelID: "UC-second"}, searchResponse("UC-second"))
+
+	t.Run("credentials are required", func(t *testing.T) {
+		w := r.getAs(t, "", searchURI, http.StatusUnauthorized)
+		if w.Header().Get("WWW-Authenticate") == "" {
+			t.Error("unauthorized response has no WWW-Authenticate")
+		}
+		r.getAs(t, "other-token", searchURI, http.StatusUnauthorized)
+		r.getAs(t, "old-token", searchURI, http.StatusForbidden)
+		r.getAs(t, "playlists-token", searchURI, http.StatusForbidden)
+	})
+
+	t.Run("whitelists of the consumer are enforced under its own cache namespace", func(t *testing.T) {
+		// the response cached for web isn't served to narrow, whose whitelist rejects the channel
+		r.getAs(t, "web-token", secondSearchURI, http.StatusOK)
+		if !r.isCached(t, r.Conf.AppName, secondSearchURI) {
+			t.Errorf("response of web isn't cached in the namespace of the tenant")
+		}
+		r.getAs(t, "narrow-token", secondSearchURI, http.StatusBadRequest)
+		r.expectCalls(t, "Search", 1)
+
+		for i := 0; i < 2; i++ {
+			r.getAs(t, "narrow-token", searchURI, http.StatusOK)
+		}
+		r.expectCalls(t, "Search", 2)
+		if !r.isCached(t, r.Conf.AppName+":consumer:narrow", searchURI) || r.isCached(t, r.Conf.AppName, searchURI) {
+			t.Errorf("response of narrow should only be cached in its own namespace")
+		}
+		// web doesn't share the namespace of narrow, so it calls YouTube
+		r.getAs(t, "web-token", searchURI, http.StatusOK)
+		r.expectCalls(t, "Search", 3)
+	})
+}
@@ -0,0 +1,225 @@
+// Package e2e tests the relay end to end against the fake YouTube Data API.
+// The tenant is built as the server builds it, with the cache middleware and the whitelists, and only YouTube is faked.
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/relay/fake"
+	"github.com/mirror-media/yt-relay/server"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	gin.SetMode(gin.ReleaseMode)
+	// the logs of the relay and the responses are printed with -v
+	if testing.Verbose() {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetOutput(ioutil.Discard)
+		gin.DefaultWriter = ioutil.Discard
+	}
+	os.Exit(m.Run())
+}
+
+const (
+	searchURI         = "/youtube/v3/search?part=snippet&channelId=UC-allowed"
+	rejectedSearchURI = "/youtube/v3/search?part=snippet&channelId=UC-other"
+	videosURI         = "/youtube/v3/videos?part=snippet&id=v1,v2"
+	feedSearchURI     = "/youtube/v3/search?part=snippet&channelId=UC-allowed&order=date&maxResults=2"
+	playlistURI       = "/youtube/v3/playlistItems?part=snippet&playlistId=PL-allowed"
+)
+
+var (
+	searchOptions   = ytrelay.Options{Part: "snippet", ChannelID: "UC-allowed"}
+	videosOptions   = ytrelay.Options{Part: "snippet", IDs: "v1,v2"}
+	playlistOptions = ytrelay.Options{Part: "snippet", PlaylistID: "PL-allowed"}
+	// feedSearchOptions search the latest uploads, which are in the feed
+	feedSearchOptions = ytrelay.Options{Part: "snippet", ChannelID: "UC-allowed", Order: "date", MaxResults: 2}
+)
+
+// testRelay is the tenant under test with a fake YouTube
+type testRelay struct {
+	YouTube *fake.Server
+	Conf    config.Conf
+	Cache   cache.Provider
+	tenant  *server.Tenant
+}
+
+// defaultConf whitelists UC-allowed and PL-allowed, and caches the responses in an embedded store
+func defaultConf(dir string) config.Conf {
+	return config.Conf{
+		Tenant: config.Tenant{
+			AppName: "e2e",
+			ApiKey:  "e2e-key",
+			Whitelists: config.Whitelists{
+				ChannelIDs:  map[string]bool{"UC-allowed": true},
+				PlaylistIDs: map[string]bool{"PL-allowed": true},
+			},
+		},
+		Cache: config.Cache{
+			IsEnabled: true,
+			Backend:   config.EmbeddedBackend,
+			Embedded:  &config.EmbeddedCache{Path: filepath.Join(dir, "cache.db")},
+			TTL:       60,
+			ErrorTTL:  60,
+		},
+		Upstream: config.Upstream{Timeout: 2 * time.Second},
+	}
+}
+
+// newRelay builds the tenant of the default configuration adjusted by configure, which may be nil.
+// YouTube is the fake server, whose fixtures are in the fixtures dir.
+func newRelay(t *testing.T, configure func(c *config.Conf)) *testRelay {
+	t.Helper()
+	dir := t.TempDir()
+
+	youTube := fake.NewServer(filepath.Join(dir, "fixtures"))
+	t.Cleanup(youTube.Close)
+
+	c := defaultConf(dir)
+	if configure != nil {
+		configure(&c)
+	}
+	c.Upstream.Endpoint = youTube.Endpoint()
+	if c.Upstream.Feed != nil && c.Upstream.Feed.URL == "" {
+		c.Upstream.Feed.URL = youTube.URL + fake.FeedPath
+	}
+	if _, err := c.Validate(); err != nil {
+		t.Fatalf("configuration is invalid: %v", err)
+	}
+
+	stores, err := cache.Open(c)
+	if err != nil {
+		t.Fatalf("opening cache encountered error: %v", err)
+	}
+	t.Cleanup(func() { _ = stores.Close() })
+
+	tenant, err := server.NewTenant(c, c.Tenant, stores.Redis, stores.Cache, stores.Store)
+	if err != nil {
+		t.Fatalf("creating tenant encountered error: %v", err)
+	}
+	t.Cleanup(func() { _ = tenant.Close() })
+	return &testRelay{YouTube: youTube, Conf: c, Cache: stores.Cache, tenant: tenant}
+}
+
+// fixtureDir is where the fake YouTube looks up the recorded fixtures
+func (r *testRelay) fixtureDir() string {
+	return filepath.Join(filepath.Dir(r.Conf.Cache.Embedded.Path), "fixtures")
+}
+
+// addFeed serves the feed of the channel or the playlist in testdata/feeds with the fake YouTube
+func (r *testRelay) addFeed(t *testing.T, id string) {
+	t.Helper()
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "feeds", id+".xml"))
+	if err != nil {
+		t.Fatalf("reading feed of %s encountered error: %v", id, err)
+	}
+	r.YouTube.AddFeed(id, body)
+}
+
+// add responds to the call of the method with response
+func (r *testRelay) add(t *testing.T, method string, options ytrelay.Options, response interface{}) {
+	t.Helper()
+	if err := r.YouTube.Add(method, options, response); err != nil {
+		t.Fatalf("adding fixture encountered error: %v", err)
+	}
+}
+
+// get requests the uri of the tenant
+func (r *testRelay) get(uri string) *httptest.ResponseRecorder {
+	return r.do(httptest.NewRequest(http.MethodGet, uri, nil))
+}
+
+// do serves the request with the tenant. The requests of httptest are from 192.0.2.1.
+func (r *testRelay) do(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.tenant.ServeHTTP(w, req)
+	log.Debugf("%s %s: %d %s", req.Method, req.URL, w.Code, strings.TrimSpace(w.Body.String()))
+	return w
+}
+
+// expectGet requests the uri and checks the status of the response
+func (r *testRelay) expectGet(t *testing.T, uri string, code int) *httptest.ResponseRecorder {
+	t.Helper()
+	w := r.get(uri)
+	if w.Code != code {
+		t.Errorf("GET %s responded with %d, want %d: %s", uri, w.Code, code, w.Body.String())
+	}
+	return w
+}
+
+// purge deletes the cached response of the uri, but not its stale copy
+func (r *testRelay) purge(t *testing.T, uri string) {
+	t.Helper()
+	key, err := cache.GetCacheKey(r.Conf.AppName, uri)
+	if err != nil {
+		t.Fatalf("creating cache key encountered error: %v", err)
+	}
+	if err = r.Cache.Delete(context.Background(), key); err != nil {
+		t.Fatalf("purging %s encountered error: %v", uri, err)
+	}
+}
+
+func (r *testRelay) expectCalls(t *testing.T, method string, calls int) {
+	t.Helper()
+	if got := r.YouTube.Calls(method); got != calls {
+		t.Errorf("YouTube was called %d time(s) for %s, want %d", got, method, calls)
+	}
+}
+
+// decode decodes the body of the response into v
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("response(%s) is malformed: %v", w.Body.String(), err)
+	}
+}
+
+func searchResponse(channelIDs ...string) *youtube.SearchListResponse {
+	resp := &youtube.SearchListResponse{Kind: "youtube#searchListResponse", PageInfo: &youtube.PageInfo{TotalResults: int64(len(channelIDs))}}
+	for _, channelID := range channelIDs {
+		resp.Items = append(resp.Items, &youtube.SearchResult{
+			Id:      &youtube.ResourceId{Kind: "youtube#video", VideoId: "video-of-" + channelID},
+			Snippet: &youtube.SearchResultSnippet{ChannelId: channelID},
+		})
+	}
+	return resp
+}
+
+// videosResponse returns v1 of UC-allowed and v2 of UC-other
+func videosResponse() *youtube.VideoListResponse {
+	return &youtube.VideoListResponse{
+		Kind:     "youtube#videoListResponse",
+		PageInfo: &youtube.PageInfo{TotalResults: 2},
+		Items: []*youtube.Video{
+			{Id: "v1", Snippet: &youtube.VideoSnippet{ChannelId: "UC-allowed"}},
+			{Id: "v2", Snippet: &youtube.VideoSnippet{ChannelId: "UC-other"}},
+		},
+	}
+}
+
+func playlistResponse() *youtube.PlaylistItemListResponse {
+	return &youtube.PlaylistItemListResponse{
+		Kind: "youtube#playlistItemListResponse",
+		Items: []*youtube.PlaylistItem{
+			{Id: "item1", Snippet: &youtube.PlaylistItemSnippet{PlaylistId: "PL-allowed", ChannelId: "UC-allowed", VideoOwnerChannelId: "UC-allowed"}},
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package e2e
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/relay/fake"
+	"github.com/mirror-media/yt-relay/server/route"
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestFallbackFeed(t *testing.T) {
+	fallback := func(c *config.Conf) {
+		c.Upstream.Feed = &config.Feed{Mode: config.FallbackFeed}
+	}
+
+	t.Run("search falls back to the feed when the quota of YouTube runs out", func(t *testing.T) {
+		r := newRelay(t, fallback)
+		r.addFeed(t, "UC-allowed")
+		r.YouTube.AddError("Search", feedSearchOptions, http.StatusForbidden, "quotaExceeded")
+		w := r.expectGet(t, feedSearchURI, http.StatusOK)
+		var resp youtube.SearchListResponse
+		decode(t, w, &resp)
+		if len(resp.Items) != 2 || resp.Items[0].Id.VideoId != "video3" || resp.Items[1].Id.VideoId != "video2" {
+			t.Errorf("response(%s) should have the latest 2 uploads", w.Body.String())
+		} else if snippet := resp.Items[0].Snippet; snippet.PublishedAt != "2021-10-03T10:00:00Z" || snippet.Description != "The latest upload & its description" || snippet.Thumbnails.Medium == nil {
+			t.Errorf("snippet(%+v) isn't converted from the feed", snippet)
+		}
+		r.expectCalls(t, "Search", 1)
+		r.expectCalls(t, "Feed", 1)
+	})
+	t.Run("search falls back to the feed when the daily budget runs out", func(t *testing.T) {
+		r := newRelay(t, func(c *config.Conf) {
+			fallback(c)
+			c.Quota.DailyBudget = 100
+		})
+		r.addFeed(t, "UC-allowed")
+		options := feedSearchOptions
+		options.MaxResults = 1
+		r.add(t, "Search", options, searchResponse("UC-allowed"))
+		r.expectGet(t, "/youtube/v3/search?part=snippet&channelId=UC-allowed&order=date&maxResults=1", http.StatusOK)
+		r.expectGet(t, feedSearchURI, http.StatusOK)
+		r.expectCalls(t, "Search", 1)
+		r.expectCalls(t, "Feed", 1)
+	})
+	t.Run("search unsupported by the feed keeps the quota error", func(t *testing.T) {
+		r := newRelay(t, fallback)
+		r.addFeed(t, "UC-allowed")
+		r.YouTube.Inject("Search", fake.Fault{Code: http.StatusForbidden, Reason: "quotaExceeded"})
+		w := r.expectGet(t, "/youtube/v3/search?part=snippet&channelId=UC-allowed&q=news", http.StatusInternalServerError)
+		if !strings.Contains(w.Body.String(), "quotaExceeded") {
+			t.Errorf("response(%s) should have the quota error", w.Body.String())
+		}
+		r.expectCalls(t, "Feed", 0)
+	})
+}
+
+func TestPrimaryFeed(t *testing.T) {
+	t.Run("playlist items are served by the feed", func(t *testing.T) {
+		r := newRelay(t, func(c *config.Conf) {
+			c.Whitelists.PlaylistMode = config.PlaylistChannelMode
+			c.Whitelists.ResponseMode = config.FilterMode
+			c.Upstream.Feed = &config.Feed{Mode: config.PrimaryFeed}
+		})
+		r.addFeed(t, "PL-allowed")
+		w := r.expectGet(t, "/youtube/v3/playlistItems?part=snippet,contentDetails&playlistId=PL-allowed", http.StatusOK)
+		var resp youtube.PlaylistItemListResponse
+		decode(t, w, &resp)
+		if len(resp.Items) != 1 || resp.Items[0].ContentDetails == nil || resp.Items[0].ContentDetails.VideoId != "video1" {
+			t.Errorf("response(%s) should only have video1", w.Body.String())
+		}
+		// the video of the other channel in the playlist is filtered in the channel mode
+		if got := w.Header().Get(route.FilteredIDsHeader); got != "guest1" {
+			t.Errorf("header %s is %q, want guest1", route.FilteredIDsHeader, got)
+		}
+		r.expectCalls(t, "ListPlaylistVideos", 0)
+		r.expectCalls(t, "Feed", 1)
+	})
+	t.Run("calls unsupported by the feed or failed by it go to YouTube", func(t *testing.T) {
+		r := newRelay(t, func(c *config.Conf) {
+			c.Upstream.Feed = &config.Feed{Mode: config.PrimaryFeed}
+		})
+		// search in the order of relevance isn't in the feed
+		r.addFeed(t, "UC-allowed")
+		r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+		r.expectGet(t, searchURI, http.StatusOK)
+		r.expectCalls(t, "Feed", 0)
+
+		// the playlist has no feed
+		r.add(t, "ListPlaylistVideos", playlistOptions, playlistResponse())
+		r.expectGet(t, playlistURI, http.StatusOK)
+		r.expectCalls(t, "Feed", 1)
+		r.expectCalls(t, "ListPlaylistVideos", 1)
+	})
+}
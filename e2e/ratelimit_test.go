@@ -0,0 +1,79 @@
+package e2e
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/config"
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestRateLimits(t *testing.T) {
+	byIP := config.RateLimitRule{Key: config.RateLimitByIP, RateLimit: config.RateLimit{Requests: 2, Period: time.Minute}}
+
+	t.Run("requests over the limit of the ip are rejected", func(t *testing.T) {
+		r := newRelay(t, func(c *config.Conf) {
+			c.RateLimits = []config.RateLimitRule{byIP}
+		})
+		r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+		// the client cannot pick its own limit by forwarding other ips without a trusted proxy
+		for i, forwarded := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+			req := httptest.NewRequest(http.MethodGet, searchURI, nil)
+			req.Header.Set("X-Forwarded-For", forwarded)
+			w := r.do(req)
+			if i < 2 {
+				if w.Code != http.StatusOK {
+					t.Fatalf("request(%d) responded with %d, want %d", i, w.Code, http.StatusOK)
+				}
+				continue
+			}
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("request(%d) responded with %d, want %d", i, w.Code, http.StatusTooManyRequests)
+			}
+			// a token of 2 per minute is refilled in 30 seconds
+			if got := w.Header().Get("Retry-After"); got != "30" {
+				t.Errorf("Retry-After is %q, want 30", got)
+			}
+		}
+	})
+	t.Run("forwarded ips of the trusted proxies are limited apart", func(t *testing.T) {
+		r := newRelay(t, func(c *config.Conf) {
+			c.RateLimits = []config.RateLimitRule{byIP}
+			c.Server.TrustedProxies = []string{"192.0.2.0/24"}
+		})
+		r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+		for _, forwarded := range []string{"198.51.100.1", "198.51.100.1", "198.51.100.2"} {
+			req := httptest.NewRequest(http.MethodGet, searchURI, nil)
+			req.Header.Set("X-Forwarded-For", forwarded)
+			if w := r.do(req); w.Code != http.StatusOK {
+				t.Fatalf("request of %s responded with %d, want %d", forwarded, w.Code, http.StatusOK)
+			}
+		}
+		req := httptest.NewRequest(http.MethodGet, searchURI, nil)
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		if w := r.do(req); w.Code != http.StatusTooManyRequests {
+			t.Errorf("third request of 198.51.100.1 responded with %d, want %d", w.Code, http.StatusTooManyRequests)
+		}
+	})
+	t.Run("requests denied by a rule are refunded to the others", func(t *testing.T) {
+		r := newRelay(t, func(c *config.Conf) {
+			c.RateLimits = []config.RateLimitRule{
+				byIP,
+				{Key: config.RateLimitByRoute, Routes: []string{"/youtube/v3/videos"}, RateLimit: config.RateLimit{Requests: 1, Period: time.Minute}},
+			}
+		})
+		uri := "/youtube/v3/videos?part=snippet&id=v1"
+		r.add(t, "ListByVideoIDs", ytrelay.Options{Part: "snippet", IDs: "v1"}, &youtube.VideoListResponse{
+			Items: []*youtube.Video{{Id: "v1", Snippet: &youtube.VideoSnippet{ChannelId: "UC-allowed"}}},
+		})
+		r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+		r.expectGet(t, uri, http.StatusOK)
+		r.expectGet(t, uri, http.StatusTooManyRequests)
+		// the ip has a request left, since the denied one is refunded
+		r.expectGet(t, searchURI, http.StatusOK)
+		r.expectGet(t, searchURI, http.StatusTooManyRequests)
+	})
+}
@@ -0,0 +1,125 @@
+package e2e
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/api"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/server/route"
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestSearchIsRelayedAndCached(t *testing.T) {
+	r := newRelay(t, nil)
+	r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+	for i := 0; i < 2; i++ {
+		w := r.expectGet(t, searchURI, http.StatusOK)
+		var resp youtube.SearchListResponse
+		decode(t, w, &resp)
+		if len(resp.Items) != 1 || resp.Items[0].Snippet.ChannelId != "UC-allowed" {
+			t.Errorf("response(%s) should have the video of UC-allowed", w.Body.String())
+		}
+	}
+	r.expectCalls(t, "Search", 1)
+}
+
+func TestSearchOutOfWhitelist(t *testing.T) {
+	t.Run("channel is rejected before YouTube", func(t *testing.T) {
+		r := newRelay(t, nil)
+		for i := 0; i < 2; i++ {
+			// the rejection is cached with its status
+			w := r.expectGet(t, rejectedSearchURI, http.StatusBadRequest)
+			var resp api.ErrorResp
+			decode(t, w, &resp)
+			if !strings.Contains(resp.Error, "UC-other") {
+				t.Errorf("error(%s) should name the channel", resp.Error)
+			}
+		}
+		r.expectCalls(t, "Search", 0)
+	})
+	t.Run("results are rejected", func(t *testing.T) {
+		r := newRelay(t, nil)
+		r.add(t, "Search", searchOptions, searchResponse("UC-allowed", "UC-other"))
+		r.expectGet(t, searchURI, http.StatusBadRequest)
+	})
+}
+
+func TestVideosOutOfWhitelist(t *testing.T) {
+	t.Run("rejected", func(t *testing.T) {
+		r := newRelay(t, nil)
+		r.add(t, "ListByVideoIDs", videosOptions, videosResponse())
+		r.expectGet(t, videosURI, http.StatusBadRequest)
+		r.expectCalls(t, "ListByVideoIDs", 1)
+	})
+	t.Run("filtered", func(t *testing.T) {
+		r := newRelay(t, func(c *config.Conf) {
+			c.Whitelists.ResponseMode = config.FilterMode
+		})
+		r.add(t, "ListByVideoIDs", videosOptions, videosResponse())
+		for i := 0; i < 2; i++ {
+			// the header of the filtered ids is cached with the response
+			w := r.expectGet(t, videosURI, http.StatusOK)
+			var resp youtube.VideoListResponse
+			decode(t, w, &resp)
+			if len(resp.Items) != 1 || resp.Items[0].Id != "v1" {
+				t.Errorf("response(%s) should only have v1", w.Body.String())
+			}
+			if got := w.Header().Get(route.FilteredIDsHeader); got != "v2" {
+				t.Errorf("header %s is %q, want v2", route.FilteredIDsHeader, got)
+			}
+		}
+		r.expectCalls(t, "ListByVideoIDs", 1)
+	})
+}
+
+func TestVideosWithoutSnippet(t *testing.T) {
+	r := newRelay(t, nil)
+
+	// the snippet is requested from YouTube to validate the channels
+	uri := "/youtube/v3/videos?part=statistics&id=v1,v2"
+	r.add(t, "ListByVideoIDs", ytrelay.Options{Part: "statistics,snippet", IDs: "v1,v2"}, videosResponse())
+	r.expectGet(t, uri, http.StatusBadRequest)
+
+	uri = "/youtube/v3/videos?part=id&id=v1"
+	r.add(t, "ListByVideoIDs", ytrelay.Options{Part: "id,snippet", IDs: "v1"}, &youtube.VideoListResponse{
+		Items: []*youtube.Video{{Id: "v1", Snippet: &youtube.VideoSnippet{ChannelId: "UC-allowed"}}},
+	})
+	w := r.expectGet(t, uri, http.StatusOK)
+	if strings.Contains(w.Body.String(), "snippet") {
+		t.Errorf("response(%s) should not have the snippet, which is not requested", w.Body.String())
+	}
+}
+
+func TestPlaylistItems(t *testing.T) {
+	r := newRelay(t, nil)
+	r.add(t, "ListPlaylistVideos", playlistOptions, playlistResponse())
+	r.expectGet(t, playlistURI, http.StatusOK)
+	r.expectGet(t, "/youtube/v3/playlistItems?part=snippet&playlistId=PL-other", http.StatusBadRequest)
+	r.expectCalls(t, "ListPlaylistVideos", 1)
+}
+
+func TestChannelPlaylists(t *testing.T) {
+	channelMode := func(c *config.Conf) {
+		c.Whitelists.PlaylistMode = config.PlaylistChannelMode
+	}
+
+	t.Run("playlists of whitelisted channels are relayed", func(t *testing.T) {
+		r := newRelay(t, channelMode)
+		uri := "/youtube/v3/playlistItems?part=snippet&playlistId=PL-other"
+		r.add(t, "ListPlaylistVideos", ytrelay.Options{Part: "snippet", PlaylistID: "PL-other"}, playlistResponse())
+		r.add(t, "GetPlaylistOwner", ytrelay.Options{PlaylistID: "PL-other"}, "UC-allowed")
+		r.expectGet(t, uri, http.StatusOK)
+		r.expectCalls(t, "GetPlaylistOwner", 1)
+	})
+	t.Run("items are validated with the snippet requested from YouTube", func(t *testing.T) {
+		r := newRelay(t, channelMode)
+		uri := "/youtube/v3/playlistItems?part=id&playlistId=PL-allowed"
+		resp := playlistResponse()
+		resp.Items[0].Snippet.VideoOwnerChannelId = "UC-other"
+		r.add(t, "ListPlaylistVideos", ytrelay.Options{Part: "id,snippet", PlaylistID: "PL-allowed"}, resp)
+		r.expectGet(t, uri, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,77 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mirror-media/yt-relay/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentSpanID = "00f067aa0ba902b7"
+	searchRoute  = "/youtube/v3/search"
+)
+
+// TestTracing checks that the spans of a request continue the trace of its traceparent
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = provider.Shutdown(context.Background())
+	})
+	if _, err := tracing.Init(context.Background(), nil); err != nil {
+		t.Fatalf("initializing tracing encountered error: %v", err)
+	}
+
+	r := newRelay(t, nil)
+	r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+	req := httptest.NewRequest(http.MethodGet, searchURI, nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+	if w := r.do(req); w.Code != http.StatusOK {
+		t.Fatalf("GET %s responded with %d, want %d", searchURI, w.Code, http.StatusOK)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, s := range exporter.GetSpans() {
+		if got := s.SpanContext.TraceID().String(); got != traceID {
+			t.Errorf("span(%s) is in the trace(%s), want %s", s.Name, got, traceID)
+		}
+		spans[s.Name] = s
+	}
+	// the span of the route continues the incoming trace, and the others are its children
+	server, ok := spans[searchRoute]
+	if !ok {
+		t.Fatalf("spans(%v) have no span of the route", exporter.GetSpans())
+	}
+	if got := server.Parent.SpanID().String(); got != parentSpanID || !server.Parent.IsRemote() {
+		t.Errorf("span of the route has the parent(%s), want the remote %s", got, parentSpanID)
+	}
+	for _, name := range []string{"cache.lookup", "YouTubeServiceV3.Search", "cache.save"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("span(%s) isn't recorded", name)
+			continue
+		}
+		if span.Parent.SpanID() != server.SpanContext.SpanID() {
+			t.Errorf("span(%s) has the parent(%s), want the span of the route(%s)", name, span.Parent.SpanID(), server.SpanContext.SpanID())
+		}
+	}
+
+	// the cache hit doesn't call YouTube
+	exporter.Reset()
+	r.expectGet(t, searchURI, http.StatusOK)
+	for _, s := range exporter.GetSpans() {
+		if s.Name == "YouTubeServiceV3.Search" {
+			t.Errorf("cache hit is traced calling YouTube")
+		}
+	}
+}
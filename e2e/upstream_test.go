@@ -0,0 +1,156 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/middleware"
+	"github.com/mirror-media/yt-relay/relay"
+	"github.com/mirror-media/yt-relay/relay/fake"
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestYouTubeErrorsAreCached(t *testing.T) {
+	r := newRelay(t, nil)
+	r.YouTube.AddError("Search", searchOptions, http.StatusForbidden, "quotaExceeded")
+	for i := 0; i < 2; i++ {
+		w := r.expectGet(t, searchURI, http.StatusInternalServerError)
+		if !strings.Contains(w.Body.String(), "quotaExceeded") {
+			t.Errorf("response(%s) should have the reason of YouTube", w.Body.String())
+		}
+	}
+	r.expectCalls(t, "Search", 1)
+}
+
+func TestFixtures(t *testing.T) {
+	t.Run("calls without fixtures are not found by YouTube", func(t *testing.T) {
+		r := newRelay(t, nil)
+		w := r.expectGet(t, searchURI, http.StatusInternalServerError)
+		if !strings.Contains(w.Body.String(), relay.ErrFixtureNotFound.Error()) {
+			t.Errorf("response(%s) should tell the fixture is missing", w.Body.String())
+		}
+	})
+	t.Run("fixtures recorded in the dir are served", func(t *testing.T) {
+		r := newRelay(t, nil)
+		response, err := json.Marshal(searchResponse("UC-allowed"))
+		if err != nil {
+			t.Fatalf("marshalling response encountered error: %v", err)
+		}
+		key := relay.FixtureKey("Search", searchOptions)
+		body, err := json.Marshal(relay.Fixture{Key: key, Response: response})
+		if err != nil {
+			t.Fatalf("marshalling fixture encountered error: %v", err)
+		}
+		if err = os.MkdirAll(r.fixtureDir(), 0755); err != nil {
+			t.Fatalf("creating fixture dir encountered error: %v", err)
+		}
+		if err = ioutil.WriteFile(relay.FixturePath(r.fixtureDir(), "Search", key), body, 0644); err != nil {
+			t.Fatalf("writing fixture encountered error: %v", err)
+		}
+		r.expectGet(t, searchURI, http.StatusOK)
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	r := newRelay(t, func(c *config.Conf) {
+		c.Upstream.Timeout = 100 * time.Millisecond
+	})
+	r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+	r.YouTube.Inject("Search", fake.Fault{Latency: time.Second})
+	r.expectGet(t, searchURI, http.StatusGatewayTimeout)
+
+	// timeouts aren't cached
+	r.YouTube.Reset()
+	r.expectGet(t, searchURI, http.StatusOK)
+	r.expectCalls(t, "Search", 1)
+}
+
+func TestDisabledAPIs(t *testing.T) {
+	r := newRelay(t, func(c *config.Conf) {
+		c.Cache.DisabledAPIs = map[string]bool{"/youtube/v3/search": true}
+	})
+	r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+	for i := 0; i < 2; i++ {
+		r.expectGet(t, searchURI, http.StatusOK)
+	}
+	r.expectCalls(t, "Search", 2)
+}
+
+func TestStaleCopies(t *testing.T) {
+	r := newRelay(t, func(c *config.Conf) {
+		c.Cache.StaleTTL = 60
+	})
+	r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+	r.expectGet(t, searchURI, http.StatusOK)
+
+	r.purge(t, searchURI)
+	r.YouTube.Inject("Search", fake.Fault{Code: http.StatusServiceUnavailable, Reason: "backendError"})
+	w := r.expectGet(t, searchURI, http.StatusOK)
+	if w.Header().Get(middleware.StaleHeader) != "true" {
+		t.Errorf("response should be marked by %s", middleware.StaleHeader)
+	}
+	r.expectCalls(t, "Search", 2)
+}
+
+func TestRetries(t *testing.T) {
+	r := newRelay(t, func(c *config.Conf) {
+		c.Upstream.Retry = &config.Retry{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	})
+	r.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+	r.YouTube.Inject("Search", fake.Fault{Code: http.StatusServiceUnavailable, Reason: "backendError", Times: 1})
+	r.expectGet(t, searchURI, http.StatusOK)
+	r.expectCalls(t, "Search", 2)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	r := newRelay(t, func(c *config.Conf) {
+		c.Cache.DisabledAPIs = map[string]bool{"/youtube/v3/search": true}
+		c.Upstream.CircuitBreaker = &config.CircuitBreaker{FailureThreshold: 2, OpenTimeout: time.Minute}
+	})
+	r.YouTube.Inject("Search", fake.Fault{Code: http.StatusInternalServerError, Reason: "backendError"})
+	for i := 0; i < 2; i++ {
+		r.expectGet(t, searchURI, http.StatusInternalServerError)
+	}
+	r.expectGet(t, searchURI, http.StatusServiceUnavailable)
+	r.expectCalls(t, "Search", 2)
+}
+
+func TestRecordAndReplayFixtures(t *testing.T) {
+	dir := t.TempDir()
+
+	recorder := newRelay(t, func(c *config.Conf) {
+		c.Upstream.Fixtures = &config.Fixtures{Mode: config.RecordFixtures, Dir: dir}
+	})
+	recorder.add(t, "Search", searchOptions, searchResponse("UC-allowed"))
+	recorder.expectGet(t, searchURI, http.StatusOK)
+	recorder.expectCalls(t, "Search", 1)
+	if _, err := os.Stat(relay.FixturePath(dir, "Search", relay.FixtureKey("Search", searchOptions))); err != nil {
+		t.Fatalf("fixture of the search isn't recorded: %v", err)
+	}
+
+	// the replay needs no api key, and a search over the budget isn't charged
+	replayer := newRelay(t, func(c *config.Conf) {
+		c.ApiKey = ""
+		c.Quota.DailyBudget = 1
+		c.Upstream.Fixtures = &config.Fixtures{Mode: config.ReplayFixtures, Dir: dir}
+	})
+	replayer.YouTube.Close()
+	w := replayer.expectGet(t, searchURI, http.StatusOK)
+	var resp youtube.SearchListResponse
+	decode(t, w, &resp)
+	if len(resp.Items) != 1 || resp.Items[0].Snippet.ChannelId != "UC-allowed" {
+		t.Errorf("response(%s) should be the recorded one", w.Body.String())
+	}
+	replayer.expectGet(t, "/youtube/v3/search?part=snippet&channelId=UC-allowed&q=missing", http.StatusNotFound)
+	replayer.expectCalls(t, "Search", 0)
+	if usage, err := replayer.tenant.Quota.Usage(context.Background()); err != nil || usage != 0 {
+		t.Errorf("quota usage is %d(%v), want 0", usage, err)
+	}
+}
@@ -0,0 +1,162 @@
+package feed
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// atomFeed is the feed of the uploads of a channel or of the videos of a playlist
+type atomFeed struct {
+	// ChannelID is the owner of the playlist for the feeds of playlists
+	ChannelID  string      `xml:"http://www.youtube.com/xml/schemas/2015 channelId"`
+	PlaylistID string      `xml:"http://www.youtube.com/xml/schemas/2015 playlistId"`
+	Title      string      `xml:"http://www.w3.org/2005/Atom title"`
+	Author     atomAuthor  `xml:"http://www.w3.org/2005/Atom author"`
+	Entries    []atomEntry `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"http://www.w3.org/2005/Atom name"`
+	URI  string `xml:"http://www.w3.org/2005/Atom uri"`
+}
+
+// atomEntry is a video, and the entries are in the order of publication with the latest first
+type atomEntry struct {
+	ID        string     `xml:"http://www.w3.org/2005/Atom id"`
+	VideoID   string     `xml:"http://www.youtube.com/xml/schemas/2015 videoId"`
+	ChannelID string     `xml:"http://www.youtube.com/xml/schemas/2015 channelId"`
+	Title     string     `xml:"http://www.w3.org/2005/Atom title"`
+	Author    atomAuthor `xml:"http://www.w3.org/2005/Atom author"`
+	Published string     `xml:"http://www.w3.org/2005/Atom published"`
+	Group     mediaGroup `xml:"http://search.yahoo.com/mrss/ group"`
+}
+
+type mediaGroup struct {
+	Description string         `xml:"http://search.yahoo.com/mrss/ description"`
+	Thumbnail   mediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type mediaThumbnail struct {
+	URL    string `xml:"url,attr"`
+	Width  int64  `xml:"width,attr"`
+	Height int64  `xml:"height,attr"`
+}
+
+// publishedAt formats the time in UTC as the Data API does, e.g. 2021-10-01T08:00:00Z
+func (e atomEntry) publishedAt() string {
+	t, err := time.Parse(time.RFC3339, e.Published)
+	if err != nil {
+		return e.Published
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// thumbnails returns the high thumbnail of the feed, and the default and medium ones of the same video, which the feed doesn't list
+func (e atomEntry) thumbnails() *youtube.ThumbnailDetails {
+	thumbnail := e.Group.Thumbnail
+	if thumbnail.URL == "" {
+		return nil
+	}
+	details := &youtube.ThumbnailDetails{
+		High: &youtube.Thumbnail{Url: thumbnail.URL, Width: thumbnail.Width, Height: thumbnail.Height},
+	}
+	if base := strings.TrimSuffix(thumbnail.URL, "hqdefault.jpg"); base != thumbnail.URL {
+		details.Default = &youtube.Thumbnail{Url: base + "default.jpg", Width: 120, Height: 90}
+		details.Medium = &youtube.Thumbnail{Url: base + "mqdefault.jpg", Width: 320, Height: 180}
+	}
+	return details
+}
+
+// feedSize is the number of the latest videos in a feed
+const feedSize = 15
+
+// limit returns the first entries up to maxResults, which is 5 by default as the Data API.
+// It returns ErrUnsupported if a full feed has fewer entries than maxResults, since the older videos are only in the Data API.
+func limit(entries []atomEntry, maxResults int64) ([]atomEntry, error) {
+	if maxResults <= 0 {
+		maxResults = 5
+	}
+	if int64(len(entries)) > maxResults {
+		return entries[:maxResults], nil
+	}
+	if len(entries) >= feedSize && int64(len(entries)) < maxResults {
+		return nil, fmt.Errorf("%w: maxResults(%d) is more than the feed has", ErrUnsupported, maxResults)
+	}
+	return entries, nil
+}
+
+func pageInfo(total int, perPage int) *youtube.PageInfo {
+	return &youtube.PageInfo{TotalResults: int64(total), ResultsPerPage: int64(perPage)}
+}
+
+// searchListResponse converts the feed of a channel into the response of search.list with the parts
+func searchListResponse(feed *atomFeed, parts map[string]bool, maxResults int64) (*youtube.SearchListResponse, error) {
+	entries, err := limit(feed.Entries, maxResults)
+	if err != nil {
+		return nil, err
+	}
+	resp := &youtube.SearchListResponse{
+		Kind:     "youtube#searchListResponse",
+		PageInfo: pageInfo(len(feed.Entries), len(entries)),
+		Items:    make([]*youtube.SearchResult, 0, len(entries)),
+	}
+	for _, e := range entries {
+		item := &youtube.SearchResult{
+			Kind: "youtube#searchResult",
+			Id:   &youtube.ResourceId{Kind: "youtube#video", VideoId: e.VideoID},
+		}
+		if parts["snippet"] {
+			item.Snippet = &youtube.SearchResultSnippet{
+				PublishedAt:          e.publishedAt(),
+				ChannelId:            e.ChannelID,
+				Title:                e.Title,
+				Description:          e.Group.Description,
+				Thumbnails:           e.thumbnails(),
+				ChannelTitle:         e.Author.Name,
+				LiveBroadcastContent: "none",
+			}
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	return resp, nil
+}
+
+// playlistItemListResponse converts the feed of a playlist into the response of playlistItems.list with the parts
+func playlistItemListResponse(feed *atomFeed, parts map[string]bool, maxResults int64) (*youtube.PlaylistItemListResponse, error) {
+	entries, err := limit(feed.Entries, maxResults)
+	if err != nil {
+		return nil, err
+	}
+	resp := &youtube.PlaylistItemListResponse{
+		Kind:     "youtube#playlistItemListResponse",
+		PageInfo: pageInfo(len(feed.Entries), len(entries)),
+		Items:    make([]*youtube.PlaylistItem, 0, len(entries)),
+	}
+	for i, e := range entries {
+		// the feed has no ids of the playlist items, so the ids of the entries stand in for them
+		item := &youtube.PlaylistItem{Kind: "youtube#playlistItem", Id: e.ID}
+		if parts["snippet"] {
+			item.Snippet = &youtube.PlaylistItemSnippet{
+				PublishedAt:            e.publishedAt(),
+				ChannelId:              feed.ChannelID,
+				Title:                  e.Title,
+				Description:            e.Group.Description,
+				Thumbnails:             e.thumbnails(),
+				ChannelTitle:           feed.Author.Name,
+				PlaylistId:             feed.PlaylistID,
+				Position:               int64(i),
+				ResourceId:             &youtube.ResourceId{Kind: "youtube#video", VideoId: e.VideoID},
+				VideoOwnerChannelId:    e.ChannelID,
+				VideoOwnerChannelTitle: e.Author.Name,
+			}
+		}
+		if parts["contentDetails"] {
+			item.ContentDetails = &youtube.PlaylistItemContentDetails{VideoId: e.VideoID, VideoPublishedAt: e.publishedAt()}
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	return resp, nil
+}
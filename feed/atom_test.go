@@ -0,0 +1,210 @@
+package feed
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// readFeeds decodes the feeds recorded for the end-to-end tests
+func readFeeds(t *testing.T) map[string]*atomFeed {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("..", "e2e", "testdata", "feeds", "*.xml"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("listing feeds found %d feed(s): %v", len(paths), err)
+	}
+	feeds := make(map[string]*atomFeed)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("opening feed encountered error: %v", err)
+		}
+		feed := &atomFeed{}
+		err = xml.NewDecoder(f).Decode(feed)
+		_ = f.Close()
+		if err != nil {
+			t.Fatalf("feed(%s) is malformed: %v", path, err)
+		}
+		feeds[strings.TrimSuffix(filepath.Base(path), ".xml")] = feed
+	}
+	return feeds
+}
+
+// expectThumbnails checks the thumbnails converted from the high thumbnail of the entry
+func expectThumbnails(t *testing.T, e atomEntry, thumbnails *youtube.ThumbnailDetails) {
+	t.Helper()
+	if thumbnails == nil || thumbnails.High == nil || thumbnails.High.Url != e.Group.Thumbnail.URL {
+		t.Fatalf("thumbnails(%+v) should have the high thumbnail(%s)", thumbnails, e.Group.Thumbnail.URL)
+	}
+	base := strings.TrimSuffix(e.Group.Thumbnail.URL, "hqdefault.jpg")
+	if thumbnails.Default == nil || thumbnails.Default.Url != base+"default.jpg" {
+		t.Errorf("default thumbnail(%+v) should be at %sdefault.jpg", thumbnails.Default, base)
+	}
+	if thumbnails.Medium == nil || thumbnails.Medium.Url != base+"mqdefault.jpg" || thumbnails.Medium.Width != 320 {
+		t.Errorf("medium thumbnail(%+v) should be at %smqdefault.jpg", thumbnails.Medium, base)
+	}
+}
+
+// expectPublishedAt checks that publishedAt is the publication of the entry in UTC
+func expectPublishedAt(t *testing.T, e atomEntry, publishedAt string) {
+	t.Helper()
+	want, err := time.Parse(time.RFC3339, e.Published)
+	if err != nil {
+		t.Fatalf("publication(%s) of the feed is malformed: %v", e.Published, err)
+	}
+	got, err := time.Parse(time.RFC3339, publishedAt)
+	if err != nil || !got.Equal(want) || !strings.HasSuffix(publishedAt, "Z") {
+		t.Errorf("publishedAt is %s, want %s in UTC", publishedAt, e.Published)
+	}
+}
+
+func TestSearchListResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		parts      map[string]bool
+		maxResults int64
+	}{
+		{name: "id", parts: map[string]bool{"id": true}, maxResults: 1},
+		{name: "snippet", parts: map[string]bool{"snippet": true}, maxResults: 2},
+		{name: "id and snippet by default", parts: map[string]bool{"id": true, "snippet": true}},
+	}
+	for id, feed := range readFeeds(t) {
+		for _, tt := range tests {
+			t.Run(id+"/"+tt.name, func(t *testing.T) {
+				resp, err := searchListResponse(feed, tt.parts, tt.maxResults)
+				if err != nil {
+					t.Fatalf("converting feed encountered error: %v", err)
+				}
+				entries, _ := limit(feed.Entries, tt.maxResults)
+				if len(resp.Items) != len(entries) || resp.PageInfo.TotalResults != int64(len(feed.Entries)) {
+					t.Fatalf("response has %d of %d item(s), want %d of %d", len(resp.Items), resp.PageInfo.TotalResults, len(entries), len(feed.Entries))
+				}
+				for i, item := range resp.Items {
+					e := entries[i]
+					if item.Id == nil || item.Id.VideoId != e.VideoID {
+						t.Errorf("item(%d) has id(%+v), want video(%s)", i, item.Id, e.VideoID)
+					}
+					if !tt.parts["snippet"] {
+						if item.Snippet != nil {
+							t.Errorf("item(%d) has the snippet, which is not requested", i)
+						}
+						continue
+					}
+					if item.Snippet == nil {
+						t.Fatalf("item(%d) has no snippet", i)
+					}
+					if item.Snippet.ChannelId != e.ChannelID || item.Snippet.Title != e.Title || item.Snippet.Description != e.Group.Description {
+						t.Errorf("snippet(%+v) isn't converted from the entry(%+v)", item.Snippet, e)
+					}
+					expectPublishedAt(t, e, item.Snippet.PublishedAt)
+					expectThumbnails(t, e, item.Snippet.Thumbnails)
+				}
+			})
+		}
+	}
+}
+
+func TestPlaylistItemListResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		parts      map[string]bool
+		maxResults int64
+	}{
+		{name: "id", parts: map[string]bool{"id": true}},
+		{name: "snippet", parts: map[string]bool{"snippet": true}, maxResults: 1},
+		{name: "contentDetails", parts: map[string]bool{"contentDetails": true}},
+		{name: "snippet and contentDetails", parts: map[string]bool{"snippet": true, "contentDetails": true}, maxResults: 15},
+	}
+	for id, feed := range readFeeds(t) {
+		for _, tt := range tests {
+			t.Run(id+"/"+tt.name, func(t *testing.T) {
+				resp, err := playlistItemListResponse(feed, tt.parts, tt.maxResults)
+				if err != nil {
+					t.Fatalf("converting feed encountered error: %v", err)
+				}
+				entries, _ := limit(feed.Entries, tt.maxResults)
+				if len(resp.Items) != len(entries) {
+					t.Fatalf("response has %d item(s), want %d", len(resp.Items), len(entries))
+				}
+				for i, item := range resp.Items {
+					e := entries[i]
+					if item.Id != e.ID {
+						t.Errorf("item(%d) has id(%s), want %s", i, item.Id, e.ID)
+					}
+					if tt.parts["snippet"] != (item.Snippet != nil) || tt.parts["contentDetails"] != (item.ContentDetails != nil) {
+						t.Fatalf("item(%d) has snippet(%v) and contentDetails(%v), want the requested parts", i, item.Snippet != nil, item.ContentDetails != nil)
+					}
+					if item.Snippet != nil {
+						if item.Snippet.PlaylistId != feed.PlaylistID || item.Snippet.VideoOwnerChannelId != e.ChannelID || item.Snippet.Position != int64(i) ||
+							item.Snippet.ResourceId == nil || item.Snippet.ResourceId.VideoId != e.VideoID {
+							t.Errorf("snippet(%+v) isn't converted from the entry(%+v)", item.Snippet, e)
+						}
+						expectPublishedAt(t, e, item.Snippet.PublishedAt)
+						expectThumbnails(t, e, item.Snippet.Thumbnails)
+					}
+					if item.ContentDetails != nil {
+						if item.ContentDetails.VideoId != e.VideoID {
+							t.Errorf("contentDetails has video(%s), want %s", item.ContentDetails.VideoId, e.VideoID)
+						}
+						expectPublishedAt(t, e, item.ContentDetails.VideoPublishedAt)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPublishedAt(t *testing.T) {
+	tests := []struct {
+		published string
+		want      string
+	}{
+		{published: "2021-10-01T10:00:00+00:00", want: "2021-10-01T10:00:00Z"},
+		{published: "2021-10-01T18:00:00+08:00", want: "2021-10-01T10:00:00Z"},
+		{published: "2021-10-01T10:00:00Z", want: "2021-10-01T10:00:00Z"},
+		{published: "yesterday", want: "yesterday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.published, func(t *testing.T) {
+			if got := (atomEntry{Published: tt.published}).publishedAt(); got != tt.want {
+				t.Errorf("publishedAt() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		entries       int
+		maxResults    int64
+		want          int
+		isUnsupported bool
+	}{
+		{name: "5 by default", entries: feedSize, want: 5},
+		{name: "fewer than the feed has", entries: feedSize, maxResults: 2, want: 2},
+		{name: "all the feed has", entries: feedSize, maxResults: feedSize, want: feedSize},
+		{name: "more than a full feed has", entries: feedSize, maxResults: 50, isUnsupported: true},
+		{name: "more than a partial feed has", entries: 3, maxResults: 50, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := limit(make([]atomEntry, tt.entries), tt.maxResults)
+			if tt.isUnsupported {
+				if !errors.Is(err, ErrUnsupported) {
+					t.Errorf("limit() error = %v, want ErrUnsupported", err)
+				}
+				return
+			}
+			if err != nil || len(entries) != tt.want {
+				t.Errorf("limit() = %d entries, %v, want %d", len(entries), err, tt.want)
+			}
+		})
+	}
+}
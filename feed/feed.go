@@ -0,0 +1,161 @@
+// Package feed serves the latest uploads of channels and playlists from the RSS feeds of YouTube, which cost no Data API quota
+package feed
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrUnsupported is returned for the calls which the feeds cannot serve, e.g. search with q or with a page token
+var ErrUnsupported = errors.New("call is not supported by the feeds")
+
+// maxFeedSize bounds the body of a feed, which is tens of KB
+const maxFeedSize = 4 << 20
+
+// Feed implements VideoRelay with the Atom feeds, which have the latest 15 videos of a channel or a playlist.
+// It supports search of the uploads of a channel in the order of date, and the items of a playlist, both without pages.
+type Feed struct {
+	url    string
+	client *http.Client
+}
+
+// NewFeed creates the relay of the feeds at conf.URL, or at DefaultFeedURL if it's empty.
+// The fetches time out after timeout, or after DefaultUpstreamTimeout if it's not positive.
+func NewFeed(conf config.Feed, timeout time.Duration) *Feed {
+	u := conf.URL
+	if u == "" {
+		u = config.DefaultFeedURL
+	}
+	if timeout <= 0 {
+		timeout = config.DefaultUpstreamTimeout
+	}
+	return &Feed{url: u, client: &http.Client{Timeout: timeout}}
+}
+
+// fetch gets the feed of the channel or the playlist, which is selected by the param, i.e. channel_id or playlist_id
+func (f *Feed) fetch(ctx context.Context, param string, id string) (feed *atomFeed, err error) {
+	ctx, span := tracing.Start(ctx, "Feed.fetch", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("feed."+param, id)))
+	defer func() { tracing.End(span, err) }()
+
+	u, err := url.Parse(f.url)
+	if err != nil {
+		return nil, fmt.Errorf("feed url(%s) is invalid: %v", f.url, err)
+	}
+	query := u.Query()
+	query.Set(param, id)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxFeedSize))
+		return nil, fmt.Errorf("feed of %s(%s) responded with %d", param, id, resp.StatusCode)
+	}
+
+	feed = &atomFeed{}
+	if err = xml.NewDecoder(io.LimitReader(resp.Body, maxFeedSize)).Decode(feed); err != nil {
+		return nil, fmt.Errorf("feed of %s(%s) is malformed: %v", param, id, err)
+	}
+	return feed, nil
+}
+
+// partsOf returns the parts, and ErrUnsupported if any of them isn't supported
+func partsOf(part string, supported ...string) (map[string]bool, error) {
+	isSupported := make(map[string]bool)
+	for _, s := range supported {
+		isSupported[s] = true
+	}
+	parts := make(map[string]bool)
+	for _, p := range strings.Split(part, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if !isSupported[p] {
+			return nil, fmt.Errorf("%w: part(%s) is not in the feeds", ErrUnsupported, p)
+		}
+		parts[p] = true
+	}
+	return parts, nil
+}
+
+// Search supports the latest uploads of a channel, i.e. the parameters channelId and order=date, with part, maxResults, type=video and safeSearch.
+// More results than a full feed has are unsupported.
+func (f *Feed) Search(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	switch {
+	case options.ChannelID == "":
+		return nil, fmt.Errorf("%w: search without channelId", ErrUnsupported)
+	case options.Order != "date":
+		return nil, fmt.Errorf("%w: search in the order(%s)", ErrUnsupported, options.Order)
+	case options.Query != "", options.EventType != "", options.PageToken != "":
+		return nil, fmt.Errorf("%w: search with q, eventType or pageToken", ErrUnsupported)
+	case options.Type != "" && options.Type != "video":
+		return nil, fmt.Errorf("%w: search of the type(%s)", ErrUnsupported, options.Type)
+	}
+	parts, err := partsOf(options.Part, "id", "snippet")
+	if err != nil {
+		return nil, err
+	}
+	feed, err := f.fetch(ctx, "channel_id", options.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	return searchListResponse(feed, parts, options.MaxResults)
+}
+
+// ListByVideoIDs is not supported, since there are no feeds of videos
+func (f *Feed) ListByVideoIDs(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return nil, fmt.Errorf("%w: videos", ErrUnsupported)
+}
+
+// ListPlaylistVideos supports the latest items of a playlist with the parameters part, playlistId and maxResults.
+// More items than a full feed has are unsupported.
+func (f *Feed) ListPlaylistVideos(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	switch {
+	case options.PlaylistID == "":
+		return nil, fmt.Errorf("%w: playlistItems without playlistId", ErrUnsupported)
+	case options.PageToken != "":
+		return nil, fmt.Errorf("%w: playlistItems with pageToken", ErrUnsupported)
+	}
+	parts, err := partsOf(options.Part, "id", "snippet", "contentDetails")
+	if err != nil {
+		return nil, err
+	}
+	feed, err := f.fetch(ctx, "playlist_id", options.PlaylistID)
+	if err != nil {
+		return nil, err
+	}
+	return playlistItemListResponse(feed, parts, options.MaxResults)
+}
+
+// GetPlaylistOwner returns the channel id of the feed of the playlist
+func (f *Feed) GetPlaylistOwner(ctx context.Context, playlistID string) (string, error) {
+	feed, err := f.fetch(ctx, "playlist_id", playlistID)
+	if err != nil {
+		return "", err
+	}
+	if feed.ChannelID == "" {
+		return "", fmt.Errorf("feed of playlist(%s) has no channel id", playlistID)
+	}
+	return feed.ChannelID, nil
+}
@@ -0,0 +1,114 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/metrics"
+	"github.com/mirror-media/yt-relay/quota"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+)
+
+// quotaReasons are the reasons of the errors of the Data API when the quota of the api key runs out
+var quotaReasons = map[string]bool{
+	"quotaExceeded":         true,
+	"dailyLimitExceeded":    true,
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+}
+
+// isQuotaExceeded tells if the quota runs out, either the daily budget of the tenant or the quota of Google
+func isQuotaExceeded(err error) bool {
+	if errors.Is(err, quota.ErrBudgetExceeded) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		if quotaReasons[item.Reason] {
+			return true
+		}
+	}
+	return false
+}
+
+// Relay wraps the VideoRelay of the Data API to serve the calls supported by the feeds from them, which cost no quota.
+// The feeds are called first in the primary mode, and only after the quota runs out in the fallback mode.
+type Relay struct {
+	ytrelay.VideoRelay
+	feed   *Feed
+	mode   config.FeedMode
+	tenant string
+}
+
+// New wraps the relay of the tenant with the feeds of the configuration, which are fetched within timeout
+func New(relay ytrelay.VideoRelay, conf config.Feed, timeout time.Duration, tenant string) *Relay {
+	return &Relay{
+		VideoRelay: relay,
+		feed:       NewFeed(conf, timeout),
+		mode:       conf.Mode,
+		tenant:     tenant,
+	}
+}
+
+func (r *Relay) call(method string, api func() (interface{}, error), feed func() (interface{}, error)) (interface{}, error) {
+	if r.mode == config.PrimaryFeed {
+		resp, err := feed()
+		if err == nil {
+			metrics.FeedCalls.WithLabelValues(r.tenant, method, string(r.mode)).Inc()
+			return resp, nil
+		}
+		if !errors.Is(err, ErrUnsupported) {
+			log.Warnf("feed failed to serve %s, which is called with the Data API: %v", method, err)
+		}
+		return api()
+	}
+
+	resp, err := api()
+	if err == nil || !isQuotaExceeded(err) {
+		return resp, err
+	}
+	feedResp, feedErr := feed()
+	if feedErr != nil {
+		if !errors.Is(feedErr, ErrUnsupported) {
+			log.Errorf("feed failed to serve %s after the quota ran out: %v", method, feedErr)
+		}
+		// the quota error is returned, so it's handled as if there were no feeds
+		return resp, err
+	}
+	log.Infof("%s is served by the feed since the quota ran out: %v", method, err)
+	metrics.FeedCalls.WithLabelValues(r.tenant, method, string(r.mode)).Inc()
+	return feedResp, nil
+}
+
+func (r *Relay) Search(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.call("Search", func() (interface{}, error) { return r.VideoRelay.Search(ctx, options) }, func() (interface{}, error) { return r.feed.Search(ctx, options) })
+}
+
+// ListByVideoIDs is always called with the Data API
+func (r *Relay) ListByVideoIDs(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.VideoRelay.ListByVideoIDs(ctx, options)
+}
+
+func (r *Relay) ListPlaylistVideos(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.call("ListPlaylistVideos", func() (interface{}, error) { return r.VideoRelay.ListPlaylistVideos(ctx, options) }, func() (interface{}, error) { return r.feed.ListPlaylistVideos(ctx, options) })
+}
+
+// GetPlaylistOwner implements PlaylistOwnerResolver if the wrapped relay does
+func (r *Relay) GetPlaylistOwner(ctx context.Context, playlistID string) (string, error) {
+	resolver, ok := r.VideoRelay.(ytrelay.PlaylistOwnerResolver)
+	if !ok {
+		return "", errors.New("the relay cannot resolve the owner of playlists")
+	}
+	resp, err := r.call("GetPlaylistOwner", func() (interface{}, error) { return resolver.GetPlaylistOwner(ctx, playlistID) }, func() (interface{}, error) { return r.feed.GetPlaylistOwner(ctx, playlistID) })
+	if err != nil {
+		return "", err
+	}
+	return resp.(string), nil
+}
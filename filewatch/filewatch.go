@@ -0,0 +1,55 @@
+// Package filewatch watches files by polling their modification time and size.
+// Polling follows symlinks, so it also works with the files mounted from Kubernetes ConfigMaps and Secrets.
+package filewatch
+
+import (
+	"context"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type state struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+func stat(path string) state {
+	info, err := os.Stat(path)
+	if err != nil {
+		return state{}
+	}
+	return state{modTime: info.ModTime(), size: info.Size(), exists: true}
+}
+
+// Watch polls the files every interval and calls onChange when any of them is changed, created or removed.
+// It blocks until ctx is done.
+func Watch(ctx context.Context, interval time.Duration, onChange func(), paths ...string) {
+	states := make([]state, len(paths))
+	for i, p := range paths {
+		states[i] = stat(p)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed := false
+			for i, p := range paths {
+				if s := stat(p); s != states[i] {
+					log.Infof("file(%s) is changed", p)
+					states[i] = s
+					changed = true
+				}
+			}
+			if changed {
+				onChange()
+			}
+		}
+	}
+}
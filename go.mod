@@ -3,10 +3,19 @@ module github.com/mirror-media/yt-relay
 go 1.15
 
 require (
-	github.com/gin-gonic/gin v1.6.3
-	github.com/go-redis/redis/v8 v8.8.0
+	github.com/alicebob/miniredis/v2 v2.14.3
+	github.com/gin-gonic/gin v1.7.7
+	github.com/go-redis/redis/v8 v8.11.4
+	github.com/golang-jwt/jwt/v4 v4.4.3
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.11.1
 	github.com/sirupsen/logrus v1.8.1
-	google.golang.org/api v0.32.0
-	gopkg.in/yaml.v2 v2.3.0
+	go.etcd.io/bbolt v1.3.7
+	go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin v0.25.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	google.golang.org/api v0.40.0
+	gopkg.in/yaml.v2 v2.4.0
 )
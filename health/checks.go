@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/quota"
+	"github.com/mirror-media/yt-relay/resilience"
+)
+
+// probeKey is read from the cache, which is expected to miss
+const probeKey = "yt-relay:health"
+
+// Redis pings redis. The nodes are reported if redis is the replica type.
+func Redis(rdb cache.Rediser) Check {
+	return func(ctx context.Context) Component {
+		if err := cache.Ping(ctx, rdb); err != nil {
+			return errorComponent(err)
+		}
+		component := Component{Status: OK}
+		if reporter, ok := rdb.(cache.StatsReporter); ok {
+			component.Details = reporter.Stats()
+		}
+		return component
+	}
+}
+
+// Cache reads a key from the cache provider, which checks the embedded and memory backends as well
+func Cache(provider cache.Provider) Check {
+	return func(ctx context.Context) Component {
+		if _, err := provider.Get(ctx, probeKey); err != nil && err != cache.ErrCacheMiss {
+			return errorComponent(err)
+		}
+		return Component{Status: OK}
+	}
+}
+
+// Breakers reports the circuit breakers of the relay. It's degraded if any breaker isn't closed.
+func Breakers(relay *resilience.Relay) Check {
+	return func(ctx context.Context) Component {
+		states := relay.BreakerStates()
+		component := Component{Status: OK, Details: states}
+		for _, state := range states {
+			if state != resilience.Closed {
+				component.Status = Degraded
+			}
+		}
+		return component
+	}
+}
+
+// Quota reports the usage of the daily budget. It's degraded if the budget is exhausted or the usage is unknown.
+func Quota(tracker *quota.Tracker) Check {
+	return func(ctx context.Context) Component {
+		usage, err := tracker.Usage(ctx)
+		if err != nil {
+			return Component{Status: Degraded, Error: err.Error()}
+		}
+		details := map[string]int64{"usage": usage, "budget": tracker.Budget()}
+		if tracker.Budget() > 0 && usage >= tracker.Budget() {
+			return Component{Status: Degraded, Error: quota.ErrBudgetExceeded.Error(), Details: details}
+		}
+		return Component{Status: OK, Details: details}
+	}
+}
+
+// Upstream lists a video on YouTube, and caches the result for the interval of the probe, so a revoked api key makes the relay unready
+func Upstream(relay ytrelay.VideoRelay, probe config.UpstreamProbe) Check {
+	interval := probe.Interval
+	if interval == 0 {
+		interval = config.DefaultUpstreamProbeInterval
+	}
+	videoID := probe.VideoID
+	if videoID == "" {
+		videoID = config.DefaultUpstreamProbeVideoID
+	}
+
+	var mu sync.Mutex
+	var last Component
+	var checkedAt time.Time
+	return func(ctx context.Context) Component {
+		mu.Lock()
+		defer mu.Unlock()
+		if !checkedAt.IsZero() && time.Since(checkedAt) < interval {
+			return last
+		}
+
+		_, err := relay.ListByVideoIDs(ctx, ytrelay.Options{Part: "id", IDs: videoID})
+		switch {
+		case err == nil:
+			last = Component{Status: OK}
+		case errors.Is(err, quota.ErrBudgetExceeded), errors.Is(err, resilience.ErrCircuitOpen):
+			// reported by the other checks
+			last = Component{Status: Degraded, Error: err.Error()}
+		case ctx.Err() != nil:
+			// the probe is retried by the next check instead of caching the timeout
+			return errorComponent(fmt.Errorf("probing upstream timed out: %v", err))
+		default:
+			last = errorComponent(err)
+		}
+		checkedAt = time.Now()
+		last.Details = map[string]time.Time{"checkedAt": checkedAt}
+		return last
+	}
+}
@@ -0,0 +1,127 @@
+// Package health checks the dependencies of the relay for the liveness and readiness probes
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mirror-media/yt-relay/config"
+)
+
+// Paths of the probes, which are served for every tenant
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+type Status string
+
+const (
+	OK Status = "ok"
+	// Degraded components are reported but keep the relay ready, e.g. an exhausted quota, which the other replicas share
+	Degraded Status = "degraded"
+	// Down components make the relay unready
+	Down Status = "down"
+)
+
+// Component is the result of a check
+type Component struct {
+	Status  Status      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Report is the body of the readiness probe
+type Report struct {
+	Status     Status               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+// Check checks a component within ctx
+type Check func(ctx context.Context) Component
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the checks of the components for readiness
+type Checker struct {
+	timeout time.Duration
+	checks  []namedCheck
+}
+
+func NewChecker(conf config.Health) *Checker {
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = config.DefaultHealthTimeout
+	}
+	return &Checker{timeout: timeout}
+}
+
+// Add adds the check of the component. It's not safe to add checks while the checker is serving.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Ready runs the checks concurrently. The relay is down if any component is down.
+func (c *Checker) Ready(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]Component, len(c.checks))
+	var wg sync.WaitGroup
+	for i, nc := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = check(ctx)
+		}(i, nc.check)
+	}
+	wg.Wait()
+
+	report := Report{Status: OK, Components: make(map[string]Component, len(c.checks))}
+	for i, nc := range c.checks {
+		report.Components[nc.name] = results[i]
+		switch results[i].Status {
+		case Down:
+			report.Status = Down
+		case Degraded:
+			if report.Status == OK {
+				report.Status = Degraded
+			}
+		}
+	}
+	return report
+}
+
+// Liveness answers as long as the process serves requests
+func Liveness(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusOK, gin.H{"status": OK})
+}
+
+// Readiness answers 503 if any component is down
+func (c *Checker) Readiness(ctx *gin.Context) {
+	report := c.Ready(ctx.Request.Context())
+	status := http.StatusOK
+	if report.Status == Down {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.AbortWithStatusJSON(status, report)
+}
+
+// Handler serves both probes
+func (c *Checker) Handler() http.Handler {
+	engine := gin.New()
+	engine.GET(LivenessPath, Liveness)
+	engine.GET(ReadinessPath, c.Readiness)
+	return engine
+}
+
+// errorComponent is the component down with err
+func errorComponent(err error) Component {
+	return Component{Status: Down, Error: err.Error()}
+}
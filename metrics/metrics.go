@@ -0,0 +1,86 @@
+// Package metrics defines the prometheus metrics of the relay, which are exposed at /metrics
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "yt_relay"
+
+// Path is where the metrics are exposed
+const Path = "/metrics"
+
+// Results of the cache lookups
+const (
+	CacheHit      = "hit"
+	CacheMiss     = "miss"
+	CacheStale    = "stale"
+	CacheError    = "error"
+	CacheDisabled = "disabled"
+)
+
+var (
+	// Requests counts the requests per tenant, route, status and consumer. Consumer is empty if the tenant doesn't require authentication.
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests per tenant, route, status and consumer.",
+	}, []string{"tenant", "route", "status", "consumer"})
+
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the requests per tenant, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"tenant", "route", "status"})
+
+	// CacheLookups counts the lookups of the response cache per result, so the hit ratio is hit / (hit + miss + stale)
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Lookups of the response cache per tenant, route and result.",
+	}, []string{"tenant", "route", "result"})
+
+	// UpstreamDuration observes the calls to YouTube per tenant, which has its own api key, and VideoRelay method
+	UpstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_duration_seconds",
+		Help:      "Latency of the upstream calls per tenant and method.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"tenant", "method"})
+
+	UpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Failed upstream calls per tenant and method.",
+	}, []string{"tenant", "method"})
+
+	RedisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_duration_seconds",
+		Help:      "Latency of the redis commands per command and result.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, 1},
+	}, []string{"command", "result"})
+
+	QuotaUnits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quota_units_spent_total",
+		Help:      "YouTube Data API units spent per tenant.",
+	}, []string{"tenant"})
+
+	// FeedCalls counts the calls served by the RSS feeds, which cost no quota, instead of the Data API
+	FeedCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feed_calls_total",
+		Help:      "Calls served by the RSS feeds per tenant, method and feed mode.",
+	}, []string{"tenant", "method", "mode"})
+)
+
+// Handler serves the metrics in the prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+)
+
+// Relay wraps a VideoRelay to observe the latency and the errors of the upstream calls
+type Relay struct {
+	ytrelay.VideoRelay
+	Tenant string
+}
+
+func (r *Relay) observe(method string, f func() (interface{}, error)) (interface{}, error) {
+	start := time.Now()
+	resp, err := f()
+	UpstreamDuration.WithLabelValues(r.Tenant, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		UpstreamErrors.WithLabelValues(r.Tenant, method).Inc()
+	}
+	return resp, err
+}
+
+func (r *Relay) Search(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.observe("Search", func() (interface{}, error) { return r.VideoRelay.Search(ctx, options) })
+}
+
+func (r *Relay) ListByVideoIDs(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.observe("ListByVideoIDs", func() (interface{}, error) { return r.VideoRelay.ListByVideoIDs(ctx, options) })
+}
+
+func (r *Relay) ListPlaylistVideos(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.observe("ListPlaylistVideos", func() (interface{}, error) { return r.VideoRelay.ListPlaylistVideos(ctx, options) })
+}
+
+// GetPlaylistOwner implements PlaylistOwnerResolver if the wrapped relay does
+func (r *Relay) GetPlaylistOwner(ctx context.Context, playlistID string) (string, error) {
+	resolver, ok := r.VideoRelay.(ytrelay.PlaylistOwnerResolver)
+	if !ok {
+		return "", errors.New("the relay cannot resolve the owner of playlists")
+	}
+	resp, err := r.observe("GetPlaylistOwner", func() (interface{}, error) { return resolver.GetPlaylistOwner(ctx, playlistID) })
+	if err != nil {
+		return "", err
+	}
+	return resp.(string), nil
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mirror-media/yt-relay/api"
+	"github.com/mirror-media/yt-relay/auth"
+	log "github.com/sirupsen/logrus"
+)
+
+// APIKeyHeader carries the api token of the consumer as an alternative to the Authorization header
+const APIKeyHeader = "X-Api-Key"
+
+// ConsumerKey is the key of the consumer name in the gin context
+const ConsumerKey = "consumer"
+
+func credential(c *gin.Context) string {
+	if token := c.GetHeader(APIKeyHeader); token != "" {
+		return token
+	}
+	if authorization := c.GetHeader("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimPrefix(authorization, "Bearer ")
+	}
+	return ""
+}
+
+// Authenticate requires the requests to carry the api token or the JWT of a consumer, and checks the routes of the consumer.
+// The consumer is attached to the request context for the whitelists and the cache namespace.
+func Authenticate(authenticator *auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		consumer, err := authenticator.Authenticate(c.Request.Context(), credential(c))
+		switch err {
+		case nil:
+		case auth.ErrUnauthenticated:
+			c.Header("WWW-Authenticate", `Bearer realm="yt-relay"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, api.ErrorResp{Error: err.Error()})
+			return
+		case auth.ErrDisabled:
+			log.WithField(ConsumerKey, consumer.Name).Info(err)
+			c.AbortWithStatusJSON(http.StatusForbidden, api.ErrorResp{Error: err.Error()})
+			return
+		default:
+			log.Errorf("authenticating consumer encountered error: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, api.ErrorResp{Error: "authenticating consumer encountered error"})
+			return
+		}
+
+		c.Set(ConsumerKey, consumer.Name)
+		c.Request = c.Request.WithContext(auth.WithConsumer(c.Request.Context(), consumer))
+		logger := log.WithFields(log.Fields{
+			ConsumerKey: consumer.Name,
+			"path":      c.FullPath(),
+		})
+
+		if !consumer.AllowsRoute(c.FullPath()) {
+			err = fmt.Errorf("consumer(%s) is not allowed to request %s", consumer.Name, c.FullPath())
+			logger.Info(err)
+			c.AbortWithStatusJSON(http.StatusForbidden, api.ErrorResp{Error: err.Error()})
+			return
+		}
+
+		c.Next()
+	}
+}
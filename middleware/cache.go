@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
@@ -8,49 +9,110 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mirror-media/yt-relay/api"
+	"github.com/mirror-media/yt-relay/auth"
 	"github.com/mirror-media/yt-relay/cache"
 	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/metrics"
+	"github.com/mirror-media/yt-relay/tracing"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func Cache(namespace string, cacheConf config.Cache, cacheProvider cache.Rediser) gin.HandlerFunc {
+// lookupCache gets the cached response of the key in a span and returns the result of the lookup for the metrics
+func lookupCache(ctx context.Context, cacheProvider cache.Provider, key string) (cacheResp cache.HTTP, result string, err error) {
+	ctx, span := tracing.Start(ctx, "cache.lookup", trace.WithAttributes(attribute.String("cache.key", key)))
+	defer func() {
+		span.SetAttributes(attribute.String("cache.result", result))
+		if result == metrics.CacheMiss {
+			span.End()
+		} else {
+			tracing.End(span, err)
+		}
+	}()
+
+	value, err := cacheProvider.Get(ctx, key)
+	if err == cache.ErrCacheMiss {
+		return cacheResp, metrics.CacheMiss, errors.Wrapf(err, "Fail to get cache value for %s in cache middleware", key)
+	} else if err != nil {
+		return cacheResp, metrics.CacheError, errors.Wrapf(err, "Fail to get cache value for %s in cache middleware", key)
+	}
+
+	if err = json.Unmarshal([]byte(value), &cacheResp); err != nil {
+		return cacheResp, metrics.CacheError, errors.Wrap(err, "Fail to unmarshal cache in cache middleware")
+	}
+	return cacheResp, metrics.CacheHit, nil
+}
+
+// StaleHeader marks the responses served from the stale copies
+const StaleHeader = "X-Relay-Stale"
+
+// ServeStale responds with the stale copy of the response when the upstream fails. It reports false if there is no stale copy.
+func ServeStale(c *gin.Context, namespace string, cacheProvider cache.Provider) bool {
+	key, err := cache.GetStaleCacheKey(auth.CacheNamespace(c.Request.Context(), namespace), c.Request.URL.String())
+	if err != nil {
+		log.Error(errors.Wrap(err, "Fail to create stale cache key"))
+		return false
+	}
+	cacheResp, result, err := lookupCache(c.Request.Context(), cacheProvider, key)
+	if err != nil {
+		if result == metrics.CacheMiss {
+			log.Info(err)
+		} else {
+			log.Error(err)
+		}
+		return false
+	}
+	metrics.CacheLookups.WithLabelValues(namespace, c.FullPath(), metrics.CacheStale).Inc()
+
+	log.Infof("respond with stale cache for %s", c.Request.RequestURI)
+	for k, v := range cacheResp.Header {
+		c.Header(k, v)
+	}
+	c.Header(StaleHeader, "true")
+	c.Header("Warning", `110 - "Response is Stale"`)
+	c.AbortWithStatusJSON(cacheResp.StatusCode, json.RawMessage(cacheResp.Response))
+	return true
+}
+
+func Cache(namespace string, cacheConf config.Cache, cacheProvider cache.Provider) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		url := c.Request.URL
+		lookups := metrics.CacheLookups.MustCurryWith(prometheus.Labels{"tenant": namespace, "route": c.FullPath()})
 
 		// check blacklist
 		if isDisabled := cacheConf.DisabledAPIs[url.Path]; isDisabled {
 			log.Infof("cache is disabled for %s", url.Path)
+			lookups.WithLabelValues(metrics.CacheDisabled).Inc()
 			c.Next()
 			return
 		}
 		// read cache
 		uri := c.Request.RequestURI
-		key, err := cache.GetCacheKey(namespace, uri)
+		key, err := cache.GetCacheKey(auth.CacheNamespace(c.Request.Context(), namespace), uri)
 		if err != nil {
 			err = errors.Wrap(err, "Fail to create cache key in cache middleware")
 			log.Error(err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, api.ErrorResp{Error: err.Error()})
 			return
 		}
-		result, err := cacheProvider.Get(c.Request.Context(), key).Result()
+		cacheResp, result, err := lookupCache(c.Request.Context(), cacheProvider, key)
+		lookups.WithLabelValues(result).Inc()
 		if err != nil {
-			err = errors.Wrapf(err, "Fail to get cache value for %s in cache middleware", key)
-			log.Info(err)
-			c.Next()
-			return
-		}
-
-		var cacheResp cache.HTTP
-
-		err = json.Unmarshal([]byte(result), &cacheResp)
-		if err != nil {
-			err = errors.Wrap(err, "Fail to unmarshal cache in cache middleware")
-			log.Error(err)
+			if result == metrics.CacheMiss {
+				log.Info(err)
+			} else {
+				log.Error(err)
+			}
 			c.Next()
 			return
 		}
 
 		log.Infof("respond with cache for %s", uri)
+		for k, v := range cacheResp.Header {
+			c.Header(k, v)
+		}
 		c.AbortWithStatusJSON(cacheResp.StatusCode, json.RawMessage(cacheResp.Response))
 	}
 }
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mirror-media/yt-relay/metrics"
+)
+
+// Metrics counts the requests and observes their latency per route and status
+func Metrics(tenant string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		// the paths matching no route are grouped, so random paths can't blow up the cardinality
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.Requests.WithLabelValues(tenant, route, status, c.GetString(ConsumerKey)).Inc()
+		metrics.RequestDuration.WithLabelValues(tenant, route, status).Observe(time.Since(start).Seconds())
+	}
+}
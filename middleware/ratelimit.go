@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mirror-media/yt-relay/api"
+	"github.com/mirror-media/yt-relay/auth"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/ratelimit"
+	log "github.com/sirupsen/logrus"
+)
+
+// UpstreamKey is set in the gin context by the handlers which relay the request to YouTube, so the request is charged the upstream cost
+const UpstreamKey = "upstream"
+
+type rateLimitSubject struct {
+	name  string
+	limit config.RateLimit
+}
+
+func appliesTo(routes []string, route string) bool {
+	if len(routes) == 0 {
+		return true
+	}
+	for _, r := range routes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the forwarded client IP only for the requests from the trusted proxies, so the other clients cannot pick their own limits with X-Forwarded-For
+func clientIP(c *gin.Context) string {
+	ip, trusted := c.RemoteIP()
+	if trusted {
+		return c.ClientIP()
+	}
+	if ip == nil {
+		return c.Request.RemoteAddr
+	}
+	return ip.String()
+}
+
+// rateLimitSubjects returns the limits the request is counted against, including the rate limit of the consumer
+func rateLimitSubjects(c *gin.Context, limiter *ratelimit.Limiter) []rateLimitSubject {
+	route := c.FullPath()
+	consumer := auth.FromContext(c.Request.Context())
+
+	var subjects []rateLimitSubject
+	for _, rule := range limiter.Rules() {
+		if !appliesTo(rule.Routes, route) {
+			continue
+		}
+		var id string
+		switch rule.Key {
+		case config.RateLimitByIP:
+			id = clientIP(c)
+		case config.RateLimitByConsumer:
+			if consumer == nil {
+				continue
+			}
+			id = consumer.Name
+		case config.RateLimitByRoute:
+			id = route
+		}
+		subjects = append(subjects, rateLimitSubject{
+			name:  fmt.Sprintf("%s:%s:%s", ratelimit.RuleName(rule), rule.Key, id),
+			limit: rule.RateLimit,
+		})
+	}
+	if consumer != nil && consumer.RateLimit != nil {
+		subjects = append(subjects, rateLimitSubject{
+			name:  "consumer:" + consumer.Name,
+			limit: *consumer.RateLimit,
+		})
+	}
+	return subjects
+}
+
+// RateLimit rejects the requests exceeding any of the limits with 429 and Retry-After.
+// Every request costs 1, and the requests relayed to YouTube are charged the rest of the upstream cost after they are served.
+// The limiter being unavailable doesn't block the requests.
+func RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subjects := rateLimitSubjects(c, limiter)
+		if len(subjects) == 0 {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		logger := log.WithFields(log.Fields{
+			"path":      c.FullPath(),
+			ConsumerKey: auth.Name(ctx),
+		})
+
+		denied := false
+		var retryAfter time.Duration
+		var taken []rateLimitSubject
+		remaining, limit := int64(math.MaxInt64), int64(0)
+		for _, s := range subjects {
+			result, err := limiter.Take(ctx, s.name, s.limit, 1, false)
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			if result.Allowed {
+				taken = append(taken, s)
+			}
+			if result.Remaining < remaining {
+				remaining, limit = result.Remaining, result.Limit
+			}
+			if !result.Allowed {
+				logger.Infof("rate limit of %s is exceeded", s.name)
+				denied = true
+				if result.RetryAfter > retryAfter {
+					retryAfter = result.RetryAfter
+				}
+			}
+		}
+		if limit > 0 {
+			c.Header("X-RateLimit-Limit", strconv.FormatInt(limit, 10))
+			c.Header("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		}
+		if denied {
+			// the denied request doesn't count against the limits which allowed it
+			for _, s := range taken {
+				if _, err := limiter.Take(ctx, s.name, s.limit, -1, true); err != nil {
+					logger.Error(err)
+				}
+			}
+			// Retry-After is in seconds, so it's at least 1
+			c.Header("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(retryAfter.Seconds())))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, api.ErrorResp{Error: "rate limit is exceeded"})
+			return
+		}
+
+		c.Next()
+
+		if !c.GetBool(UpstreamKey) {
+			return
+		}
+		for _, s := range subjects {
+			if s.limit.UpstreamCost <= 1 {
+				continue
+			}
+			if _, err := limiter.Take(ctx, s.name, s.limit, s.limit.UpstreamCost-1, true); err != nil {
+				logger.Error(err)
+			}
+		}
+	}
+}
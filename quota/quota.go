@@ -0,0 +1,201 @@
+// Package quota tracks the YouTube Data API units spent per day and enforces the daily budget of tenants
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	// the location of the quota reset has to be available without the system tz database
+	_ "time/tzdata"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/metrics"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+)
+
+// Costs of the YouTube Data API v3 methods in units
+const (
+	SearchCost        int64 = 100
+	VideosCost        int64 = 1
+	PlaylistItemsCost int64 = 1
+	PlaylistsCost     int64 = 1
+)
+
+// ErrBudgetExceeded is returned when the call would exceed the daily budget
+var ErrBudgetExceeded = errors.New("daily quota budget is exceeded")
+
+// counterTTL keeps the counter of a day a little longer than the day for reporting
+const counterTTL = 48 * time.Hour
+
+// recordTimeout bounds the refunds, which outlive the requests
+const recordTimeout = 2 * time.Second
+
+var resetLocation = func() *time.Location {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		log.Errorf("loading the location of quota reset encountered error, UTC is used instead: %v", err)
+		return time.UTC
+	}
+	return loc
+}()
+
+// Day returns the quota day of t, which starts at midnight Pacific Time
+func Day(t time.Time) string {
+	return t.In(resetLocation).Format("2006-01-02")
+}
+
+// Tracker counts the units spent by a tenant in the store. If store is nil, the units are counted in memory.
+type Tracker struct {
+	namespace string
+	store     cache.Provider
+	budget    int64
+
+	mu    sync.Mutex
+	day   string
+	local int64
+}
+
+// NewTracker creates the tracker of the namespace. Zero budget means unlimited.
+func NewTracker(namespace string, store cache.Provider, budget int64) *Tracker {
+	return &Tracker{
+		namespace: namespace,
+		store:     store,
+		budget:    budget,
+	}
+}
+
+func (t *Tracker) key(day string) string {
+	return fmt.Sprintf("%s:quota:%s", t.namespace, day)
+}
+
+// Budget returns the daily budget. Zero means unlimited.
+func (t *Tracker) Budget() int64 {
+	return t.budget
+}
+
+// Usage returns the units spent today
+func (t *Tracker) Usage(ctx context.Context) (int64, error) {
+	return t.UsageOf(ctx, Day(time.Now()))
+}
+
+// UsageOf returns the units spent on the day
+func (t *Tracker) UsageOf(ctx context.Context, day string) (int64, error) {
+	if t.store == nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.day != day {
+			return 0, nil
+		}
+		return t.local, nil
+	}
+	value, err := t.store.Get(ctx, t.key(day))
+	if err == cache.ErrCacheMiss {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Reserve takes the cost from the budget of the day before the call, so concurrent calls cannot overshoot it together.
+// Nothing is taken and ErrBudgetExceeded is returned if the cost exceeds the remaining budget. The day of the reservation is returned for Refund.
+// The store being unavailable doesn't block the calls.
+func (t *Tracker) Reserve(ctx context.Context, cost int64) (day string, err error) {
+	day = Day(time.Now())
+	usage, err := t.incr(ctx, day, cost)
+	if err != nil {
+		log.Errorf("reserving quota of %s encountered error: %v", t.namespace, err)
+		return day, nil
+	}
+	if t.budget > 0 && usage > t.budget {
+		t.Refund(day, cost)
+		return day, ErrBudgetExceeded
+	}
+	return day, nil
+}
+
+// Refund returns the cost reserved on the day, e.g. for a call which never reached YouTube.
+// It's detached from the context of the request, so a client going away doesn't leave the cost taken.
+func (t *Tracker) Refund(day string, cost int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+	if _, err := t.incr(ctx, day, -cost); err != nil {
+		log.Errorf("refunding quota of %s encountered error: %v", t.namespace, err)
+	}
+}
+
+// incr adds n to the units spent on the day and returns the sum
+func (t *Tracker) incr(ctx context.Context, day string, n int64) (int64, error) {
+	if t.store == nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.day != day {
+			// a refund of a past day has nothing to return
+			if n < 0 {
+				return t.local, nil
+			}
+			t.day, t.local = day, 0
+		}
+		t.local += n
+		return t.local, nil
+	}
+	return t.store.IncrBy(ctx, t.key(day), n, counterTTL)
+}
+
+// Relay wraps a VideoRelay to charge the calls against the budget of the tracker
+type Relay struct {
+	ytrelay.VideoRelay
+	Tracker *Tracker
+}
+
+// call reserves the cost before the call, and refunds it if the call never reached YouTube
+func (r *Relay) call(ctx context.Context, cost int64, f func() (interface{}, error)) (interface{}, error) {
+	day, err := r.Tracker.Reserve(ctx, cost)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f()
+	if isServed(err) {
+		metrics.QuotaUnits.WithLabelValues(r.Tracker.namespace).Add(float64(cost))
+	} else {
+		r.Tracker.Refund(day, cost)
+	}
+	return resp, err
+}
+
+// isServed reports if YouTube served the call, whose units are spent even if it fails with an error of YouTube.
+// The calls which never reached YouTube, e.g. for transport errors or cancellations, are not charged.
+func isServed(err error) bool {
+	var apiErr *googleapi.Error
+	return err == nil || errors.As(err, &apiErr)
+}
+
+func (r *Relay) Search(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.call(ctx, SearchCost, func() (interface{}, error) { return r.VideoRelay.Search(ctx, options) })
+}
+
+func (r *Relay) ListByVideoIDs(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.call(ctx, VideosCost, func() (interface{}, error) { return r.VideoRelay.ListByVideoIDs(ctx, options) })
+}
+
+func (r *Relay) ListPlaylistVideos(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.call(ctx, PlaylistItemsCost, func() (interface{}, error) { return r.VideoRelay.ListPlaylistVideos(ctx, options) })
+}
+
+// GetPlaylistOwner implements PlaylistOwnerResolver if the wrapped relay does
+func (r *Relay) GetPlaylistOwner(ctx context.Context, playlistID string) (string, error) {
+	resolver, ok := r.VideoRelay.(ytrelay.PlaylistOwnerResolver)
+	if !ok {
+		return "", errors.New("the relay cannot resolve the owner of playlists")
+	}
+	resp, err := r.call(ctx, PlaylistsCost, func() (interface{}, error) { return resolver.GetPlaylistOwner(ctx, playlistID) })
+	if err != nil {
+		return "", err
+	}
+	return resp.(string), nil
+}
@@ -0,0 +1,82 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"google.golang.org/api/googleapi"
+)
+
+// stubRelay answers the searches with err after the delay
+type stubRelay struct {
+	ytrelay.VideoRelay
+	delay time.Duration
+	err   error
+}
+
+func (s stubRelay) Search(ctx context.Context, options ytrelay.Options) (interface{}, error) {
+	time.Sleep(s.delay)
+	return nil, s.err
+}
+
+func TestRelayReservesBudget(t *testing.T) {
+	tracker := NewTracker("test", nil, 3*SearchCost)
+	r := &Relay{VideoRelay: stubRelay{delay: 10 * time.Millisecond}, Tracker: tracker}
+
+	// the calls are in flight together, so only the reserved budget keeps them within it
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	served := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.Search(context.Background(), ytrelay.Options{})
+			if err == nil {
+				mu.Lock()
+				served++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrBudgetExceeded) {
+				t.Errorf("Search() error = %v, want ErrBudgetExceeded", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if served != 3 {
+		t.Errorf("%d searches are served, want 3", served)
+	}
+	if usage, _ := tracker.Usage(context.Background()); usage != 3*SearchCost {
+		t.Errorf("usage is %d, want %d", usage, 3*SearchCost)
+	}
+}
+
+func TestRelayCharges(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		usage int64
+	}{
+		{name: "served", usage: SearchCost},
+		{name: "error of YouTube", err: &googleapi.Error{Code: http.StatusBadRequest}, usage: SearchCost},
+		{name: "timeout", err: context.DeadlineExceeded, usage: 0},
+		{name: "transport error", err: errors.New("connection refused"), usage: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker("test", nil, SearchCost)
+			r := &Relay{VideoRelay: stubRelay{err: tt.err}, Tracker: tracker}
+			if _, err := r.Search(context.Background(), ytrelay.Options{}); !errors.Is(err, tt.err) {
+				t.Fatalf("Search() error = %v, want %v", err, tt.err)
+			}
+			if usage, _ := tracker.Usage(context.Background()); usage != tt.usage {
+				t.Errorf("usage is %d, want %d", usage, tt.usage)
+			}
+		})
+	}
+}
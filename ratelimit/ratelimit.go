@@ -0,0 +1,264 @@
+// Package ratelimit limits the requests with token buckets or sliding windows. The states are kept in redis so the limits hold across the replicas of the relay.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/pkg/errors"
+)
+
+// Result is the outcome of taking tokens from a limit
+type Result struct {
+	Allowed bool
+	// Limit is the capacity of the token bucket or the requests allowed in the sliding window
+	Limit     int64
+	Remaining int64
+	// RetryAfter is how long the caller should wait before the cost is allowed again
+	RetryAfter time.Duration
+}
+
+// tokenBucketScript refills the bucket by the elapsed time and takes the cost from it.
+// The cost is always taken if force is 1, so the extra cost of a request already served can drive the bucket negative, and a negative cost refunds the bucket up to its capacity.
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local force = ARGV[5] == "1"
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+  tokens = capacity
+  ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= cost or force then
+  tokens = math.min(capacity, tokens - cost)
+  allowed = 1
+else
+  retry = math.ceil((cost - tokens) / rate)
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens), retry}
+`
+
+// slidingWindowScript estimates the requests in the sliding window by weighting the previous fixed window with its overlap
+const slidingWindowScript = `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local force = ARGV[5] == "1"
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local previous = tonumber(redis.call("GET", KEYS[2]) or "0")
+local count = previous * (window - elapsed) / window + current
+local allowed = 0
+local retry = 0
+if count + cost <= limit or force then
+  if redis.call("INCRBY", KEYS[1], cost) < 0 then
+    redis.call("SET", KEYS[1], 0)
+  end
+  redis.call("PEXPIRE", KEYS[1], window * 2)
+  count = math.max(0, count + cost)
+  allowed = 1
+elseif current + cost > limit or previous == 0 then
+  retry = window - elapsed
+else
+  retry = math.ceil((count + cost - limit) / previous * window)
+end
+return {allowed, tostring(limit - count), retry}
+`
+
+// Limiter takes the cost of requests from the limits. The states are kept in memory of the process if rdb is nil.
+type Limiter struct {
+	namespace string
+	rdb       cache.Rediser
+	// rules holds the []config.RateLimitRule, which are swapped on reload
+	rules atomic.Value
+
+	mu        sync.Mutex
+	local     map[string]*localState
+	lastSweep time.Time
+}
+
+func New(namespace string, rdb cache.Rediser, rules []config.RateLimitRule) *Limiter {
+	l := &Limiter{
+		namespace: namespace,
+		rdb:       rdb,
+		local:     make(map[string]*localState),
+	}
+	l.SetRules(rules)
+	return l
+}
+
+// Rules returns the rules of the tenant
+func (l *Limiter) Rules() []config.RateLimitRule {
+	return l.rules.Load().([]config.RateLimitRule)
+}
+
+// SetRules swaps the rules. The states of the limits are kept, so the unchanged rules carry on.
+func (l *Limiter) SetRules(rules []config.RateLimitRule) {
+	l.rules.Store(rules)
+}
+
+func capacity(limit config.RateLimit) int64 {
+	if limit.Algorithm != config.SlidingWindow && limit.Burst > 0 {
+		return limit.Burst
+	}
+	return limit.Requests
+}
+
+// Take takes cost from the limit of name. The cost is taken even if it exceeds the limit when force is true.
+// A negative cost with force refunds the limit, e.g. for a request denied by another limit.
+func (l *Limiter) Take(ctx context.Context, name string, limit config.RateLimit, cost int64, force bool) (Result, error) {
+	if l.rdb == nil {
+		return l.takeLocal(name, limit, cost, force, time.Now()), nil
+	}
+
+	// the hash tag keeps the keys of a sliding window in the same slot of redis cluster
+	key := fmt.Sprintf("{%s:ratelimit:%s}", l.namespace, name)
+	forceArg := "0"
+	if force {
+		forceArg = "1"
+	}
+	now := time.Now()
+	var cmd *redis.Cmd
+	switch limit.Algorithm {
+	case config.SlidingWindow:
+		window := limit.Period.Milliseconds()
+		index := now.UnixNano() / int64(limit.Period)
+		elapsed := (now.UnixNano() - index*int64(limit.Period)) / int64(time.Millisecond)
+		keys := []string{fmt.Sprintf("%s:%d", key, index), fmt.Sprintf("%s:%d", key, index-1)}
+		cmd = l.rdb.Eval(ctx, slidingWindowScript, keys, limit.Requests, window, elapsed, cost, forceArg)
+	default:
+		rate := float64(limit.Requests) / float64(limit.Period.Milliseconds())
+		cmd = l.rdb.Eval(ctx, tokenBucketScript, []string{key}, rate, capacity(limit), now.UnixNano()/int64(time.Millisecond), cost, forceArg)
+	}
+
+	reply, err := cmd.Result()
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "taking rate limit of %s encountered error", name)
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 3 {
+		return Result{}, fmt.Errorf("rate limit script of %s returned unexpected reply(%v)", name, reply)
+	}
+	allowed, _ := values[0].(int64)
+	remainingString, _ := values[1].(string)
+	retry, _ := values[2].(int64)
+	remaining, err := strconv.ParseFloat(remainingString, 64)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "parsing remaining rate limit of %s encountered error", name)
+	}
+	return Result{
+		Allowed:    allowed == 1,
+		Limit:      capacity(limit),
+		Remaining:  int64(math.Max(0, math.Floor(remaining))),
+		RetryAfter: time.Duration(retry) * time.Millisecond,
+	}, nil
+}
+
+// RuleName identifies the state of the rule by its key, routes and limit, so the state follows the rule when the rules are reordered on reload
+func RuleName(rule config.RateLimitRule) string {
+	routes := append([]string(nil), rule.Routes...)
+	sort.Strings(routes)
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%s|%s|%d|%d|%s|%d", rule.Key, strings.Join(routes, ","), rule.Requests, rule.Period, rule.Algorithm, rule.Burst)
+	return fmt.Sprintf("rule:%x", h.Sum64())
+}
+
+// localState is the state of either algorithm in memory
+type localState struct {
+	// token bucket
+	tokens float64
+	ts     time.Time
+	// sliding window
+	index    int64
+	current  int64
+	previous int64
+
+	expiresAt time.Time
+}
+
+// takeLocal mirrors the scripts for the relay running without redis
+func (l *Limiter) takeLocal(name string, limit config.RateLimit, cost int64, force bool, now time.Time) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, s := range l.local {
+			if now.After(s.expiresAt) {
+				delete(l.local, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	s, ok := l.local[name]
+	result := Result{Limit: capacity(limit)}
+
+	switch limit.Algorithm {
+	case config.SlidingWindow:
+		index := now.UnixNano() / int64(limit.Period)
+		if !ok {
+			s = &localState{index: index}
+			l.local[name] = s
+		}
+		switch {
+		case s.index == index-1:
+			s.previous, s.current = s.current, 0
+		case s.index != index:
+			s.previous, s.current = 0, 0
+		}
+		s.index = index
+		elapsed := time.Duration(now.UnixNano() - index*int64(limit.Period))
+		count := float64(s.previous)*float64(limit.Period-elapsed)/float64(limit.Period) + float64(s.current)
+		switch {
+		case count+float64(cost) <= float64(limit.Requests) || force:
+			s.current = int64(math.Max(0, float64(s.current+cost)))
+			count = math.Max(0, count+float64(cost))
+			result.Allowed = true
+		case s.current+cost > limit.Requests || s.previous == 0:
+			result.RetryAfter = limit.Period - elapsed
+		default:
+			result.RetryAfter = time.Duration(math.Ceil((count + float64(cost) - float64(limit.Requests)) / float64(s.previous) * float64(limit.Period)))
+		}
+		result.Remaining = int64(math.Max(0, math.Floor(float64(limit.Requests)-count)))
+		s.expiresAt = now.Add(2 * limit.Period)
+	default:
+		capacity := float64(result.Limit)
+		// tokens per nanosecond
+		rate := float64(limit.Requests) / float64(limit.Period)
+		if !ok {
+			s = &localState{tokens: capacity, ts: now}
+			l.local[name] = s
+		}
+		s.tokens = math.Min(capacity, s.tokens+math.Max(0, float64(now.Sub(s.ts)))*rate)
+		s.ts = now
+		if s.tokens >= float64(cost) || force {
+			s.tokens = math.Min(capacity, s.tokens-float64(cost))
+			result.Allowed = true
+		} else {
+			result.RetryAfter = time.Duration(math.Ceil((float64(cost) - s.tokens) / rate))
+		}
+		result.Remaining = int64(math.Max(0, math.Floor(s.tokens)))
+		s.expiresAt = now.Add(time.Duration((capacity-s.tokens)/rate) + time.Second)
+	}
+	return result
+}
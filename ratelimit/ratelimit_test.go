@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mirror-media/yt-relay/config"
+)
+
+// step takes cost at the offset from the start and checks the result
+type step struct {
+	name      string
+	at        time.Duration
+	cost      int64
+	force     bool
+	allowed   bool
+	remaining int64
+	// retryAfter is checked to the millisecond
+	retryAfter time.Duration
+}
+
+func runSteps(t *testing.T, limit config.RateLimit, steps []step) {
+	t.Helper()
+	l := New("test", nil, nil)
+	// the start is at the boundary of a window
+	start := time.Unix(1000, 0)
+	for _, s := range steps {
+		result := l.takeLocal("subject", limit, s.cost, s.force, start.Add(s.at))
+		if result.Allowed != s.allowed || result.Remaining != s.remaining {
+			t.Fatalf("%s: takeLocal() = allowed(%v) remaining(%d), want allowed(%v) remaining(%d)", s.name, result.Allowed, result.Remaining, s.allowed, s.remaining)
+		}
+		if diff := result.RetryAfter - s.retryAfter; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Fatalf("%s: takeLocal() retry after %s, want %s", s.name, result.RetryAfter, s.retryAfter)
+		}
+		if result.Limit != capacity(limit) {
+			t.Fatalf("%s: takeLocal() limit is %d, want %d", s.name, result.Limit, capacity(limit))
+		}
+	}
+}
+
+func TestTakeLocalTokenBucket(t *testing.T) {
+	// a token per second up to 10 tokens
+	limit := config.RateLimit{Requests: 10, Period: 10 * time.Second}
+	runSteps(t, limit, []step{
+		{name: "full bucket", cost: 1, allowed: true, remaining: 9},
+		{name: "rest of the bucket", cost: 9, allowed: true, remaining: 0},
+		{name: "empty bucket", cost: 1, retryAfter: time.Second},
+		{name: "forced upstream cost", cost: 4, force: true, allowed: true, remaining: 0},
+		{name: "refilled debt", at: 2 * time.Second, cost: 1, retryAfter: 3 * time.Second},
+		{name: "refund of the debt", at: 2 * time.Second, cost: -1, force: true, allowed: true, remaining: 0},
+		{name: "paid debt", at: 4 * time.Second, cost: 1, allowed: true, remaining: 0},
+		{name: "refilled bucket", at: time.Minute, cost: 1, allowed: true, remaining: 9},
+		{name: "refund up to the capacity", at: time.Minute, cost: -5, force: true, allowed: true, remaining: 10},
+	})
+}
+
+func TestTakeLocalTokenBucketBurst(t *testing.T) {
+	limit := config.RateLimit{Requests: 10, Period: 10 * time.Second, Burst: 2}
+	runSteps(t, limit, []step{
+		{name: "burst", cost: 2, allowed: true, remaining: 0},
+		{name: "over the burst", cost: 1, retryAfter: time.Second},
+		{name: "refilled up to the burst", at: time.Minute, cost: 0, allowed: true, remaining: 2},
+	})
+}
+
+func TestTakeLocalSlidingWindow(t *testing.T) {
+	// 3 requests per 10 seconds
+	limit := config.RateLimit{Requests: 3, Period: 10 * time.Second, Algorithm: config.SlidingWindow}
+	runSteps(t, limit, []step{
+		{name: "first", cost: 1, allowed: true, remaining: 2},
+		{name: "second", at: time.Second, cost: 1, allowed: true, remaining: 1},
+		{name: "third", at: 2 * time.Second, cost: 1, allowed: true, remaining: 0},
+		{name: "over the limit waits for the next window", at: 2 * time.Second, cost: 1, retryAfter: 8 * time.Second},
+		{name: "refund", at: 2 * time.Second, cost: -1, force: true, allowed: true, remaining: 1},
+		{name: "refund below zero", at: 2 * time.Second, cost: -5, force: true, allowed: true, remaining: 3},
+		{name: "forced over the limit", at: 3 * time.Second, cost: 4, force: true, allowed: true, remaining: 0},
+		{name: "refund back to the limit", at: 3 * time.Second, cost: -1, force: true, allowed: true, remaining: 0},
+		// the previous window of 3 requests weighs 1.5 at the middle of the next one
+		{name: "rollover", at: 15 * time.Second, cost: 1, allowed: true, remaining: 0},
+		{name: "over the weighted limit", at: 15 * time.Second, cost: 1, retryAfter: 1667 * time.Millisecond},
+		// the previous window of 1 request weighs 0.5
+		{name: "next window", at: 25 * time.Second, cost: 1, allowed: true, remaining: 1},
+		{name: "windows later", at: 45 * time.Second, cost: 3, allowed: true, remaining: 0},
+	})
+}
+
+func TestTakeLocalSubjects(t *testing.T) {
+	l := New("test", nil, nil)
+	limit := config.RateLimit{Requests: 1, Period: time.Second}
+	now := time.Unix(1000, 0)
+	if !l.takeLocal("a", limit, 1, false, now).Allowed || !l.takeLocal("b", limit, 1, false, now).Allowed {
+		t.Fatal("takeLocal() denied the first request of a subject")
+	}
+	if l.takeLocal("a", limit, 1, false, now).Allowed {
+		t.Fatal("takeLocal() allowed a subject over its limit")
+	}
+
+	// the expired states are swept
+	l.takeLocal("c", limit, 1, false, now.Add(2*time.Minute))
+	if _, ok := l.local["a"]; ok || len(l.local) != 1 {
+		t.Errorf("states(%v) should only have c after the sweep", l.local)
+	}
+}
+
+func TestRuleName(t *testing.T) {
+	rule := config.RateLimitRule{Key: config.RateLimitByIP, Routes: []string{"/a", "/b"}, RateLimit: config.RateLimit{Requests: 1, Period: time.Second}}
+	reordered := rule
+	reordered.Routes = []string{"/b", "/a"}
+	if RuleName(rule) != RuleName(reordered) {
+		t.Errorf("RuleName() depends on the order of the routes")
+	}
+	changed := rule
+	changed.Requests = 2
+	if RuleName(rule) == RuleName(changed) {
+		t.Errorf("RuleName() is the same for different limits")
+	}
+}
+
+// TestTakeRedis runs the scripts within an instant, so the limits aren't refilled between the steps
+func TestTakeRedis(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("starting redis encountered error: %v", err)
+	}
+	defer server.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer rdb.Close()
+	l := New("test", rdb, nil)
+
+	tests := []struct {
+		algorithm config.RateLimitAlgorithm
+		steps     []step
+	}{
+		{algorithm: config.TokenBucket, steps: []step{
+			{name: "full bucket", cost: 2, allowed: true, remaining: 0},
+			{name: "empty bucket", cost: 1},
+			{name: "forced upstream cost", cost: 2, force: true, allowed: true, remaining: 0},
+			{name: "refunds of the debt", cost: -3, force: true, allowed: true, remaining: 1},
+			{name: "refunded bucket", cost: 1, allowed: true, remaining: 0},
+			{name: "refund up to the capacity", cost: -5, force: true, allowed: true, remaining: 2},
+		}},
+		{algorithm: config.SlidingWindow, steps: []step{
+			{name: "full window", cost: 2, allowed: true, remaining: 0},
+			{name: "over the limit", cost: 1},
+			{name: "refund", cost: -1, force: true, allowed: true, remaining: 1},
+			{name: "refund below zero", cost: -5, force: true, allowed: true, remaining: 2},
+			{name: "forced over the limit", cost: 3, force: true, allowed: true, remaining: 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			limit := config.RateLimit{Requests: 2, Period: time.Hour, Algorithm: tt.algorithm}
+			for _, s := range tt.steps {
+				result, err := l.Take(context.Background(), string(tt.algorithm), limit, s.cost, s.force)
+				if err != nil {
+					t.Fatalf("%s: Take encountered error: %v", s.name, err)
+				}
+				if result.Allowed != s.allowed || result.Remaining != s.remaining {
+					t.Fatalf("%s: Take() = allowed(%v) remaining(%d), want allowed(%v) remaining(%d)", s.name, result.Allowed, result.Remaining, s.allowed, s.remaining)
+				}
+				if !result.Allowed && (result.RetryAfter <= 0 || result.RetryAfter > limit.Period) {
+					t.Errorf("%s: Take() retry after %s, want within the period", s.name, result.RetryAfter)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+// Package fake serves a fake YouTube Data API over http, so the relay can be tested end to end with upstream.endpoint
+package fake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/relay"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+)
+
+// methods maps the paths of the api to the methods of the relay, which name the fixtures
+var methods = map[string]string{
+	"/youtube/v3/search":        "Search",
+	"/youtube/v3/videos":        "ListByVideoIDs",
+	"/youtube/v3/playlistItems": "ListPlaylistVideos",
+	"/youtube/v3/playlists":     "GetPlaylistOwner",
+}
+
+// FeedPath is the path of the RSS feeds of the channels and the playlists, whose calls are counted as the method Feed
+const FeedPath = "/feeds/videos.xml"
+
+// Fault is injected into the calls of a method instead of the fixtures
+type Fault struct {
+	// Code is the http status of the error. Only the latency is injected if it's zero.
+	Code int
+	// Reason is the reason of the error, e.g. quotaExceeded
+	Reason string
+	// Latency delays the response, or the error
+	Latency time.Duration
+	// Times is how many calls the fault is injected into. It's injected until the server is reset if it's zero.
+	Times int
+}
+
+// Server is the fake Data API. It responds with the fixtures added to it, or else with the ones recorded in its dir by upstream.fixtures.
+// It serves the feeds at FeedPath as well, which are added to it or are in the feeds directory of its dir, e.g. feeds/<channel id>.xml.
+// The calls without fixtures are responded with 404.
+type Server struct {
+	*httptest.Server
+	dir string
+
+	mu       sync.Mutex
+	fixtures map[string]relay.Fixture
+	feeds    map[string][]byte
+	faults   map[string]*Fault
+	calls    map[string]int
+}
+
+// NewServer starts the server with the fixtures in dir. There are only the added fixtures if dir is empty.
+func NewServer(dir string) *Server {
+	s := &Server{
+		dir:      dir,
+		fixtures: make(map[string]relay.Fixture),
+		feeds:    make(map[string][]byte),
+		faults:   make(map[string]*Fault),
+		calls:    make(map[string]int),
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Endpoint is the base url of the api for upstream.endpoint
+func (s *Server) Endpoint() string {
+	return s.URL + "/"
+}
+
+// Add responds to the call of the method with response. options are the parameters received by YouTube, e.g. the part and the id of the videos.
+func (s *Server) Add(method string, options ytrelay.Options, response interface{}) error {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("marshalling response of %s encountered error: %v", method, err)
+	}
+	key := relay.FixtureKey(method, options)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures[key] = relay.Fixture{Key: key, Response: body}
+	return nil
+}
+
+// AddError responds to the call of the method with the error of YouTube
+func (s *Server) AddError(method string, options ytrelay.Options, code int, reason string) {
+	key := relay.FixtureKey(method, options)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures[key] = relay.Fixture{Key: key, Error: newError(code, reason, http.StatusText(code))}
+}
+
+// AddFeed serves the Atom feed of the channel or the playlist with the id
+func (s *Server) AddFeed(id string, feed []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feeds[id] = feed
+}
+
+// Inject injects the fault into the calls of the method, which replaces the previous fault of the method
+func (s *Server) Inject(method string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[method] = &fault
+}
+
+// Calls returns how many times the method is called
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// Reset removes the faults and the counts of the calls. The fixtures are kept.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string]*Fault)
+	s.calls = make(map[string]int)
+}
+
+// call counts the call of the method and takes the fault injected into it
+func (s *Server) call(method string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[method]++
+	fault := s.faults[method]
+	if fault == nil {
+		return nil
+	}
+	injected := *fault
+	if fault.Times > 0 {
+		if fault.Times--; fault.Times == 0 {
+			delete(s.faults, method)
+		}
+	}
+	return &injected
+}
+
+// fixture looks up the added fixtures before the ones in dir
+func (s *Server) fixture(method string, key string) (*relay.Fixture, error) {
+	s.mu.Lock()
+	fx, found := s.fixtures[key]
+	s.mu.Unlock()
+	if found {
+		return &fx, nil
+	}
+	if s.dir == "" {
+		return nil, fmt.Errorf("%w: %s", relay.ErrFixtureNotFound, key)
+	}
+	return relay.ReadFixture(key, relay.FixturePath(s.dir, method, key))
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == FeedPath && r.Method == http.MethodGet {
+		s.serveFeed(w, r)
+		return
+	}
+	method, found := methods[r.URL.Path]
+	if !found || r.Method != http.MethodGet {
+		writeError(w, newError(http.StatusNotFound, "notFound", fmt.Sprintf("%s %s is not supported by the fake server", r.Method, r.URL.Path)))
+		return
+	}
+	if s.inject(w, r, method) {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("key") == "" {
+		writeError(w, newError(http.StatusForbidden, "forbidden", "The request is missing a valid API key."))
+		return
+	}
+	options, err := optionsOf(method, query)
+	if err != nil {
+		writeError(w, newError(http.StatusBadRequest, "invalidParameter", err.Error()))
+		return
+	}
+	key := relay.FixtureKey(method, options)
+	fx, err := s.fixture(method, key)
+	if errors.Is(err, relay.ErrFixtureNotFound) {
+		writeError(w, newError(http.StatusNotFound, "notFound", err.Error()))
+		return
+	} else if err != nil {
+		writeError(w, newError(http.StatusInternalServerError, "backendError", err.Error()))
+		return
+	}
+	if fx.Error != nil {
+		writeError(w, fx.Error)
+		return
+	}
+
+	body := []byte(fx.Response)
+	if method == "GetPlaylistOwner" {
+		if body, err = playlistOf(options.PlaylistID, fx.Response); err != nil {
+			writeError(w, newError(http.StatusInternalServerError, "backendError", err.Error()))
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_, _ = w.Write(body)
+}
+
+// inject counts the call and injects the fault of the method. It reports true if the call is responded with the error of the fault.
+func (s *Server) inject(w http.ResponseWriter, r *http.Request, method string) bool {
+	fault := s.call(method)
+	if fault == nil {
+		return false
+	}
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+	if fault.Code == 0 {
+		return false
+	}
+	writeError(w, newError(fault.Code, fault.Reason, "the fault is injected"))
+	return true
+}
+
+// serveFeed responds with the feed of channel_id or playlist_id, and with 404 as YouTube does if there is no such feed
+func (s *Server) serveFeed(w http.ResponseWriter, r *http.Request) {
+	if s.inject(w, r, "Feed") {
+		return
+	}
+	query := r.URL.Query()
+	id := query.Get("channel_id")
+	if id == "" {
+		id = query.Get("playlist_id")
+	}
+
+	s.mu.Lock()
+	feed, found := s.feeds[id]
+	s.mu.Unlock()
+	if !found && s.dir != "" && id != "" && !strings.ContainsAny(id, `/\.`) {
+		var err error
+		if feed, err = ioutil.ReadFile(filepath.Join(s.dir, "feeds", id+".xml")); err == nil {
+			found = true
+		} else if !os.IsNotExist(err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=UTF-8")
+	_, _ = w.Write(feed)
+}
+
+// optionsOf binds the query to the options of the method. The values of the repeated parameters, e.g. part, are joined with commas as the relay does.
+func optionsOf(method string, query url.Values) (ytrelay.Options, error) {
+	joined := url.Values{}
+	for name, values := range query {
+		joined.Set(name, strings.Join(values, ","))
+	}
+	// playlists are looked up by their ids, which are the playlist ids of the relay
+	if method == "GetPlaylistOwner" {
+		return ytrelay.Options{PlaylistID: joined.Get("id")}, nil
+	}
+	var options ytrelay.Options
+	err := binding.Query.Bind(&http.Request{URL: &url.URL{RawQuery: joined.Encode()}}, &options)
+	return options, err
+}
+
+// playlistOf converts the owner, which is the fixture of GetPlaylistOwner, into the response of playlists.list
+func playlistOf(playlistID string, fixture json.RawMessage) ([]byte, error) {
+	var owner string
+	if err := json.Unmarshal(fixture, &owner); err != nil {
+		return nil, fmt.Errorf("owner of playlist(%s) is malformed: %v", playlistID, err)
+	}
+	return json.Marshal(youtube.PlaylistListResponse{
+		Items: []*youtube.Playlist{{Id: playlistID, Snippet: &youtube.PlaylistSnippet{ChannelId: owner}}},
+	})
+}
+
+func newError(code int, reason string, message string) *googleapi.Error {
+	return &googleapi.Error{
+		Code:    code,
+		Message: message,
+		Errors:  []googleapi.ErrorItem{{Reason: reason, Message: message}},
+	}
+}
+
+// writeError writes the error in the format of Google, so the client returns it as *googleapi.Error
+func writeError(w http.ResponseWriter, e *googleapi.Error) {
+	type errorItem struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	}
+	type errorBody struct {
+		Code    int         `json:"code"`
+		Message string      `json:"message"`
+		Errors  []errorItem `json:"errors,omitempty"`
+	}
+	body := errorBody{Code: e.Code, Message: e.Message}
+	for _, item := range e.Errors {
+		body.Errors = append(body.Errors, errorItem{Reason: item.Reason, Message: item.Message})
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(e.Code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error errorBody `json:"error"`
+	}{body})
+}
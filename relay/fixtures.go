@@ -0,0 +1,235 @@
+package relay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/config"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+// ErrFixtureNotFound is returned in the replay mode if the call isn't recorded
+var ErrFixtureNotFound = errors.New("fixture is not recorded")
+
+// Fixture is the file of a recorded call
+type Fixture struct {
+	Key      string          `json:"key"`
+	Response json.RawMessage `json:"response,omitempty"`
+	// Error is the error of YouTube, which is replayed as well
+	Error *googleapi.Error `json:"error,omitempty"`
+}
+
+// Fixtures records the responses of the wrapped relay to files in the record mode, and serves only the recorded ones in the replay mode
+type Fixtures struct {
+	// VideoRelay is only called in the record mode
+	ytrelay.VideoRelay
+	mode config.FixtureMode
+	dir  string
+}
+
+// NewFixtures creates the relay of the fixtures in conf.Dir, which is created in the record mode. relay can be nil in the replay mode.
+func NewFixtures(relay ytrelay.VideoRelay, conf config.Fixtures) (*Fixtures, error) {
+	if conf.Mode == config.RecordFixtures {
+		if err := os.MkdirAll(conf.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("creating fixture dir(%s) encountered error: %v", conf.Dir, err)
+		}
+	}
+	return &Fixtures{VideoRelay: relay, mode: conf.Mode, dir: conf.Dir}, nil
+}
+
+// NewUpstream creates the relay to YouTube, or to the endpoint, with the api key, which records or replays the fixtures if they are configured.
+// YouTube is never called in the replay mode, so the api key isn't required.
+func NewUpstream(ctx context.Context, apiKey string, conf config.Upstream) (ytrelay.VideoRelay, error) {
+	if conf.IsReplay() {
+		log.Infof("youtube responses are replayed with the fixtures in %s", conf.Fixtures.Dir)
+		return NewFixtures(nil, *conf.Fixtures)
+	}
+	var opts []option.ClientOption
+	if conf.Endpoint != "" {
+		// the paths of the api are resolved against the endpoint, which is a directory
+		opts = append(opts, option.WithEndpoint(strings.TrimSuffix(conf.Endpoint, "/")+"/"))
+		log.Infof("youtube is called at %s", conf.Endpoint)
+	}
+	youtubeService, err := New(ctx, apiKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Fixtures == nil {
+		return youtubeService, nil
+	}
+	fixtures, err := NewFixtures(youtubeService, *conf.Fixtures)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("youtube responses are %sed with the fixtures in %s", conf.Fixtures.Mode, conf.Fixtures.Dir)
+	return fixtures, nil
+}
+
+// FixtureKey returns the key of the call with the normalized options, so equivalent calls share the fixture.
+// The parameters are sorted by name, the zero values are omitted, and the parts are sorted and deduplicated.
+func FixtureKey(method string, options ytrelay.Options) string {
+	query := url.Values{}
+	v := reflect.ValueOf(options)
+	for i := 0; i < v.NumField(); i++ {
+		if isZero(v.Field(i).Interface()) {
+			continue
+		}
+		value := strings.TrimSpace(fmt.Sprint(v.Field(i).Interface()))
+		name := v.Type().Field(i).Tag.Get("form")
+		if name == "part" {
+			value = normalizeList(value)
+		}
+		query.Set(name, value)
+	}
+	return method + "?" + query.Encode()
+}
+
+// normalizeList sorts and deduplicates the comma separated values
+func normalizeList(list string) string {
+	seen := make(map[string]bool)
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+// FixturePath returns the file of the fixture in dir, which is named by the method and the hash of the key
+func FixturePath(dir string, method string, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, fmt.Sprintf("%s-%x.json", method, sum[:8]))
+}
+
+// ReadFixture reads the fixture of the key at path. ErrFixtureNotFound is returned if the file doesn't exist.
+func ReadFixture(key string, path string) (*Fixture, error) {
+	body, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrFixtureNotFound, key)
+	} else if err != nil {
+		return nil, fmt.Errorf("reading fixture(%s) encountered error: %v", path, err)
+	}
+	var fx Fixture
+	if err = json.Unmarshal(body, &fx); err != nil {
+		return nil, fmt.Errorf("fixture(%s) is malformed: %v", path, err)
+	}
+	return &fx, nil
+}
+
+// call replays the fixture into resp, or records the response of upstream
+func (f *Fixtures) call(method string, options ytrelay.Options, resp interface{}, upstream func() (interface{}, error)) (interface{}, error) {
+	key := FixtureKey(method, options)
+	path := FixturePath(f.dir, method, key)
+	if f.mode == config.ReplayFixtures {
+		return replay(key, path, resp)
+	}
+	result, err := upstream()
+	f.record(key, path, result, err)
+	return result, err
+}
+
+func replay(key string, path string, resp interface{}) (interface{}, error) {
+	fx, err := ReadFixture(key, path)
+	if err != nil {
+		return nil, err
+	}
+	if fx.Error != nil {
+		return nil, fx.Error
+	}
+	if err = json.Unmarshal(fx.Response, resp); err != nil {
+		return nil, fmt.Errorf("response of fixture(%s) is malformed: %v", path, err)
+	}
+	return resp, nil
+}
+
+func (f *Fixtures) record(key string, path string, result interface{}, err error) {
+	fx := Fixture{Key: key}
+	var apiErr *googleapi.Error
+	switch {
+	case err == nil:
+		if fx.Response, err = json.Marshal(result); err != nil {
+			log.Errorf("marshalling response of %s for the fixture encountered error: %v", key, err)
+			return
+		}
+	case errors.As(err, &apiErr):
+		fx.Error = apiErr
+	default:
+		// the errors of the connection and the context aren't recorded, so the call is recorded when it succeeds later
+		return
+	}
+
+	body, err := json.MarshalIndent(fx, "", "  ")
+	if err != nil {
+		log.Errorf("marshalling fixture of %s encountered error: %v", key, err)
+		return
+	}
+	// the fixture is renamed into place, so a replay never reads a partial one
+	tmp, err := ioutil.TempFile(f.dir, ".fixture-*")
+	if err != nil {
+		log.Errorf("creating fixture of %s encountered error: %v", key, err)
+		return
+	}
+	_, err = tmp.Write(body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		log.Errorf("writing fixture of %s encountered error: %v", key, err)
+		return
+	}
+	log.Infof("recorded %s to %s", key, path)
+}
+
+func (f *Fixtures) Search(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return f.call("Search", options, &youtube.SearchListResponse{}, func() (interface{}, error) { return f.VideoRelay.Search(ctx, options) })
+}
+
+func (f *Fixtures) ListByVideoIDs(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return f.call("ListByVideoIDs", options, &youtube.VideoListResponse{}, func() (interface{}, error) { return f.VideoRelay.ListByVideoIDs(ctx, options) })
+}
+
+func (f *Fixtures) ListPlaylistVideos(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return f.call("ListPlaylistVideos", options, &youtube.PlaylistItemListResponse{}, func() (interface{}, error) { return f.VideoRelay.ListPlaylistVideos(ctx, options) })
+}
+
+// GetPlaylistOwner implements PlaylistOwnerResolver if the wrapped relay does
+func (f *Fixtures) GetPlaylistOwner(ctx context.Context, playlistID string) (string, error) {
+	var owner string
+	resp, err := f.call("GetPlaylistOwner", ytrelay.Options{PlaylistID: playlistID}, &owner, func() (interface{}, error) {
+		resolver, ok := f.VideoRelay.(ytrelay.PlaylistOwnerResolver)
+		if !ok {
+			return "", errors.New("the relay cannot resolve the owner of playlists")
+		}
+		return resolver.GetPlaylistOwner(ctx, playlistID)
+	})
+	if err != nil {
+		return "", err
+	}
+	// the recorded call returns the owner itself, and the replayed one decodes it into owner
+	if recorded, ok := resp.(string); ok {
+		return recorded, nil
+	}
+	return owner, nil
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 
 	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/tracing"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
 )
@@ -16,18 +18,22 @@ type YouTubeServiceV3 struct {
 	youtubeService *youtube.Service
 }
 
-func New(apiKey string) (*YouTubeServiceV3, error) {
+// New creates the service with the api key and the extra options, e.g. option.WithEndpoint. ctx is only used to create the service, and every call takes its own context.
+func New(ctx context.Context, apiKey string, opts ...option.ClientOption) (*YouTubeServiceV3, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("apikey is empty for youtube service")
 	}
-	s, err := youtube.NewService(context.Background(), option.WithAPIKey(apiKey))
+	s, err := youtube.NewService(ctx, append([]option.ClientOption{option.WithAPIKey(apiKey)}, opts...)...)
 	return &YouTubeServiceV3{
 		youtubeService: s,
 	}, err
 }
 
 // Search supports the following parameters: part, channelId, eventType, q, maxResults, pageToken, order, safeSearch, type
-func (s *YouTubeServiceV3) Search(options ytrelay.Options) (resp interface{}, err error) {
+func (s *YouTubeServiceV3) Search(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	ctx, span := startSpan(ctx, "Search")
+	defer func() { tracing.End(span, err) }()
+
 	yt := s.youtubeService
 	call := yt.Search.List(strings.Split(options.Part, ","))
 	if !isZero(options.ChannelID) {
@@ -55,11 +61,14 @@ func (s *YouTubeServiceV3) Search(options ytrelay.Options) (resp interface{}, er
 		call.Type(options.Type)
 	}
 
-	return call.Do()
+	return call.Context(ctx).Do()
 }
 
 // ListByVideoIDs supports the following parameters: part, id, maxResults, pageToken
-func (s *YouTubeServiceV3) ListByVideoIDs(options ytrelay.Options) (resp interface{}, err error) {
+func (s *YouTubeServiceV3) ListByVideoIDs(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	ctx, span := startSpan(ctx, "ListByVideoIDs")
+	defer func() { tracing.End(span, err) }()
+
 	yt := s.youtubeService
 	call := yt.Videos.List(strings.Split(options.Part, ","))
 	if !isZero(options.IDs) {
@@ -73,11 +82,14 @@ func (s *YouTubeServiceV3) ListByVideoIDs(options ytrelay.Options) (resp interfa
 	if !isZero(options.MaxResults) {
 		call.MaxResults(options.MaxResults)
 	}
-	return call.Do()
+	return call.Context(ctx).Do()
 }
 
 // ListPlaylistVideos supports the following parameters: part, playlistId, maxResults, pageToken
-func (s *YouTubeServiceV3) ListPlaylistVideos(options ytrelay.Options) (resp interface{}, err error) {
+func (s *YouTubeServiceV3) ListPlaylistVideos(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	ctx, span := startSpan(ctx, "ListPlaylistVideos")
+	defer func() { tracing.End(span, err) }()
+
 	yt := s.youtubeService
 	call := yt.PlaylistItems.List(strings.Split(options.Part, ","))
 	if !isZero(options.Fields) {
@@ -92,7 +104,28 @@ func (s *YouTubeServiceV3) ListPlaylistVideos(options ytrelay.Options) (resp int
 	if !isZero(options.MaxResults) {
 		call.MaxResults(options.MaxResults)
 	}
-	return call.Do()
+	return call.Context(ctx).Do()
+}
+
+// GetPlaylistOwner returns the channel id of the playlist via playlists.list
+func (s *YouTubeServiceV3) GetPlaylistOwner(ctx context.Context, playlistID string) (channelID string, err error) {
+	ctx, span := startSpan(ctx, "GetPlaylistOwner")
+	defer func() { tracing.End(span, err) }()
+
+	yt := s.youtubeService
+	resp, err := yt.Playlists.List([]string{"snippet"}).Id(playlistID).Fields("items(id,snippet/channelId)").Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Items) == 0 || resp.Items[0].Snippet == nil {
+		return "", fmt.Errorf("%w: %s", ytrelay.ErrPlaylistNotFound, playlistID)
+	}
+	return resp.Items[0].Snippet.ChannelId, nil
+}
+
+// startSpan starts the span of the call to YouTube
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "YouTubeServiceV3."+method, trace.WithSpanKind(trace.SpanKindClient))
 }
 
 func isZero(i interface{}) bool {
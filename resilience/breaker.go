@@ -0,0 +1,84 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the upstream while the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type State string
+
+const (
+	// Closed lets every call through
+	Closed State = "closed"
+	// Open fails the calls fast
+	Open State = "open"
+	// HalfOpen lets a call probe the endpoint after the open timeout
+	HalfOpen State = "half-open"
+)
+
+// Breaker is a consecutive failure circuit breaker
+type Breaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+}
+
+func NewBreaker(threshold int, openTimeout time.Duration) *Breaker {
+	return &Breaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		state:       Closed,
+	}
+}
+
+// Allow reports if a call can go through. Only one call probes the endpoint in the half-open state.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = HalfOpen
+		return nil
+	case HalfOpen:
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// Record records the outcome of the call let through by Allow
+func (b *Breaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.state = Closed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.state = Open
+		b.openedAt = time.Now()
+	}
+}
+
+// State returns the current state. An open breaker past the open timeout is reported as half-open since it lets the next call probe.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && time.Since(b.openedAt) >= b.openTimeout {
+		return HalfOpen
+	}
+	return b.state
+}
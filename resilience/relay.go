@@ -0,0 +1,161 @@
+// Package resilience retries the failed calls to YouTube and fails fast with circuit breakers when YouTube keeps failing
+package resilience
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/quota"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+)
+
+// Names of the endpoints, which have their own circuit breakers
+const (
+	SearchEndpoint             = "Search"
+	ListByVideoIDsEndpoint     = "ListByVideoIDs"
+	ListPlaylistVideosEndpoint = "ListPlaylistVideos"
+	GetPlaylistOwnerEndpoint   = "GetPlaylistOwner"
+)
+
+// Relay wraps a VideoRelay to retry the calls, which are all idempotent reads, and to guard every endpoint with a circuit breaker
+type Relay struct {
+	ytrelay.VideoRelay
+	retry    config.Retry
+	breakers map[string]*Breaker
+}
+
+// New wraps the relay according to the upstream configuration. Nil Retry means a single attempt, and nil CircuitBreaker means no breakers.
+func New(relay ytrelay.VideoRelay, conf config.Upstream) *Relay {
+	r := &Relay{
+		VideoRelay: relay,
+		retry:      config.Retry{MaxAttempts: 1},
+	}
+	if conf.Retry != nil {
+		r.retry = *conf.Retry
+		if r.retry.MaxAttempts == 0 {
+			r.retry.MaxAttempts = config.DefaultRetryMaxAttempts
+		}
+		if r.retry.BaseDelay == 0 {
+			r.retry.BaseDelay = config.DefaultRetryBaseDelay
+		}
+		if r.retry.MaxDelay == 0 {
+			r.retry.MaxDelay = config.DefaultRetryMaxDelay
+		}
+	}
+	if conf.CircuitBreaker != nil {
+		threshold := conf.CircuitBreaker.FailureThreshold
+		if threshold == 0 {
+			threshold = config.DefaultCircuitBreakerFailureThreshold
+		}
+		openTimeout := conf.CircuitBreaker.OpenTimeout
+		if openTimeout == 0 {
+			openTimeout = config.DefaultCircuitBreakerOpenTimeout
+		}
+		r.breakers = make(map[string]*Breaker)
+		for _, endpoint := range []string{SearchEndpoint, ListByVideoIDsEndpoint, ListPlaylistVideosEndpoint, GetPlaylistOwnerEndpoint} {
+			r.breakers[endpoint] = NewBreaker(threshold, openTimeout)
+		}
+	}
+	return r
+}
+
+// BreakerStates returns the state of the circuit breaker per endpoint. It's empty if there are no breakers.
+func (r *Relay) BreakerStates() map[string]State {
+	states := make(map[string]State, len(r.breakers))
+	for endpoint, b := range r.breakers {
+		states[endpoint] = b.State()
+	}
+	return states
+}
+
+// classify tells if the error is worth a retry and if it's a failure of the upstream for the circuit breaker.
+// Quota errors, either of the daily budget or of Google, are never retried.
+func classify(err error) (retryable bool, failure bool) {
+	var apiErr *googleapi.Error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, quota.ErrBudgetExceeded), errors.Is(err, context.Canceled):
+		return false, false
+	case errors.Is(err, context.DeadlineExceeded):
+		// the deadline of the request is shared by the attempts, so there is no time left to retry
+		return false, true
+	case errors.As(err, &apiErr):
+		return apiErr.Code >= 500, apiErr.Code >= 500
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET):
+		return true, true
+	}
+	return false, false
+}
+
+// backoff returns the delay before the next attempt with full jitter
+func (r *Relay) backoff(attempt int) time.Duration {
+	delay := r.retry.BaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > r.retry.MaxDelay {
+		delay = r.retry.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+func (r *Relay) do(ctx context.Context, endpoint string, f func() (interface{}, error)) (interface{}, error) {
+	breaker := r.breakers[endpoint]
+	if breaker != nil {
+		if err := breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := f()
+		retryable, failure := classify(err)
+		if err == nil || !retryable || attempt >= r.retry.MaxAttempts {
+			if breaker != nil {
+				breaker.Record(failure)
+			}
+			return resp, err
+		}
+
+		delay := r.backoff(attempt)
+		log.Infof("retrying %s in %s after attempt %d failed: %v", endpoint, delay, attempt, err)
+		select {
+		case <-ctx.Done():
+			if breaker != nil {
+				breaker.Record(failure)
+			}
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (r *Relay) Search(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.do(ctx, SearchEndpoint, func() (interface{}, error) { return r.VideoRelay.Search(ctx, options) })
+}
+
+func (r *Relay) ListByVideoIDs(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.do(ctx, ListByVideoIDsEndpoint, func() (interface{}, error) { return r.VideoRelay.ListByVideoIDs(ctx, options) })
+}
+
+func (r *Relay) ListPlaylistVideos(ctx context.Context, options ytrelay.Options) (resp interface{}, err error) {
+	return r.do(ctx, ListPlaylistVideosEndpoint, func() (interface{}, error) { return r.VideoRelay.ListPlaylistVideos(ctx, options) })
+}
+
+// GetPlaylistOwner implements PlaylistOwnerResolver if the wrapped relay does
+func (r *Relay) GetPlaylistOwner(ctx context.Context, playlistID string) (string, error) {
+	resolver, ok := r.VideoRelay.(ytrelay.PlaylistOwnerResolver)
+	if !ok {
+		return "", errors.New("the relay cannot resolve the owner of playlists")
+	}
+	resp, err := r.do(ctx, GetPlaylistOwnerEndpoint, func() (interface{}, error) { return resolver.GetPlaylistOwner(ctx, playlistID) })
+	if err != nil {
+		return "", err
+	}
+	return resp.(string), nil
+}
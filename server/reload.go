@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/filewatch"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// configWatchInterval is how often the configuration file is checked for changes
+const configWatchInterval = 5 * time.Second
+
+// WatchConfig reloads the configuration when the file changes or on SIGHUP until the server is closed. parse parses the file without validating it.
+func (s *Server) WatchConfig(path string, parse func() (*config.Conf, error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	s.stopWatch = func() {
+		cancel()
+		wg.Wait()
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer signal.Stop(hangups)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangups:
+				log.Info("received SIGHUP, reloading configuration")
+				s.reloadFrom(parse)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		filewatch.Watch(ctx, configWatchInterval, func() { s.reloadFrom(parse) }, path)
+	}()
+}
+
+// reloadFrom parses and validates the configuration. An invalid configuration is rejected with the diff to the current one.
+func (s *Server) reloadFrom(parse func() (*config.Conf, error)) {
+	next, err := parse()
+	if err != nil {
+		log.Errorf("parsing configuration encountered error, the current one is kept: %v", err)
+		return
+	}
+	if invalid := next.Check(); invalid != nil {
+		s.reloadMu.Lock()
+		diff, err := config.Diff(*s.conf, *next)
+		s.reloadMu.Unlock()
+		if err != nil {
+			log.Errorf("%v, the current one is kept, diffing it encountered error: %v", invalid, err)
+			return
+		}
+		log.Errorf("%v, the current one is kept. The rejected changes are:\n%s", invalid, diff)
+		return
+	}
+	if err := s.Reload(*next); err != nil {
+		log.Errorf("reloading configuration encountered error, the current one is kept: %v", err)
+	}
+}
+
+// Reload applies the cache rules, the upstream timeouts, and the whitelists, policies and rate limits of the tenants in next.
+// The routes of every tenant are built before any of them is swapped, so either all of the tenants are reloaded or none of them.
+// The other changes are reported as requiring a restart and aren't applied.
+func (s *Server) Reload(next config.Conf) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if changes := s.conf.RestartRequired(next); len(changes) > 0 {
+		log.Warnf("the changes of %s require a restart and aren't applied", strings.Join(changes, ", "))
+	}
+	live := s.conf.WithLive(next)
+
+	built := make([]*routes, 0, len(s.Tenants))
+	for _, t := range s.Tenants {
+		tc, _ := live.FindTenant(t.Conf.AppName)
+		r, err := t.newRoutes(live, tc, s.Cache, s.Store)
+		if err != nil {
+			for _, r := range built {
+				if r.dynamic != nil {
+					_ = r.dynamic.Close()
+				}
+			}
+			return errors.Wrapf(err, "building routes of tenant(%s) encountered error", t.Conf.AppName)
+		}
+		built = append(built, r)
+	}
+
+	for i, t := range s.Tenants {
+		if previous := t.swap(built[i]); previous != nil && previous.dynamic != nil {
+			if err := previous.dynamic.Close(); err != nil {
+				log.Errorf("closing previous whitelists of tenant(%s) encountered error: %v", t.Conf.AppName, err)
+			}
+		}
+	}
+	s.conf = &live
+	log.Info("configuration is reloaded")
+	return nil
+}
@@ -0,0 +1,167 @@
+package route
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mirror-media/yt-relay/api"
+	"github.com/mirror-media/yt-relay/whitelist"
+	log "github.com/sirupsen/logrus"
+)
+
+// ActorHeader names the operator in the audit log of the admin api
+const ActorHeader = "X-Admin-Actor"
+
+const defaultAdminActor = "admin-api"
+
+type putWhitelistEntryRequest struct {
+	// Effective is true if it's omitted
+	Effective *bool      `json:"effective"`
+	Note      string     `json:"note"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type whitelistEntryResponse struct {
+	Kind      whitelist.Kind   `json:"kind"`
+	ID        string           `json:"id"`
+	Present   bool             `json:"present"`
+	Effective bool             `json:"effective"`
+	Entry     *whitelist.Entry `json:"entry,omitempty"`
+}
+
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.GetHeader("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, "Bearer ")), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="yt-relay-admin"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, api.ErrorResp{Error: "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func parseKind(c *gin.Context) (whitelist.Kind, bool) {
+	kind, err := whitelist.ParseKind(c.Param("kind"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.ErrorResp{Error: err.Error()})
+		return "", false
+	}
+	return kind, true
+}
+
+func adminActor(c *gin.Context) string {
+	if actor := c.GetHeader(ActorHeader); actor != "" {
+		return actor
+	}
+	return defaultAdminActor
+}
+
+// SetAdmin sets the admin api to manage the whitelists in the store
+func SetAdmin(r gin.IRouter, token string, store *whitelist.Store) error {
+
+	adminRouter := r.Group("/admin", adminAuth(token))
+
+	// list the entries of channels or playlists
+	adminRouter.GET("/whitelists/:kind", func(c *gin.Context) {
+		kind, ok := parseKind(c)
+		if !ok {
+			return
+		}
+		entries, err := store.List(c.Request.Context(), kind)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, api.ErrorResp{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+	})
+
+	// check an entry
+	adminRouter.GET("/whitelists/:kind/:id", func(c *gin.Context) {
+		kind, ok := parseKind(c)
+		if !ok {
+			return
+		}
+		id := c.Param("id")
+		entry, present, err := store.Get(c.Request.Context(), kind, id)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, api.ErrorResp{Error: err.Error()})
+			return
+		}
+		resp := whitelistEntryResponse{Kind: kind, ID: id, Present: present}
+		if present {
+			resp.Entry = &entry
+			resp.Effective = entry.IsEffective(time.Now())
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// add or update an entry
+	adminRouter.PUT("/whitelists/:kind/:id", func(c *gin.Context) {
+		kind, ok := parseKind(c)
+		if !ok {
+			return
+		}
+		var req putWhitelistEntryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, api.ErrorResp{Error: err.Error()})
+			return
+		}
+		entry := whitelist.Entry{
+			Effective: req.Effective == nil || *req.Effective,
+			Note:      req.Note,
+			ExpiresAt: req.ExpiresAt,
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, api.ErrorResp{Error: "expiresAt has passed"})
+			return
+		}
+		id := c.Param("id")
+		if err := store.Put(c.Request.Context(), adminActor(c), kind, id, entry); err != nil {
+			log.Error(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, api.ErrorResp{Error: err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// remove an entry
+	adminRouter.DELETE("/whitelists/:kind/:id", func(c *gin.Context) {
+		kind, ok := parseKind(c)
+		if !ok {
+			return
+		}
+		if err := store.Remove(c.Request.Context(), adminActor(c), kind, c.Param("id")); err != nil {
+			log.Error(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, api.ErrorResp{Error: err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// list the audit log. since is in RFC3339 and the default is 7 days ago
+	adminRouter.GET("/audit", func(c *gin.Context) {
+		since := time.Now().AddDate(0, 0, -7)
+		if s := c.Query("since"); s != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, s); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, api.ErrorResp{Error: err.Error()})
+				return
+			}
+		}
+		records, err := store.Audit(c.Request.Context(), since)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, api.ErrorResp{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, records)
+	})
+
+	return nil
+}
@@ -1,21 +1,32 @@
 package route
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	ytrelay "github.com/mirror-media/yt-relay"
 	"github.com/mirror-media/yt-relay/api"
+	"github.com/mirror-media/yt-relay/auth"
 	"github.com/mirror-media/yt-relay/cache"
 	"github.com/mirror-media/yt-relay/config"
 	"github.com/mirror-media/yt-relay/middleware"
+	"github.com/mirror-media/yt-relay/quota"
+	"github.com/mirror-media/yt-relay/ratelimit"
 	"github.com/mirror-media/yt-relay/relay"
+	"github.com/mirror-media/yt-relay/resilience"
+	"github.com/mirror-media/yt-relay/tracing"
+	ytwhitelist "github.com/mirror-media/yt-relay/whitelist"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/youtube/v3"
 )
 
@@ -26,6 +37,9 @@ const (
 
 const TTLHeader = "Cache-Set-TTL"
 
+// FilteredIDsHeader lists the ids of the items removed from the response in the filter mode
+const FilteredIDsHeader = "X-Relay-Filtered-IDs"
+
 func getResponseCacheTTL(apiLogger *log.Entry, cacheConf config.Cache, request http.Request) (ttl time.Duration, isDisabled bool) {
 
 	seconds, ok := cacheConf.OverwriteTTL[request.RequestURI]
@@ -70,31 +84,40 @@ func getHeaderTTL(apiLogger *log.Entry, request http.Request) (ttl time.Duration
 	return ttl, isPresenting, err
 }
 
-func saveOKCache(isEnabled bool, cacheConf config.Cache, cacheProvider cache.Rediser, apiLogger *log.Entry, appName string, request http.Request, resp interface{}) {
+func saveOKCache(isEnabled bool, cacheConf config.Cache, cacheProvider cache.Provider, apiLogger *log.Entry, appName string, request http.Request, resp interface{}, header map[string]string) {
 
 	if cacheConf.IsEnabled {
 		ttl, isCacheDisabledForAPI := getResponseCacheTTL(apiLogger, cacheConf, request)
 		if !isCacheDisabledForAPI {
-			saveCache(cacheConf, cacheProvider, apiLogger, appName, request, http.StatusOK, resp, ttl)
+			saveCache(cacheConf, cacheProvider, apiLogger, appName, request, http.StatusOK, resp, header, ttl, cache.GetCacheKey, false)
+			if cacheConf.StaleTTL > 0 {
+				saveCache(cacheConf, cacheProvider, apiLogger, appName, request, http.StatusOK, resp, header, time.Duration(cacheConf.StaleTTL)*time.Second, cache.GetStaleCacheKey, true)
+			}
 		} else {
 			apiLogger.Infof("cache is disabled for %s", request.URL.String())
 		}
 	}
 }
-func saveErrCache(isEnabled bool, cacheConf config.Cache, cacheProvider cache.Rediser, apiLogger *log.Entry, appName string, request http.Request, httpResponseCode uint, resp interface{}) {
+func saveErrCache(isEnabled bool, cacheConf config.Cache, cacheProvider cache.Provider, apiLogger *log.Entry, appName string, request http.Request, httpResponseCode uint, resp interface{}) {
 
 	if cacheConf.IsEnabled {
 		_, isCacheDisabledForAPI := getResponseCacheTTL(apiLogger, cacheConf, request)
 		if !isCacheDisabledForAPI {
 			ttl := time.Duration(cacheConf.ErrorTTL) * time.Second
-			saveCache(cacheConf, cacheProvider, apiLogger, appName, request, http.StatusOK, resp, ttl)
+			saveCache(cacheConf, cacheProvider, apiLogger, appName, request, int(httpResponseCode), resp, nil, ttl, cache.GetCacheKey, false)
 		} else {
 			apiLogger.Infof("cache is disabled for %s", request.URL.String())
 		}
 	}
 }
 
-func saveCache(cacheConf config.Cache, cacheProvider cache.Rediser, apiLogger *log.Entry, appName string, request http.Request, respCode int, resp interface{}, ttl time.Duration) {
+// saveCache saves the response under the key created by keyOf, which is either the key of the cache or of the stale copy.
+// The cache is only set if it's absent, so the response cached by a concurrent request is kept, while the stale copy is overwritten to stay the latest.
+func saveCache(cacheConf config.Cache, cacheProvider cache.Provider, apiLogger *log.Entry, appName string, request http.Request, respCode int, resp interface{}, header map[string]string, ttl time.Duration, keyOf func(namespace string, name string) (string, error), isOverwritten bool) {
+	ctx, span := tracing.Start(request.Context(), "cache.save", trace.WithAttributes(attribute.Int("http.status_code", respCode), attribute.Int64("cache.ttl", int64(ttl.Seconds()))))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
 	s, err := json.Marshal(resp)
 	if err != nil {
 		apiLogger.Errorf("Cannot marshal resp for %s: %s", request.URL.String(), err)
@@ -102,37 +125,117 @@ func saveCache(cacheConf config.Cache, cacheProvider cache.Rediser, apiLogger *l
 	}
 	s, err = json.Marshal(cache.HTTP{
 		StatusCode: respCode,
+		Header:     header,
 		Response:   s,
 	})
 	if err != nil {
 		apiLogger.Errorf("Cannot marshal http resp cache for %s: %s", request.URL.String(), err)
 		return
 	}
-	key, err := cache.GetCacheKey(appName, request.URL.String())
+	key, err := keyOf(auth.CacheNamespace(request.Context(), appName), request.URL.String())
 	if err != nil {
 		apiLogger.Errorf("GetCacheKey for %s encounter error:%v", request.URL.String(), err)
 	}
-	err = cacheProvider.SetNX(request.Context(), key, string(s), ttl).Err()
+	span.SetAttributes(attribute.String("cache.key", key))
+	isSet := true
+	if isOverwritten {
+		err = cacheProvider.Set(ctx, key, string(s), ttl)
+	} else {
+		isSet, err = cacheProvider.SetNX(ctx, key, string(s), ttl)
+	}
 	if err != nil {
 		apiLogger.Errorf("setting cache encountered error for %s: %v ", request.URL.String(), err)
 		return
+	} else if !isSet {
+		apiLogger.Infof("cache for %s is already set", request.URL.String())
 	} else {
 		apiLogger.Infof("cache for %s is set for ttl(%d)", request.URL.String(), int(ttl.Seconds()))
 	}
 }
 
-// Set sets the routing for the gin engine
-// TODO move whitelist to YouTube relay service
-func Set(r *gin.Engine, appName string, relayService ytrelay.VideoRelay, whitelist ytrelay.APIWhitelist, cacheConf config.Cache, cacheProvider cache.Rediser) error {
+// breakerStater reports the states of the circuit breakers of a relay
+type breakerStater interface {
+	BreakerStates() map[string]resilience.State
+}
 
+// SetHealth sets the health check api, which is kept for the existing probes. /healthz and /readyz of the server check the dependencies.
+// The states of the circuit breakers are reported if the relay has them.
+func SetHealth(r gin.IRouter, relayService ytrelay.VideoRelay) {
 	// health check api
 	// As more resources and component are used, they should be checked in the api
 	r.GET("/health", func(c *gin.Context) {
-		c.AbortWithStatus(http.StatusOK)
+		stater, ok := relayService.(breakerStater)
+		if !ok {
+			c.AbortWithStatus(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusOK, gin.H{
+			"status":   "ok",
+			"breakers": stater.BreakerStates(),
+		})
 	})
+}
+
+// StatusClientClosedRequest is the status of the requests whose clients went away before the response, following the convention of nginx
+const StatusClientClosedRequest = 499
+
+// relayErrorStatus maps the error of the relay service to the http status
+func relayErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, quota.ErrBudgetExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest
+	case errors.Is(err, resilience.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, relay.ErrFixtureNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// newAPILogger creates the logger of the request with the path and the consumer
+func newAPILogger(c *gin.Context) *log.Entry {
+	fields := log.Fields{
+		"path": c.FullPath(),
+	}
+	if consumer := auth.Name(c.Request.Context()); consumer != "" {
+		fields[middleware.ConsumerKey] = consumer
+	}
+	return log.WithFields(fields)
+}
+
+// callRelay calls the relay with the request context bounded by the timeout of the route, and marks the request to be charged the upstream cost
+func callRelay(c *gin.Context, upstreamConf config.Upstream, call func(ctx context.Context) (interface{}, error)) (resp interface{}, err error) {
+	c.Set(middleware.UpstreamKey, true)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), upstreamConf.TimeoutOf(c.FullPath()))
+	defer cancel()
+	return call(ctx)
+}
+
+// Set sets the routing for the gin engine. The consumers are authenticated if authenticator is not nil, and the requests are rate limited if limiter is not nil.
+// TODO move whitelist to YouTube relay service
+func Set(r *gin.Engine, appName string, relayService ytrelay.VideoRelay, whitelist ytrelay.APIWhitelist, whitelistConf config.Whitelists, cacheConf config.Cache, cacheProvider cache.Provider, authenticator *auth.Authenticator, limiter *ratelimit.Limiter, upstreamConf config.Upstream) error {
+
+	isFilterMode := whitelistConf.ResponseMode == config.FilterMode
+
+	r.Use(otelgin.Middleware(appName), middleware.Metrics(appName))
+
+	SetHealth(r, relayService)
 
 	ytRouter := r.Group("/youtube/v3")
 
+	// authentication goes before the cache, so the cached responses are only served to the consumers
+	if authenticator != nil {
+		ytRouter.Use(middleware.Authenticate(authenticator))
+	}
+	// rate limiting goes before the cache as well, so cache hits are counted
+	if limiter != nil {
+		ytRouter.Use(middleware.RateLimit(limiter))
+	}
+
 	if cacheConf.IsEnabled {
 		ytRouter.Use(middleware.Cache(appName, cacheConf, cacheProvider))
 	}
@@ -140,9 +243,9 @@ func Set(r *gin.Engine, appName string, relayService ytrelay.VideoRelay, whiteli
 	// search videos. ChannelID is required
 	ytRouter.GET("/search", func(c *gin.Context) {
 
-		apiLogger := log.WithFields(log.Fields{
-			"path": c.FullPath(),
-		})
+		apiLogger := newAPILogger(c)
+		// the whitelists of the consumer further restrict the ones of the tenant
+		whitelist := auth.Whitelist(c.Request.Context(), whitelist)
 
 		queries, err := parseQueries(c)
 		if err != nil {
@@ -162,6 +265,15 @@ func Set(r *gin.Engine, appName string, relayService ytrelay.VideoRelay, whiteli
 			return
 		}
 
+		// Check the parameters against the policy
+		if err = whitelist.ValidateParameters(ytwhitelist.SearchRoute, queries); err != nil {
+			apiLogger.Error(err)
+			resp := newValidationErrorResp(err)
+			saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusBadRequest, resp)
+			c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+			return
+		}
+
 		// Check whitelist
 		if !whitelist.ValidateChannelID(queries.ChannelID) {
 			err = fmt.Errorf("channelId(%s) is invalid", queries.ChannelID)
@@ -172,15 +284,35 @@ func Set(r *gin.Engine, appName string, relayService ytrelay.VideoRelay, whiteli
 			return
 		}
 
-		resp, err := relayService.Search(queries)
+		resp, err := callRelay(c, upstreamConf, func(ctx context.Context) (interface{}, error) { return relayService.Search(ctx, queries) })
 		if err != nil {
 			apiLogger.Error(err)
+			status := relayErrorStatus(err)
+			if status != StatusClientClosedRequest && cacheConf.IsEnabled && cacheConf.StaleTTL > 0 && middleware.ServeStale(c, appName, cacheProvider) {
+				return
+			}
 			resp := api.ErrorResp{Error: err.Error()}
-			saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusInternalServerError, resp)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, api.ErrorResp{Error: err.Error()})
+			// errors of the relay itself, e.g. the exhausted quota budget, are not cached
+			if status == http.StatusInternalServerError {
+				saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusInternalServerError, resp)
+			}
+			c.AbortWithStatusJSON(status, resp)
 			return
 		}
-		saveOKCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, resp)
+
+		// verify channel id of the results for YouTube
+		removedIDs, err := validateYouTubeSearchListResponse(whitelist, resp, isFilterMode)
+		if err != nil {
+			err = errors.Wrap(err, "some result's channel id is invalid")
+			apiLogger.Error(err)
+			resp := api.ErrorResp{Error: err.Error()}
+			saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusBadRequest, resp)
+			c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		header := setFilteredIDsHeader(c, apiLogger, removedIDs)
+		saveOKCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, resp, header)
 		c.JSON(http.StatusOK, resp)
 	})
 
@@ -188,9 +320,9 @@ func Set(r *gin.Engine, appName string, relayService ytrelay.VideoRelay, whiteli
 	// IDs of videos is required
 	ytRouter.GET("/videos", func(c *gin.Context) {
 
-		apiLogger := log.WithFields(log.Fields{
-			"path": c.FullPath(),
-		})
+		apiLogger := newAPILogger(c)
+		// the whitelists of the consumer further restrict the ones of the tenant
+		whitelist := auth.Whitelist(c.Request.Context(), whitelist)
 
 		queries, err := parseQueries(c)
 		if err != nil {
@@ -215,38 +347,60 @@ func Set(r *gin.Engine, appName string, relayService ytrelay.VideoRelay, whiteli
 			return
 		}
 
-		resp, err := relayService.ListByVideoIDs(queries)
+		// Check the parameters against the policy
+		if err = whitelist.ValidateParameters(ytwhitelist.VideosRoute, queries); err != nil {
+			apiLogger.Error(err)
+			resp := newValidationErrorResp(err)
+			saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusBadRequest, resp)
+			c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		// the channel id of every video is in the snippet, which is stripped before responding if it's not requested
+		upstreamQueries, isSnippetAdded := withSnippet(queries)
+		resp, err := callRelay(c, upstreamConf, func(ctx context.Context) (interface{}, error) {
+			return relayService.ListByVideoIDs(ctx, upstreamQueries)
+		})
 		if err != nil {
 			apiLogger.Error(err)
+			status := relayErrorStatus(err)
+			if status != StatusClientClosedRequest && cacheConf.IsEnabled && cacheConf.StaleTTL > 0 && middleware.ServeStale(c, appName, cacheProvider) {
+				return
+			}
 			resp := api.ErrorResp{Error: err.Error()}
-			saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusInternalServerError, resp)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, resp)
+			// errors of the relay itself, e.g. the exhausted quota budget, are not cached
+			if status == http.StatusInternalServerError {
+				saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusInternalServerError, resp)
+			}
+			c.AbortWithStatusJSON(status, resp)
 			return
 		}
 
 		// verify channel id for YouTube
-		_, isYouTube := relayService.(*relay.YouTubeServiceV3)
-		if isYouTube {
-			if err = validateYouTubeVideoListResponse(whitelist, resp); err != nil {
-				err = errors.Wrap(err, "some video's channel id is invalid")
-				apiLogger.Error(err)
-				resp := api.ErrorResp{Error: err.Error()}
-				saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusBadRequest, resp)
-				c.AbortWithStatusJSON(http.StatusBadRequest, resp)
-				return
-			}
+		removedIDs, err := validateYouTubeVideoListResponse(whitelist, resp, isFilterMode)
+		if err != nil {
+			err = errors.Wrap(err, "some video's channel id is invalid")
+			apiLogger.Error(err)
+			resp := api.ErrorResp{Error: err.Error()}
+			saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusBadRequest, resp)
+			c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+			return
+		}
+		if isSnippetAdded {
+			stripSnippets(resp)
 		}
 
-		saveOKCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, resp)
+		header := setFilteredIDsHeader(c, apiLogger, removedIDs)
+		saveOKCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, resp, header)
 		c.JSON(http.StatusOK, resp)
 	})
 
 	// list video by playlistID
 	ytRouter.GET("/playlistItems", func(c *gin.Context) {
 
-		apiLogger := log.WithFields(log.Fields{
-			"path": c.FullPath(),
-		})
+		apiLogger := newAPILogger(c)
+		// the whitelists of the consumer further restrict the ones of the tenant
+		whitelist := auth.Whitelist(c.Request.Context(), whitelist)
 
 		queries, err := parseQueries(c)
 		if err != nil {
@@ -266,8 +420,17 @@ func Set(r *gin.Engine, appName string, relayService ytrelay.VideoRelay, whiteli
 			return
 		}
 
+		// Check the parameters against the policy
+		if err = whitelist.ValidateParameters(ytwhitelist.PlaylistItemsRoute, queries); err != nil {
+			apiLogger.Error(err)
+			resp := newValidationErrorResp(err)
+			saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusBadRequest, resp)
+			c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+			return
+		}
+
 		// Check whitelist
-		if !whitelist.ValidatePlaylistIDs(queries.PlaylistID) {
+		if !whitelist.ValidatePlaylistIDs(c.Request.Context(), queries.PlaylistID) {
 			err = fmt.Errorf("playlistId(%s) is invalid", queries.PlaylistID)
 			apiLogger.Error(err)
 			resp := api.ErrorResp{Error: err.Error()}
@@ -276,22 +439,62 @@ func Set(r *gin.Engine, appName string, relayService ytrelay.VideoRelay, whiteli
 			return
 		}
 
-		resp, err := relayService.ListPlaylistVideos(queries)
+		// the owner channel of every video is in the snippet, which is stripped before responding if it's not requested
+		upstreamQueries, isSnippetAdded := queries, false
+		if whitelistConf.PlaylistMode == config.PlaylistChannelMode {
+			upstreamQueries, isSnippetAdded = withSnippet(queries)
+		}
+		resp, err := callRelay(c, upstreamConf, func(ctx context.Context) (interface{}, error) {
+			return relayService.ListPlaylistVideos(ctx, upstreamQueries)
+		})
 		if err != nil {
 			apiLogger.Error(err)
+			status := relayErrorStatus(err)
+			if status != StatusClientClosedRequest && cacheConf.IsEnabled && cacheConf.StaleTTL > 0 && middleware.ServeStale(c, appName, cacheProvider) {
+				return
+			}
 			resp := api.ErrorResp{Error: err.Error()}
-			saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusInternalServerError, resp)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, resp)
+			// errors of the relay itself, e.g. the exhausted quota budget, are not cached
+			if status == http.StatusInternalServerError {
+				saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusInternalServerError, resp)
+			}
+			c.AbortWithStatusJSON(status, resp)
 			return
 		}
 
-		saveOKCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, resp)
+		// verify the owner channel of every video when playlists are whitelisted by their channels
+		var removedIDs []string
+		if whitelistConf.PlaylistMode == config.PlaylistChannelMode {
+			if removedIDs, err = validateYouTubePlaylistItemListResponse(whitelist, resp, isFilterMode); err != nil {
+				err = errors.Wrap(err, "some video's owner channel id is invalid")
+				apiLogger.Error(err)
+				resp := api.ErrorResp{Error: err.Error()}
+				saveErrCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, http.StatusBadRequest, resp)
+				c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+				return
+			}
+		}
+		if isSnippetAdded {
+			stripSnippets(resp)
+		}
+
+		header := setFilteredIDsHeader(c, apiLogger, removedIDs)
+		saveOKCache(cacheConf.IsEnabled, cacheConf, cacheProvider, apiLogger, appName, *c.Request, resp, header)
 		c.JSON(http.StatusOK, resp)
 	})
 
 	return nil
 }
 
+// newValidationErrorResp carries the details of the invalid parameters if err is ValidationErrors
+func newValidationErrorResp(err error) api.ErrorResp {
+	resp := api.ErrorResp{Error: err.Error()}
+	if details, ok := err.(ytrelay.ValidationErrors); ok {
+		resp.Details = details
+	}
+	return resp
+}
+
 func parseQueries(c *gin.Context) (ytrelay.Options, error) {
 	var queries ytrelay.Options
 	err := c.BindQuery(&queries)
@@ -299,12 +502,137 @@ func parseQueries(c *gin.Context) (ytrelay.Options, error) {
 	return queries, err
 }
 
-func validateYouTubeVideoListResponse(whitelist ytrelay.APIWhitelist, resp interface{}) (err error) {
-	for _, item := range resp.(*youtube.VideoListResponse).Items {
-		if !whitelist.ValidateChannelID(item.Snippet.ChannelId) {
+// setFilteredIDsHeader sets the ids removed in the filter mode to the response header and returns the header for the cache
+func setFilteredIDsHeader(c *gin.Context, apiLogger *log.Entry, removedIDs []string) map[string]string {
+	if len(removedIDs) == 0 {
+		return nil
+	}
+	ids := strings.Join(removedIDs, ",")
+	apiLogger.Infof("items(%s) of non-whitelisted channels are filtered out", ids)
+	c.Header(FilteredIDsHeader, ids)
+	return map[string]string{FilteredIDsHeader: ids}
+}
+
+// withSnippet adds the snippet part, which has the channel ids to validate, to the options for the upstream.
+// isAdded reports if it's not requested, so it's stripped from the response by stripSnippets.
+func withSnippet(options ytrelay.Options) (upstream ytrelay.Options, isAdded bool) {
+	for _, part := range strings.Split(options.Part, ",") {
+		if strings.TrimSpace(part) == "snippet" {
+			return options, false
+		}
+	}
+	options.Part += ",snippet"
+	return options, true
+}
+
+// stripSnippets removes the snippets added by withSnippet from the response
+func stripSnippets(resp interface{}) {
+	switch r := resp.(type) {
+	case *youtube.VideoListResponse:
+		for _, item := range r.Items {
+			item.Snippet = nil
+		}
+	case *youtube.PlaylistItemListResponse:
+		for _, item := range r.Items {
+			item.Snippet = nil
+		}
+	}
+}
+
+// adjustTotalResults deducts the removed items from totalResults
+func adjustTotalResults(pageInfo *youtube.PageInfo, removed int) {
+	if pageInfo == nil || removed == 0 {
+		return
+	}
+	pageInfo.TotalResults -= int64(removed)
+	if pageInfo.TotalResults < 0 {
+		pageInfo.TotalResults = 0
+	}
+}
+
+// validateYouTubeSearchListResponse checks the channel id of the results, which is only available with the snippet part.
+// In the filter mode, the offending results are removed and their ids are returned instead of an error.
+func validateYouTubeSearchListResponse(whitelist ytrelay.APIWhitelist, resp interface{}, filter bool) (removedIDs []string, err error) {
+	results, isYouTube := resp.(*youtube.SearchListResponse)
+	if !isYouTube {
+		return nil, nil
+	}
+	items := results.Items[:0]
+	for _, item := range results.Items {
+		if item.Snippet == nil || whitelist.ValidateChannelID(item.Snippet.ChannelId) {
+			items = append(items, item)
+			continue
+		}
+		if !filter {
+			return nil, fmt.Errorf("channelId(%s) is invalid", item.Snippet.ChannelId)
+		}
+		var id string
+		if item.Id != nil {
+			id = item.Id.VideoId + item.Id.ChannelId + item.Id.PlaylistId
+		}
+		removedIDs = append(removedIDs, id)
+	}
+	results.Items = items
+	adjustTotalResults(results.PageInfo, len(removedIDs))
+	return removedIDs, nil
+}
+
+// validateYouTubeVideoListResponse checks the channel id of the videos. The videos without the snippet are invalid, e.g. if it's excluded by fields.
+// In the filter mode, the offending videos are removed and their ids are returned instead of an error.
+func validateYouTubeVideoListResponse(whitelist ytrelay.APIWhitelist, resp interface{}, filter bool) (removedIDs []string, err error) {
+	videos, isYouTube := resp.(*youtube.VideoListResponse)
+	if !isYouTube {
+		return nil, nil
+	}
+	items := videos.Items[:0]
+	for _, item := range videos.Items {
+		if item.Snippet != nil && whitelist.ValidateChannelID(item.Snippet.ChannelId) {
+			items = append(items, item)
+			continue
+		}
+		if !filter {
+			if item.Snippet == nil {
+				return nil, fmt.Errorf("snippet of video(%s) is missing", item.Id)
+			}
 			err = fmt.Errorf("channelId(%s) is invalid", item.Snippet.ChannelId)
-			return err
+			return nil, err
 		}
+		removedIDs = append(removedIDs, item.Id)
 	}
-	return nil
+	videos.Items = items
+	adjustTotalResults(videos.PageInfo, len(removedIDs))
+	return removedIDs, nil
+}
+
+// validateYouTubePlaylistItemListResponse checks videoOwnerChannelId, which is empty for private or deleted videos. The items without the snippet are invalid, e.g. if it's excluded by fields.
+// In the filter mode, the offending items are removed and their video ids are returned instead of an error.
+func validateYouTubePlaylistItemListResponse(whitelist ytrelay.APIWhitelist, resp interface{}, filter bool) (removedIDs []string, err error) {
+	playlistItems, isYouTube := resp.(*youtube.PlaylistItemListResponse)
+	if !isYouTube {
+		return nil, nil
+	}
+	items := playlistItems.Items[:0]
+	for _, item := range playlistItems.Items {
+		if item.Snippet != nil && (item.Snippet.VideoOwnerChannelId == "" || whitelist.ValidateChannelID(item.Snippet.VideoOwnerChannelId)) {
+			items = append(items, item)
+			continue
+		}
+		if !filter {
+			if item.Snippet == nil {
+				return nil, fmt.Errorf("snippet of playlist item(%s) is missing", item.Id)
+			}
+			err = fmt.Errorf("videoOwnerChannelId(%s) is invalid", item.Snippet.VideoOwnerChannelId)
+			return nil, err
+		}
+		id := item.Id
+		if item.Snippet != nil && item.Snippet.ResourceId != nil {
+			id = item.Snippet.ResourceId.VideoId
+		} else if item.ContentDetails != nil {
+			id = item.ContentDetails.VideoId
+		}
+		removedIDs = append(removedIDs, id)
+	}
+	playlistItems.Items = items
+	adjustTotalResults(playlistItems.PageInfo, len(removedIDs))
+	return removedIDs, nil
 }
@@ -1,22 +1,52 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
-	ytrelay "github.com/mirror-media/yt-relay"
 	"github.com/mirror-media/yt-relay/cache"
 	"github.com/mirror-media/yt-relay/config"
-	"github.com/mirror-media/yt-relay/whitelist"
+	"github.com/mirror-media/yt-relay/health"
+	"github.com/mirror-media/yt-relay/metrics"
+	"github.com/mirror-media/yt-relay/server/route"
+	"github.com/mirror-media/yt-relay/tracing"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Server struct {
-	APIWhitelist ytrelay.APIWhitelist
-	Cache        cache.Rediser
-	conf         *config.Conf
-	Engine       *gin.Engine
+	Cache cache.Provider
+	Redis cache.Rediser
+	// Store keeps the states beyond the response cache, e.g. whitelists. It's redis if available, or the cache provider otherwise.
+	Store cache.Provider
+	// Tenants are all the tenants, and the default one, if it's defined, comes first
+	Tenants []*Tenant
+	// defaultTenant serves the requests which don't match any other tenant. It's nil if there is no default tenant.
+	defaultTenant *Tenant
+	// conf is the configuration in effect, which is swapped on reload
+	conf *config.Conf
+	// reloadMu serializes the reloads
+	reloadMu sync.Mutex
+	// stopWatch stops watching the configuration file
+	stopWatch func()
+	metrics   http.Handler
+	// health serves the liveness and readiness probes
+	health http.Handler
+	// certs is the certificate for https. It's nil if TLS isn't configured.
+	certs *certReloader
+	// shutdownTracing flushes the pending spans
+	shutdownTracing func(context.Context) error
+	// Engine serves the requests which don't match any tenant if there is no default tenant
+	Engine *gin.Engine
 }
 
 func init() {
@@ -24,38 +54,240 @@ func init() {
 	log.SetReportCaller(true)
 }
 
+// newHTTPServer creates the http server of the handler with the configured timeouts and limits
+func (s *Server) newHTTPServer(port int, handler http.Handler) *http.Server {
+	conf := s.conf.Server
+	srv := &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", s.conf.Address, port),
+		Handler:           handler,
+		ReadTimeout:       conf.ReadTimeout,
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+		MaxHeaderBytes:    conf.MaxHeaderBytes,
+	}
+	if srv.ReadTimeout == 0 {
+		srv.ReadTimeout = config.DefaultReadTimeout
+	}
+	if srv.ReadHeaderTimeout == 0 {
+		srv.ReadHeaderTimeout = config.DefaultReadHeaderTimeout
+	}
+	if srv.WriteTimeout == 0 {
+		srv.WriteTimeout = config.DefaultWriteTimeout
+	}
+	if srv.IdleTimeout == 0 {
+		srv.IdleTimeout = config.DefaultIdleTimeout
+	}
+	if srv.MaxHeaderBytes == 0 {
+		srv.MaxHeaderBytes = config.DefaultMaxHeaderBytes
+	}
+	return srv
+}
+
+// plainHandler serves only the health checks and the metrics, which are served over plain http next to https
+func (s *Server) plainHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(metrics.Path, s.metrics)
+	mux.Handle(health.LivenessPath, s.health)
+	mux.Handle(health.ReadinessPath, s.health)
+	return mux
+}
+
+// Run serves until SIGTERM or SIGINT, then stops accepting connections, waits for the in-flight requests and closes the server.
+// There are no cache writes detached from the requests, i.e. the responses and their stale copies are cached by the handlers, so draining the requests finishes them.
+// The background refreshes, i.e. the whitelist loaders and the configuration watcher, are waited for by Close.
+// It serves https with the reloaded certificate if TLS is configured.
 func (s *Server) Run() error {
-	return s.Engine.Run(fmt.Sprintf("%s:%d", s.conf.Address, s.conf.Port))
+	srv := s.newHTTPServer(s.conf.Port, s)
+	servers := []*http.Server{srv}
+	timeout := s.conf.Server.ShutdownTimeout
+	if timeout == 0 {
+		timeout = config.DefaultShutdownTimeout
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	errCh := make(chan error, 2)
+	if s.certs != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.certs.watch(ctx)
+
+		srv.TLSConfig = s.certs.tlsConfig()
+		go func() {
+			log.Infof("serving https at %s", srv.Addr)
+			errCh <- srv.ListenAndServeTLS("", "")
+		}()
+
+		if port := s.conf.TLS.HTTPPort; port != 0 {
+			plain := s.newHTTPServer(port, s.plainHandler())
+			servers = append(servers, plain)
+			go func() {
+				log.Infof("serving health checks and metrics over http at %s", plain.Addr)
+				errCh <- plain.ListenAndServe()
+			}()
+		}
+	} else {
+		go func() {
+			log.Infof("serving at %s", srv.Addr)
+			errCh <- srv.ListenAndServe()
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-errCh:
+		log.Errorf("serving encountered error: %v", err)
+	case sig := <-signals:
+		log.Infof("received %s", sig)
+	}
+
+	log.Infof("shutting down, waiting up to %s for the in-flight requests", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+			err = errors.Wrap(shutdownErr, "draining the in-flight requests encountered error")
+		}
+	}
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	log.Info("server is shut down")
+	return err
 }
 
-func New(c config.Conf) (s *Server, err error) {
+// Close stops the background refreshes of the tenants and waits for the running ones, then flushes the spans, and closes the cache and the redis clients
+func (s *Server) Close() error {
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	var err error
+	record := func(e error) {
+		if e != nil {
+			log.Error(e)
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	for _, t := range s.Tenants {
+		record(errors.Wrapf(t.Close(), "closing tenant(%s) encountered error", t.Conf.AppName))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	record(errors.Wrap(s.shutdownTracing(ctx), "flushing spans encountered error"))
+
+	if closer, ok := s.Cache.(io.Closer); ok {
+		record(errors.Wrap(closer.Close(), "closing cache encountered error"))
+	}
+	if closer, ok := s.Redis.(io.Closer); ok {
+		record(errors.Wrap(closer.Close(), "closing redis encountered error"))
+	}
+	return err
+}
+
+// ServeHTTP dispatches the request to the tenant selected by the Host header or the path prefix. The metrics are served for every tenant.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case metrics.Path:
+		s.metrics.ServeHTTP(w, r)
+		return
+	case health.LivenessPath, health.ReadinessPath:
+		s.health.ServeHTTP(w, r)
+		return
+	}
+	for _, t := range s.Tenants {
+		if t.matchHost(r.Host) {
+			t.ServeHTTP(w, r)
+			return
+		}
+	}
+	for _, t := range s.Tenants {
+		if stripped, ok := t.stripPrefix(r); ok {
+			t.ServeHTTP(w, stripped)
+			return
+		}
+	}
+	if s.defaultTenant != nil {
+		s.defaultTenant.ServeHTTP(w, r)
+		return
+	}
+	s.Engine.ServeHTTP(w, r)
+}
 
-	engine := gin.Default()
+func New(c config.Conf) (s *Server, err error) {
 
-	var redis cache.Rediser
+	shutdownTracing, err := tracing.Init(context.Background(), c.Tracing)
+	if err != nil {
+		return nil, err
+	}
 
-	if c.Redis != nil {
-		redis, err = cache.NewRedis(c)
-		if err != nil {
+	var certs *certReloader
+	if c.TLS != nil {
+		if certs, err = newCertReloader(*c.TLS); err != nil {
 			return nil, err
 		}
 	}
 
-	var cache cache.Rediser
-	if c.Cache.IsEnabled {
-		if redis == nil {
-			return nil, fmt.Errorf("there is no cache provider")
-		}
-		cache = redis
+	stores, err := cache.Open(c)
+	if err != nil {
+		return nil, err
 	}
+	rdb, cacheProvider, store := stores.Redis, stores.Cache, stores.Store
 
 	s = &Server{
-		APIWhitelist: &whitelist.YouTubeAPI{
-			Whitelist: c.Whitelists,
-		},
-		Cache:  cache,
-		conf:   &c,
-		Engine: engine,
+		Cache:   cacheProvider,
+		Redis:   rdb,
+		Store:   store,
+		conf:    &c,
+		metrics: metrics.Handler(),
+		certs:   certs,
+
+		shutdownTracing: shutdownTracing,
 	}
+
+	for _, tc := range c.AllTenants() {
+		t, err := NewTenant(c, tc, rdb, cacheProvider, store)
+		if err != nil {
+			return nil, err
+		}
+		s.Tenants = append(s.Tenants, t)
+		// only the default tenant without prefix and hosts serves the unmatched requests
+		if tc.AppName == c.Tenant.AppName && tc.PathPrefix == "" && len(tc.Hosts) == 0 {
+			s.defaultTenant = t
+		}
+	}
+	if s.defaultTenant == nil {
+		if s.Engine, err = newEngine(c.Server); err != nil {
+			return nil, err
+		}
+		route.SetHealth(s.Engine, nil)
+	}
+	s.health = s.newChecker().Handler()
 	return s, nil
 }
+
+// newChecker checks redis in any topology, the cache if it's not stored in redis, and the relay of every tenant
+func (s *Server) newChecker() *health.Checker {
+	checker := health.NewChecker(s.conf.Health)
+	if s.Redis != nil {
+		checker.Add("redis", health.Redis(s.Redis))
+	}
+	if s.Cache != nil && s.conf.Cache.Backend != "" && s.conf.Cache.Backend != config.RedisBackend {
+		checker.Add("cache", health.Cache(s.Cache))
+	}
+	for _, t := range s.Tenants {
+		if len(t.Relay.BreakerStates()) > 0 {
+			checker.Add(t.Conf.AppName+".breakers", health.Breakers(t.Relay))
+		}
+		checker.Add(t.Conf.AppName+".quota", health.Quota(t.Quota))
+		if s.conf.Health.UpstreamProbe != nil {
+			checker.Add(t.Conf.AppName+".upstream", health.Upstream(t.Relay, *s.conf.Health.UpstreamProbe))
+		}
+	}
+	return checker
+}
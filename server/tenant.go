@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/auth"
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/feed"
+	"github.com/mirror-media/yt-relay/metrics"
+	"github.com/mirror-media/yt-relay/quota"
+	"github.com/mirror-media/yt-relay/ratelimit"
+	"github.com/mirror-media/yt-relay/relay"
+	"github.com/mirror-media/yt-relay/resilience"
+	"github.com/mirror-media/yt-relay/server/route"
+	"github.com/mirror-media/yt-relay/whitelist"
+	"github.com/pkg/errors"
+)
+
+// Tenant is an app served by the server with its own relay, whitelist, cache namespace and quota budget
+type Tenant struct {
+	// Conf is the configuration the tenant started with. The live settings are in the routes.
+	Conf  config.Tenant
+	Quota *quota.Tracker
+	Relay *resilience.Relay
+	// Authenticator authenticates the consumers. It's nil if the tenant doesn't require authentication.
+	Authenticator *auth.Authenticator
+	// Limiter limits the requests by the rules of the tenant and the rate limits of the consumers
+	Limiter *ratelimit.Limiter
+
+	// routes holds the *routes, which are swapped on reload
+	routes atomic.Value
+}
+
+// routes are the engine of the tenant and the whitelists it's built with
+type routes struct {
+	conf   config.Tenant
+	engine *gin.Engine
+	// dynamic refreshes the whitelists in the background. It's nil for the static whitelists.
+	dynamic *whitelist.Dynamic
+}
+
+// NewTenant creates the tenant of tc with its routes. The responses are cached in cacheProvider, and the other states, e.g. quota, are kept in store.
+// The rate limits are kept in rdb, or in memory if it's nil.
+func NewTenant(c config.Conf, tc config.Tenant, rdb cache.Rediser, cacheProvider cache.Provider, store cache.Provider) (*Tenant, error) {
+	t, err := newTenant(c, tc, rdb, store)
+	if err != nil {
+		return nil, err
+	}
+	r, err := t.newRoutes(c, tc, cacheProvider, store)
+	if err != nil {
+		return nil, err
+	}
+	t.swap(r)
+	return t, nil
+}
+
+func newTenant(c config.Conf, tc config.Tenant, rdb cache.Rediser, store cache.Provider) (*Tenant, error) {
+	youtubeService, err := relay.NewUpstream(context.Background(), tc.ApiKey, c.Upstream)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating relay for tenant(%s) encountered error", tc.AppName)
+	}
+	tracker := quota.NewTracker(tc.AppName, store, tc.Quota.DailyBudget)
+	var upstream ytrelay.VideoRelay = &metrics.Relay{VideoRelay: youtubeService, Tenant: tc.AppName}
+	// the quota is charged for every call to YouTube, so the feeds and the retries wrap it: the calls served by the feeds cost nothing,
+	// the exhausted budget falls back to the feeds without being retried, and every retried attempt is charged. The replayed fixtures cost no quota.
+	if !c.Upstream.IsReplay() {
+		upstream = &quota.Relay{VideoRelay: upstream, Tracker: tracker}
+	}
+	if c.Upstream.Feed != nil {
+		upstream = feed.New(upstream, *c.Upstream.Feed, c.Upstream.Timeout, tc.AppName)
+	}
+	relayService := resilience.New(upstream, c.Upstream)
+
+	var authenticator *auth.Authenticator
+	if tc.Auth != nil {
+		if authenticator, err = auth.NewAuthenticator(tc.AppName, *tc.Auth, store); err != nil {
+			return nil, errors.Wrapf(err, "creating authenticator for tenant(%s) encountered error", tc.AppName)
+		}
+	}
+
+	return &Tenant{
+		Conf:          tc,
+		Authenticator: authenticator,
+		Limiter:       ratelimit.New(tc.AppName, rdb, tc.RateLimits),
+		Quota:         tracker,
+		Relay:         relayService,
+	}, nil
+}
+
+// newRoutes builds the whitelists and the engine of the tenant with the configuration. Nothing is swapped until the routes are stored.
+func (t *Tenant) newRoutes(c config.Conf, tc config.Tenant, cacheProvider cache.Provider, store cache.Provider) (r *routes, err error) {
+	policies, err := whitelist.NewPolicies(tc.Policies)
+	if err != nil {
+		return nil, err
+	}
+	var apiWhitelist ytrelay.APIWhitelist = &whitelist.YouTubeAPI{
+		Policies:  policies,
+		Whitelist: tc.Whitelists,
+	}
+
+	// the whitelists are loaded per tenant, so the dynamic whitelist is created with the tenant's own configuration
+	tenantConf := c
+	tenantConf.Tenant = tc
+
+	engine, err := newEngine(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	r = &routes{conf: tc, engine: engine}
+	defer func() {
+		if err != nil && r.dynamic != nil {
+			_ = r.dynamic.Close()
+		}
+	}()
+
+	var whitelistStore *whitelist.Store
+	if tc.Whitelists.IsDynamic() {
+		if r.dynamic, err = whitelist.NewDynamic(tenantConf, store); err != nil {
+			return nil, errors.Wrapf(err, "creating whitelist for tenant(%s) encountered error", tc.AppName)
+		}
+		apiWhitelist = r.dynamic
+		if tc.Whitelists.Source.Type == config.RedisWhitelist {
+			whitelistStore = whitelist.NewStore(tc.AppName, store)
+		}
+	}
+
+	if tc.Whitelists.PlaylistMode == config.PlaylistChannelMode {
+		ttl := tc.Whitelists.PlaylistOwnerTTL
+		if ttl == 0 {
+			ttl = config.DefaultPlaylistOwnerTTL
+		}
+		apiWhitelist = whitelist.NewChannelPlaylists(apiWhitelist, t.Relay, store, tc.AppName, time.Duration(ttl)*time.Second)
+	}
+
+	if err = route.Set(r.engine, tc.AppName, t.Relay, apiWhitelist, tc.Whitelists, c.Cache, cacheProvider, t.Authenticator, t.Limiter, c.Upstream); err != nil {
+		return nil, errors.Wrapf(err, "setting routes of tenant(%s) encountered error", tc.AppName)
+	}
+	if c.Admin != nil && whitelistStore != nil {
+		if err = route.SetAdmin(r.engine, c.Admin.Token, whitelistStore); err != nil {
+			return nil, errors.Wrapf(err, "setting admin routes of tenant(%s) encountered error", tc.AppName)
+		}
+	}
+	return r, nil
+}
+
+// swap serves the routes and sets the rate limits they are built with. The previous routes are returned.
+// newEngine creates the gin engine which only trusts the forwarded client IPs from the trusted proxies
+func newEngine(conf config.HTTPServer) (*gin.Engine, error) {
+	engine := gin.Default()
+	if err := engine.SetTrustedProxies(conf.TrustedProxies); err != nil {
+		return nil, errors.Wrap(err, "setting trusted proxies encountered error")
+	}
+	return engine, nil
+}
+
+func (t *Tenant) swap(r *routes) *routes {
+	previous, _ := t.routes.Load().(*routes)
+	t.Limiter.SetRules(r.conf.RateLimits)
+	t.routes.Store(r)
+	return previous
+}
+
+func (t *Tenant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.routes.Load().(*routes).engine.ServeHTTP(w, r)
+}
+
+// Close stops the background refreshes of the tenant and waits for the running ones
+func (t *Tenant) Close() error {
+	if r, ok := t.routes.Load().(*routes); ok && r.dynamic != nil {
+		return r.dynamic.Close()
+	}
+	return nil
+}
+
+func (t *Tenant) matchHost(hostport string) bool {
+	if len(t.Conf.Hosts) == 0 {
+		return false
+	}
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	for _, h := range t.Conf.Hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripPrefix returns a shallow copy of the request without the path prefix of the tenant, like http.StripPrefix does.
+// RequestURI is stripped as well because it's the key of the cache.
+func (t *Tenant) stripPrefix(r *http.Request) (*http.Request, bool) {
+	prefix := t.Conf.PathPrefix
+	if prefix == "" || (r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/")) {
+		return nil, false
+	}
+	stripped := new(http.Request)
+	*stripped = *r
+	u := *r.URL
+	stripped.URL = &u
+	stripped.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	stripped.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+	stripped.RequestURI = strings.TrimPrefix(r.RequestURI, prefix)
+	if stripped.URL.Path == "" {
+		stripped.URL.Path = "/"
+	}
+	return stripped, true
+}
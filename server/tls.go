@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/filewatch"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// certReloader keeps the certificate and the client CAs, which are reloaded when the files change
+type certReloader struct {
+	conf config.TLS
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func newCertReloader(conf config.TLS) (*certReloader, error) {
+	r := &certReloader{conf: conf}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+	if err != nil {
+		return errors.Wrapf(err, "loading tls certificate(%s) encountered error", r.conf.CertFile)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.conf.ClientCAFile != "" {
+		ca, err := ioutil.ReadFile(r.conf.ClientCAFile)
+		if err != nil {
+			return errors.Wrapf(err, "reading tls client ca file(%s) encountered error", r.conf.ClientCAFile)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("there is no valid certificate in tls client ca file(%s)", r.conf.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.mu.Unlock()
+	return nil
+}
+
+// watch reloads the files when they change until ctx is done. The previous certificate is kept if the new one is invalid, e.g. only one of the files is updated.
+func (r *certReloader) watch(ctx context.Context) {
+	interval := r.conf.ReloadInterval
+	if interval == 0 {
+		interval = config.DefaultTLSReloadInterval
+	}
+	paths := []string{r.conf.CertFile, r.conf.KeyFile}
+	if r.conf.ClientCAFile != "" {
+		paths = append(paths, r.conf.ClientCAFile)
+	}
+	filewatch.Watch(ctx, interval, func() {
+		if err := r.reload(); err != nil {
+			log.Errorf("reloading tls certificate encountered error, the previous one is kept: %v", err)
+			return
+		}
+		log.Info("tls certificate is reloaded")
+	}, paths...)
+}
+
+// tlsConfig creates the config of the server. Every handshake gets the latest certificate and client CAs.
+func (r *certReloader) tlsConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: config.TLSVersions[r.conf.MinVersion],
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.cert, nil
+		},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.Certificates = []tls.Certificate{*r.cert}
+		if r.clientCAs != nil {
+			c.ClientCAs = r.clientCAs
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		return c, nil
+	}
+	return base
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mirror-media/yt-relay/api"
+)
+
+// WarmResult is the response to a request of the warm-up list
+type WarmResult struct {
+	Tenant string `json:"tenant"`
+	URI    string `json:"uri"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Warm requests the warm-up list of the tenants once through their routes, so the responses are validated and cached as they are served.
+// Only the tenant of appName is warmed if it's not empty, and token authenticates the requests to the tenants which require authentication.
+func (s *Server) Warm(appName string, token string) []WarmResult {
+	var results []WarmResult
+	for _, t := range s.Tenants {
+		if appName != "" && t.Conf.AppName != appName {
+			continue
+		}
+		for _, uri := range t.Conf.WarmUp {
+			result := WarmResult{Tenant: t.Conf.AppName, URI: uri}
+			r, err := http.NewRequest(http.MethodGet, uri, nil)
+			if err != nil {
+				result.Error = err.Error()
+				results = append(results, result)
+				continue
+			}
+			// the cache is keyed by the request uri, which is only set for the requests received by a server
+			r.RequestURI = uri
+			if token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			w := httptest.NewRecorder()
+			t.ServeHTTP(w, r)
+			result.Status = w.Code
+			if w.Code != http.StatusOK {
+				var resp api.ErrorResp
+				if json.Unmarshal(w.Body.Bytes(), &resp) == nil {
+					result.Error = resp.Error
+				}
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
@@ -0,0 +1,220 @@
+package whitelist
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/mirror-media/yt-relay/filewatch"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+type snapshot struct {
+	channelIDs  map[string]Entry
+	playlistIDs map[string]Entry
+}
+
+func isEffective(entries map[string]Entry, id string) bool {
+	entry, present := entries[id]
+	return present && entry.IsEffective(time.Now())
+}
+
+// Loader loads all the whitelist entries from the dynamic source
+type Loader interface {
+	Load(ctx context.Context) (channelIDs map[string]Entry, playlistIDs map[string]Entry, err error)
+}
+
+// Dynamic implements the Whitelist interface. The entries are reloaded from the source and swapped atomically.
+type Dynamic struct {
+	Policies
+	base    config.Whitelists
+	loader  Loader
+	current atomic.Value // *snapshot
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDynamic loads the whitelists from the configured source and starts to refresh them
+func NewDynamic(c config.Conf, provider cache.Provider) (*Dynamic, error) {
+	source := c.Whitelists.Source
+	if source == nil {
+		return nil, errors.New("there's no whitelist source")
+	}
+	interval := source.RefreshInterval
+	if interval == 0 {
+		interval = config.DefaultWhitelistRefreshInterval
+	}
+
+	policies, err := NewPolicies(c.Policies)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dynamic{Policies: policies, base: c.Whitelists}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+
+	switch source.Type {
+	case config.RedisWhitelist:
+		if provider == nil {
+			cancel()
+			return nil, errors.New("there's no redis for the whitelist source")
+		}
+		d.loader = NewStore(c.AppName, provider)
+		if err := d.Reload(ctx); err != nil {
+			cancel()
+			return nil, err
+		}
+		d.goRefresh(func() { d.refreshPeriodically(ctx, interval) })
+		if notifier, ok := provider.(cache.Notifier); ok && source.KeyspaceNotifications {
+			keys, err := notifier.Notify(ctx, Key(c.AppName, "*", "*"))
+			if err != nil {
+				log.Errorf("keyspace notifications are unavailable, whitelists are only refreshed every %s: %v", interval, err)
+			} else {
+				d.goRefresh(func() { d.refreshOnNotifications(ctx, keys) })
+			}
+		}
+	case config.FileWhitelist:
+		d.loader = &fileLoader{path: source.Path}
+		if err := d.Reload(ctx); err != nil {
+			cancel()
+			return nil, err
+		}
+		d.goRefresh(func() {
+			filewatch.Watch(ctx, interval, func() {
+				if err := d.Reload(ctx); err != nil {
+					log.Errorf("reloading whitelists encountered error, the previous ones are kept: %v", err)
+				}
+			}, source.Path)
+		})
+	default:
+		cancel()
+		return nil, fmt.Errorf("unsupported whitelist source type(%s)", source.Type)
+	}
+	return d, nil
+}
+
+func (d *Dynamic) goRefresh(f func()) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		f()
+	}()
+}
+
+// Reload loads the entries from the source, merges them with the configured ones and swaps them in
+func (d *Dynamic) Reload(ctx context.Context) error {
+	channelIDs, playlistIDs, err := d.loader.Load(ctx)
+	if err != nil {
+		return errors.Wrap(err, "loading whitelists encountered error")
+	}
+	s := &snapshot{
+		channelIDs:  merge(d.base.ChannelIDs, channelIDs),
+		playlistIDs: merge(d.base.PlaylistIDs, playlistIDs),
+	}
+	d.current.Store(s)
+	log.Infof("whitelists are loaded with %d channel ids and %d playlist ids", len(s.channelIDs), len(s.playlistIDs))
+	return nil
+}
+
+func merge(base map[string]bool, dynamic map[string]Entry) map[string]Entry {
+	merged := make(map[string]Entry, len(base)+len(dynamic))
+	for id, effective := range base {
+		merged[id] = Entry{Effective: effective}
+	}
+	for id, entry := range dynamic {
+		merged[id] = entry
+	}
+	return merged
+}
+
+func (d *Dynamic) refreshPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Reload(ctx); err != nil {
+				log.Errorf("refreshing whitelists encountered error, the previous ones are kept: %v", err)
+			}
+		}
+	}
+}
+
+// notificationDebounce batches the notifications of bulk changes into one reload
+const notificationDebounce = 500 * time.Millisecond
+
+func (d *Dynamic) refreshOnNotifications(ctx context.Context, keys <-chan string) {
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-keys:
+			if !ok {
+				log.Error("keyspace notifications of whitelists are closed")
+				return
+			}
+			if pending == nil {
+				pending = time.After(notificationDebounce)
+			}
+		case <-pending:
+			pending = nil
+			if err := d.Reload(ctx); err != nil {
+				log.Errorf("reloading whitelists on notification encountered error, the previous ones are kept: %v", err)
+			}
+		}
+	}
+}
+
+// Close stops refreshing the whitelists and waits for the running refresh
+func (d *Dynamic) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+	d.wg.Wait()
+	return nil
+}
+
+func (d *Dynamic) snapshot() *snapshot {
+	return d.current.Load().(*snapshot)
+}
+
+func (d *Dynamic) ValidateChannelID(channelID string) bool {
+	return isEffective(d.snapshot().channelIDs, channelID)
+}
+
+func (d *Dynamic) ValidatePlaylistIDs(ctx context.Context, playlistID string) bool {
+	return isEffective(d.snapshot().playlistIDs, playlistID)
+}
+
+// fileLoader loads the entries from a yaml file in the same format as the whitelists in the configuration
+type fileLoader struct {
+	path string
+}
+
+func (l *fileLoader) Load(ctx context.Context) (channelIDs map[string]Entry, playlistIDs map[string]Entry, err error) {
+	body, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "reading whitelist file(%s) encountered error", l.path)
+	}
+	var w config.Whitelists
+	if err = yaml.Unmarshal(body, &w); err != nil {
+		return nil, nil, errors.Wrapf(err, "unmarshalling whitelist file(%s) encountered error", l.path)
+	}
+	return merge(w.ChannelIDs, nil), merge(w.PlaylistIDs, nil), nil
+}
@@ -0,0 +1,104 @@
+package whitelist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/cache"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+)
+
+// playlistOwnerTimeout bounds resolving the owner within the request
+const playlistOwnerTimeout = 5 * time.Second
+
+// notFoundTTL is the ttl of the playlists which are not found, so they aren't resolved on every request but are allowed soon after they're created
+const notFoundTTL = 5 * time.Minute
+
+// isNotFound reports if the resolver tells the playlist doesn't exist
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.Is(err, ytrelay.ErrPlaylistNotFound) || (errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound)
+}
+
+// ChannelPlaylists wraps a whitelist to allow the playlists owned by the whitelisted channels as well.
+// The owner of playlists is resolved with the resolver and cached in the store.
+type ChannelPlaylists struct {
+	ytrelay.APIWhitelist
+	resolver  ytrelay.PlaylistOwnerResolver
+	store     cache.Provider
+	namespace string
+	ttl       time.Duration
+}
+
+// NewChannelPlaylists creates the whitelist. The owners are not cached if store is nil.
+func NewChannelPlaylists(whitelist ytrelay.APIWhitelist, resolver ytrelay.PlaylistOwnerResolver, store cache.Provider, namespace string, ttl time.Duration) *ChannelPlaylists {
+	return &ChannelPlaylists{
+		APIWhitelist: whitelist,
+		resolver:     resolver,
+		store:        store,
+		namespace:    namespace,
+		ttl:          ttl,
+	}
+}
+
+func (w *ChannelPlaylists) ownerKey(playlistID string) string {
+	return fmt.Sprintf("%s:playlist-owner:%s", w.namespace, playlistID)
+}
+
+// PlaylistOwner returns the channel id of the playlist from the store, or resolves and stores it.
+// The playlists which are not found are stored as well with an empty owner for notFoundTTL, and ErrPlaylistNotFound is returned for them.
+func (w *ChannelPlaylists) PlaylistOwner(ctx context.Context, playlistID string) (string, error) {
+	key := w.ownerKey(playlistID)
+	if w.store != nil {
+		owner, err := w.store.Get(ctx, key)
+		if err == nil {
+			if owner == "" {
+				return "", fmt.Errorf("%w: %s", ytrelay.ErrPlaylistNotFound, playlistID)
+			}
+			return owner, nil
+		} else if err != cache.ErrCacheMiss {
+			log.Errorf("getting owner of playlist(%s) from store encountered error: %v", playlistID, err)
+		}
+	}
+
+	owner, err := w.resolver.GetPlaylistOwner(ctx, playlistID)
+	ttl := w.ttl
+	if isNotFound(err) {
+		owner, ttl = "", notFoundTTL
+	} else if err != nil {
+		return "", fmt.Errorf("resolving owner of playlist(%s) encountered error: %w", playlistID, err)
+	}
+	if w.store != nil {
+		if err := w.store.Set(ctx, key, owner, ttl); err != nil {
+			log.Errorf("storing owner of playlist(%s) encountered error: %v", playlistID, err)
+		}
+	}
+	if owner == "" {
+		return "", fmt.Errorf("%w: %s", ytrelay.ErrPlaylistNotFound, playlistID)
+	}
+	return owner, nil
+}
+
+// ValidatePlaylistIDs allows the playlist if it's whitelisted or its owner channel is whitelisted
+func (w *ChannelPlaylists) ValidatePlaylistIDs(ctx context.Context, playlistID string) bool {
+	if w.APIWhitelist.ValidatePlaylistIDs(ctx, playlistID) {
+		return true
+	}
+	if playlistID == "" {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, playlistOwnerTimeout)
+	defer cancel()
+	owner, err := w.PlaylistOwner(ctx, playlistID)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	return w.APIWhitelist.ValidateChannelID(owner)
+}
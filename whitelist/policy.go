@@ -0,0 +1,197 @@
+package whitelist
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ytrelay "github.com/mirror-media/yt-relay"
+	"github.com/mirror-media/yt-relay/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	SearchRoute        = "/youtube/v3/search"
+	VideosRoute        = "/youtube/v3/videos"
+	PlaylistItemsRoute = "/youtube/v3/playlistItems"
+)
+
+// DefaultPolicies are the built-in policies according to the parameters the relay supports
+var DefaultPolicies = map[string]config.RoutePolicy{
+	SearchRoute: {
+		Parts:    []string{"id", "snippet"},
+		Required: []string{"part", "channelId"},
+		Enums: map[string][]string{
+			"eventType":  {"completed", "live", "upcoming"},
+			"order":      {"date", "rating", "relevance", "title", "videoCount", "viewCount"},
+			"safeSearch": {"moderate", "none", "strict"},
+			"type":       {"channel", "playlist", "video"},
+		},
+		MaxResults: 50,
+	},
+	VideosRoute: {
+		Parts:      []string{"contentDetails", "id", "liveStreamingDetails", "player", "recordingDetails", "snippet", "statistics", "status", "topicDetails"},
+		Required:   []string{"part", "id"},
+		MaxResults: 50,
+	},
+	PlaylistItemsRoute: {
+		Parts:      []string{"contentDetails", "id", "snippet", "status"},
+		Required:   []string{"part", "playlistId"},
+		MaxResults: 50,
+	},
+}
+
+type policy struct {
+	parts        map[string]bool
+	required     []string
+	enums        map[string]map[string]bool
+	maxResults   int64
+	queryPattern *regexp.Regexp
+}
+
+// Policies validates the parameters of requests per route
+type Policies map[string]*policy
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// NewPolicies merges the configured policies into the default ones and compiles them
+func NewPolicies(conf map[string]config.RoutePolicy) (Policies, error) {
+	merged := make(map[string]config.RoutePolicy, len(DefaultPolicies)+len(conf))
+	for route, p := range DefaultPolicies {
+		merged[route] = p
+	}
+	for route, p := range conf {
+		base := merged[route]
+		if len(p.Parts) > 0 {
+			base.Parts = p.Parts
+		}
+		if len(p.Required) > 0 {
+			base.Required = p.Required
+		}
+		if len(p.Enums) > 0 {
+			enums := make(map[string][]string, len(base.Enums)+len(p.Enums))
+			for parameter, values := range base.Enums {
+				enums[parameter] = values
+			}
+			for parameter, values := range p.Enums {
+				enums[parameter] = values
+			}
+			base.Enums = enums
+		}
+		if p.MaxResults > 0 {
+			base.MaxResults = p.MaxResults
+		}
+		if p.QueryPattern != "" {
+			base.QueryPattern = p.QueryPattern
+		}
+		merged[route] = base
+	}
+
+	policies := make(Policies, len(merged))
+	for route, p := range merged {
+		compiled := &policy{
+			parts:      toSet(p.Parts),
+			required:   p.Required,
+			enums:      make(map[string]map[string]bool, len(p.Enums)),
+			maxResults: p.MaxResults,
+		}
+		for parameter, values := range p.Enums {
+			compiled.enums[parameter] = toSet(values)
+		}
+		if p.QueryPattern != "" {
+			re, err := regexp.Compile(p.QueryPattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "queryPattern of the policy of %s is invalid", route)
+			}
+			compiled.queryPattern = re
+		}
+		policies[route] = compiled
+	}
+	return policies, nil
+}
+
+// optionValues maps the parameter names in the form tags to the values of options
+func optionValues(options ytrelay.Options) map[string]string {
+	values := make(map[string]string)
+	v := reflect.ValueOf(options)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("form")
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			values[name] = f.String()
+		case reflect.Int64:
+			if f.Int() != 0 {
+				values[name] = strconv.FormatInt(f.Int(), 10)
+			}
+		}
+	}
+	return values
+}
+
+// ValidateParameters validates the options against the policy of the route. Routes without policies are not restricted.
+func (policies Policies) ValidateParameters(route string, options ytrelay.Options) error {
+	p, ok := policies[route]
+	if !ok {
+		return nil
+	}
+
+	var errs ytrelay.ValidationErrors
+	values := optionValues(options)
+
+	for _, parameter := range p.required {
+		if values[parameter] == "" {
+			errs = append(errs, ytrelay.ValidationError{Parameter: parameter, Reason: "is required"})
+		}
+	}
+
+	if len(p.parts) > 0 && options.Part != "" {
+		for _, part := range strings.Split(options.Part, ",") {
+			if !p.parts[strings.TrimSpace(part)] {
+				errs = append(errs, ytrelay.ValidationError{Parameter: "part", Reason: fmt.Sprintf("%s is not allowed", part)})
+			}
+		}
+	}
+
+	parameters := make([]string, 0, len(p.enums))
+	for parameter := range p.enums {
+		parameters = append(parameters, parameter)
+	}
+	sort.Strings(parameters)
+	for _, parameter := range parameters {
+		allowed := p.enums[parameter]
+		value := values[parameter]
+		if value == "" {
+			continue
+		}
+		for _, v := range strings.Split(value, ",") {
+			if !allowed[strings.TrimSpace(v)] {
+				errs = append(errs, ytrelay.ValidationError{Parameter: parameter, Reason: fmt.Sprintf("%s is not allowed", v)})
+			}
+		}
+	}
+
+	if options.MaxResults < 0 {
+		errs = append(errs, ytrelay.ValidationError{Parameter: "maxResults", Reason: "cannot be negative"})
+	} else if p.maxResults > 0 && options.MaxResults > p.maxResults {
+		errs = append(errs, ytrelay.ValidationError{Parameter: "maxResults", Reason: fmt.Sprintf("cannot exceed %d", p.maxResults)})
+	}
+
+	if p.queryPattern != nil && options.Query != "" && !p.queryPattern.MatchString(options.Query) {
+		errs = append(errs, ytrelay.ValidationError{Parameter: "q", Reason: fmt.Sprintf("does not match %s", p.queryPattern)})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
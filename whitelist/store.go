@@ -0,0 +1,278 @@
+package whitelist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mirror-media/yt-relay/cache"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kind is the kind of whitelist entries
+type Kind string
+
+const (
+	ChannelKind  Kind = "channel"
+	PlaylistKind Kind = "playlist"
+)
+
+// ParseKind converts the string to Kind, and the plural form is accepted as well
+func ParseKind(s string) (Kind, error) {
+	switch Kind(strings.TrimSuffix(s, "s")) {
+	case ChannelKind:
+		return ChannelKind, nil
+	case PlaylistKind:
+		return PlaylistKind, nil
+	default:
+		return "", fmt.Errorf("whitelist kind(%s) is invalid, it should be %s or %s", s, ChannelKind, PlaylistKind)
+	}
+}
+
+// Entry is a whitelist entry stored in the dynamic source
+type Entry struct {
+	Effective bool       `json:"effective"`
+	Note      string     `json:"note,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	UpdatedAt time.Time  `json:"updatedAt,omitempty"`
+	UpdatedBy string     `json:"updatedBy,omitempty"`
+}
+
+// IsEffective reports if the entry is effective and not expired at t
+func (e Entry) IsEffective(t time.Time) bool {
+	return e.Effective && (e.ExpiresAt == nil || t.Before(*e.ExpiresAt))
+}
+
+// Key returns the key of the whitelist entry in the store
+func Key(namespace string, kind Kind, id string) string {
+	return fmt.Sprintf("%s:whitelist:%s:%s", namespace, kind, id)
+}
+
+type AuditAction string
+
+const (
+	AuditPut    AuditAction = "put"
+	AuditRemove AuditAction = "remove"
+)
+
+// AuditRecord records a change of the whitelists
+type AuditRecord struct {
+	Time     time.Time   `json:"time"`
+	Actor    string      `json:"actor"`
+	Action   AuditAction `json:"action"`
+	Kind     Kind        `json:"kind"`
+	ID       string      `json:"id"`
+	Entry    *Entry      `json:"entry,omitempty"`
+	Previous *Entry      `json:"previous,omitempty"`
+}
+
+// Store manages the whitelist entries in the cache provider and writes every change to the audit log.
+// It implements Loader for the dynamic whitelists.
+type Store struct {
+	namespace string
+	provider  cache.Provider
+}
+
+func NewStore(namespace string, provider cache.Provider) *Store {
+	return &Store{
+		namespace: namespace,
+		provider:  provider,
+	}
+}
+
+const (
+	// AuditRetention is how long the audit records are kept in the store
+	AuditRetention = 90 * 24 * time.Hour
+	// AuditCap is how many of the latest audit records are kept in the store
+	AuditCap = 10000
+)
+
+// auditSeqKey counts the audit records, which are numbered by the count
+func (s *Store) auditSeqKey() string {
+	return fmt.Sprintf("%s:whitelist-audit:seq", s.namespace)
+}
+
+func (s *Store) auditKey(seq int64) string {
+	return fmt.Sprintf("%s:whitelist-audit:record:%d", s.namespace, seq)
+}
+
+// Get returns the entry. present is false if it doesn't exist or has expired.
+func (s *Store) Get(ctx context.Context, kind Kind, id string) (entry Entry, present bool, err error) {
+	key := Key(s.namespace, kind, id)
+	value, err := s.provider.Get(ctx, key)
+	if err == cache.ErrCacheMiss {
+		return entry, false, nil
+	} else if err != nil {
+		return entry, false, errors.Wrapf(err, "getting whitelist entry(%s) encountered error", key)
+	}
+	if err = json.Unmarshal([]byte(value), &entry); err != nil {
+		return entry, false, errors.Wrapf(err, "whitelist entry(%s) is malformed", key)
+	}
+	return entry, true, nil
+}
+
+// Put adds or updates the entry. The entry is removed from the store when it expires.
+func (s *Store) Put(ctx context.Context, actor string, kind Kind, id string, entry Entry) error {
+	if id == "" {
+		return errors.New("whitelist id cannot be empty")
+	}
+	now := time.Now()
+	var ttl time.Duration
+	if entry.ExpiresAt != nil {
+		if ttl = entry.ExpiresAt.Sub(now); ttl <= 0 {
+			return fmt.Errorf("expiry(%s) has passed", entry.ExpiresAt.Format(time.RFC3339))
+		}
+	}
+	entry.UpdatedAt = now
+	entry.UpdatedBy = actor
+
+	previous, present, err := s.Get(ctx, kind, id)
+	if err != nil {
+		log.Errorf("previous whitelist entry of %s(%s) is unavailable for audit: %v", kind, id, err)
+	}
+
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "marshalling whitelist entry encountered error")
+	}
+	if err = s.provider.Set(ctx, Key(s.namespace, kind, id), string(value), ttl); err != nil {
+		return errors.Wrapf(err, "setting whitelist entry of %s(%s) encountered error", kind, id)
+	}
+
+	record := AuditRecord{Time: now, Actor: actor, Action: AuditPut, Kind: kind, ID: id, Entry: &entry}
+	if present {
+		record.Previous = &previous
+	}
+	s.audit(ctx, record)
+	return nil
+}
+
+// Remove deletes the entry
+func (s *Store) Remove(ctx context.Context, actor string, kind Kind, id string) error {
+	previous, present, err := s.Get(ctx, kind, id)
+	if err != nil {
+		log.Errorf("previous whitelist entry of %s(%s) is unavailable for audit: %v", kind, id, err)
+	}
+	if err = s.provider.Delete(ctx, Key(s.namespace, kind, id)); err != nil {
+		return errors.Wrapf(err, "deleting whitelist entry of %s(%s) encountered error", kind, id)
+	}
+
+	record := AuditRecord{Time: time.Now(), Actor: actor, Action: AuditRemove, Kind: kind, ID: id}
+	if present {
+		record.Previous = &previous
+	}
+	s.audit(ctx, record)
+	return nil
+}
+
+// List returns all the entries of the kind
+func (s *Store) List(ctx context.Context, kind Kind) (map[string]Entry, error) {
+	prefix := Key(s.namespace, kind, "")
+	keys, err := s.provider.Scan(ctx, prefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]Entry, len(keys))
+	for _, key := range keys {
+		id := strings.TrimPrefix(key, prefix)
+		entry, present, err := s.Get(ctx, kind, id)
+		if err != nil {
+			log.Errorf("whitelist entry(%s) is skipped: %v", key, err)
+			continue
+		}
+		// deleted after scanning
+		if !present {
+			continue
+		}
+		entries[id] = entry
+	}
+	return entries, nil
+}
+
+// Load implements Loader
+func (s *Store) Load(ctx context.Context) (channelIDs map[string]Entry, playlistIDs map[string]Entry, err error) {
+	if channelIDs, err = s.List(ctx, ChannelKind); err != nil {
+		return nil, nil, err
+	}
+	if playlistIDs, err = s.List(ctx, PlaylistKind); err != nil {
+		return nil, nil, err
+	}
+	return channelIDs, playlistIDs, nil
+}
+
+// Audit returns the audit records since the time, in chronological order.
+// The records are read from the latest one backwards, until one is older than since or is no longer kept.
+func (s *Store) Audit(ctx context.Context, since time.Time) ([]AuditRecord, error) {
+	value, err := s.provider.Get(ctx, s.auditSeqKey())
+	if err == cache.ErrCacheMiss {
+		return []AuditRecord{}, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "getting the count of audit records encountered error")
+	}
+	latest, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "count(%s) of audit records is malformed", value)
+	}
+
+	records := []AuditRecord{}
+	for seq := latest; seq > 0 && seq > latest-AuditCap; seq-- {
+		key := s.auditKey(seq)
+		value, err := s.provider.Get(ctx, key)
+		if err == cache.ErrCacheMiss {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "getting audit record(%s) encountered error", key)
+		}
+		var record AuditRecord
+		if err = json.Unmarshal([]byte(value), &record); err != nil {
+			log.Errorf("audit record(%s) is malformed and skipped: %v", key, err)
+			continue
+		}
+		if record.Time.Before(since) {
+			break
+		}
+		records = append(records, record)
+	}
+
+	// the records are read backwards
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
+
+// audit writes the record to the store and the log. Failing to store the record doesn't fail the change.
+func (s *Store) audit(ctx context.Context, record AuditRecord) {
+	log.WithFields(log.Fields{
+		"audit":  "whitelist",
+		"actor":  record.Actor,
+		"action": record.Action,
+		"kind":   record.Kind,
+		"id":     record.ID,
+	}).Info("whitelist is changed")
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("marshalling whitelist audit record encountered error: %v", err)
+		return
+	}
+	seq, err := s.provider.IncrBy(ctx, s.auditSeqKey(), 1, 0)
+	if err != nil {
+		log.Errorf("numbering whitelist audit record encountered error: %v", err)
+		return
+	}
+	if err = s.provider.Set(ctx, s.auditKey(seq), string(value), AuditRetention); err != nil {
+		log.Errorf("storing whitelist audit record encountered error: %v", err)
+		return
+	}
+	// the records beyond the cap are dropped before they expire
+	if seq > AuditCap {
+		if err = s.provider.Delete(ctx, s.auditKey(seq-AuditCap)); err != nil {
+			log.Errorf("dropping whitelist audit record encountered error: %v", err)
+		}
+	}
+}
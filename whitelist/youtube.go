@@ -1,11 +1,14 @@
 package whitelist
 
 import (
+	"context"
+
 	"github.com/mirror-media/yt-relay/config"
 )
 
 // YouTubeAPI implements the Whitelist interface
 type YouTubeAPI struct {
+	Policies
 	Whitelist config.Whitelists
 }
 
@@ -14,7 +17,7 @@ func (api YouTubeAPI) ValidateChannelID(channelID string) bool {
 	return present && effective
 }
 
-func (api YouTubeAPI) ValidatePlaylistIDs(playlistID string) bool {
+func (api YouTubeAPI) ValidatePlaylistIDs(ctx context.Context, playlistID string) bool {
 	effective, present := api.Whitelist.PlaylistIDs[playlistID]
 	return present && effective
 }
@@ -1,5 +1,12 @@
 package ytrelay
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
 // Options are used to store the supported parsed queries and passed to VideoRelay service
 type Options struct {
 	ChannelID  string `form:"channelId"`  // For YouTube
@@ -16,16 +23,43 @@ type Options struct {
 	Type       string `form:"type"`       // For YouTube
 }
 
-// VideoRelay is responsible to bypass the api request to the video service
+// ValidationError describes why a parameter is invalid
+type ValidationError struct {
+	Parameter string `json:"parameter"`
+	Reason    string `json:"reason"`
+}
+
+// ValidationErrors collects all the invalid parameters of a request
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", err.Parameter, err.Reason))
+	}
+	return "invalid parameters: " + strings.Join(msgs, "; ")
+}
+
+// VideoRelay is responsible to bypass the api request to the video service. The calls are cancelled with ctx.
 type VideoRelay interface {
-	Search(options Options) (resp interface{}, err error)
-	ListByVideoIDs(options Options) (resp interface{}, err error)
-	ListPlaylistVideos(options Options) (resp interface{}, err error)
+	Search(ctx context.Context, options Options) (resp interface{}, err error)
+	ListByVideoIDs(ctx context.Context, options Options) (resp interface{}, err error)
+	ListPlaylistVideos(ctx context.Context, options Options) (resp interface{}, err error)
 }
 
 // APIWhitelist is responsible to validate some options to prevent abusive requests
 type APIWhitelist interface {
-	// ValidateParameters(options Options) bool
+	// ValidateParameters validates the options against the policy of the route. The error is ValidationErrors if any parameter is invalid.
+	ValidateParameters(route string, options Options) error
 	ValidateChannelID(channelID string) bool
-	ValidatePlaylistIDs(playlistID string) bool
+	// ValidatePlaylistIDs validates the playlist, which may be resolved with ctx, e.g. its owner channel
+	ValidatePlaylistIDs(ctx context.Context, playlistID string) bool
+}
+
+// ErrPlaylistNotFound is returned by PlaylistOwnerResolver if the playlist doesn't exist
+var ErrPlaylistNotFound = errors.New("playlist is not found")
+
+// PlaylistOwnerResolver resolves the channel which owns the playlist
+type PlaylistOwnerResolver interface {
+	GetPlaylistOwner(ctx context.Context, playlistID string) (channelID string, err error)
 }